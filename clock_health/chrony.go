@@ -0,0 +1,75 @@
+package clock_health
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chronyc tracking状态, 时间差以本地时间 - NTP时间计
+type ChronyState struct {
+	RefName        string
+	Stratum        int
+	SystemOffsetNs int64 //当前系统时间与NTP时间之差
+	LastOffsetNs   int64 //最近一次更新时估计的时间差
+	RmsOffsetNs    int64 //时间差长期均方根, 可视为抖动
+	LeapStatus     string
+	Synced         bool
+}
+
+// 查询chrony状态的命令, 测试时可替换
+var chronycCommand = []string{"chronyc", "-c", "tracking"}
+
+// 执行chronyc读取同步状态, 未安装chrony时返回错误
+func ReadChronyState(timeout time.Duration) (ChronyState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, chronycCommand[0], chronycCommand[1:]...).Output()
+	if err != nil {
+		return ChronyState{}, err
+	}
+	return parseChronyTracking(string(out))
+}
+
+// 解析 chronyc -c tracking 输出:
+// RefID,名称,stratum,参考时间,System time,Last offset,RMS offset,Frequency,Residual freq,Skew,Root delay,Root dispersion,Update interval,Leap status
+func parseChronyTracking(out string) (ChronyState, error) {
+	fields := strings.Split(strings.TrimSpace(out), ",")
+	if len(fields) < 14 {
+		return ChronyState{}, fmt.Errorf("chronyc输出格式异常: %s", out)
+	}
+	seconds := func(s string) (int64, error) {
+		v, err := strconv.ParseFloat(s, 64)
+		return int64(v * 1e9), err
+	}
+	stratum, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return ChronyState{}, fmt.Errorf("chronyc stratum解析失败: %v", err)
+	}
+	//System time为需要施加的校正量, 正值表示本地时间慢于NTP时间
+	correction, err := seconds(fields[4])
+	if err != nil {
+		return ChronyState{}, fmt.Errorf("chronyc System time解析失败: %v", err)
+	}
+	lastOffset, err := seconds(fields[5])
+	if err != nil {
+		return ChronyState{}, fmt.Errorf("chronyc Last offset解析失败: %v", err)
+	}
+	rmsOffset, err := seconds(fields[6])
+	if err != nil {
+		return ChronyState{}, fmt.Errorf("chronyc RMS offset解析失败: %v", err)
+	}
+	leap := fields[13]
+	return ChronyState{
+		RefName:        fields[1],
+		Stratum:        stratum,
+		SystemOffsetNs: -correction,
+		LastOffsetNs:   lastOffset,
+		RmsOffsetNs:    rmsOffset,
+		LeapStatus:     leap,
+		Synced:         leap != "Not synchronised" && stratum > 0 && stratum < 16,
+	}, nil
+}
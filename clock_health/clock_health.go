@@ -0,0 +1,193 @@
+package clock_health
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSamples   = 4
+	DefaultTimeout   = time.Second
+	DefaultMaxOffset = 5 * time.Millisecond
+)
+
+// 时钟健康检查配置, 零值参数使用默认值
+type Config struct {
+	NtpServers  []string      //NTP服务器, 可带端口, 默认123
+	Samples     int           //每个服务器查询次数, 取往返耗时最小的一次
+	Timeout     time.Duration //单次查询超时
+	MaxOffset   time.Duration //允许的最大时间差
+	MaxJitter   time.Duration //允许的最大抖动, 为0不检查
+	RequireSync bool          //要求内核或chrony报告已同步
+	ReadChrony  bool          //是否读取chronyc tracking
+}
+
+// 单个NTP服务器查询结果
+type NtpServerResult struct {
+	Server      string
+	OffsetNs    int64 //往返耗时最小样本的时间差, 本地时间 - 服务器时间
+	RttNs       int64
+	JitterNs    int64 //各样本时间差相对最佳样本的均方根
+	Stratum     int
+	SampleCount int
+	Error       string `json:",omitempty"`
+}
+
+// 本节点时钟健康状况, 随延迟结果上报
+type ClockHealth struct {
+	CheckTimeNs int64
+	OffsetNs    int64             //本地时间 - 参考时间
+	JitterNs    int64             //时间差抖动
+	Source      string            //时间差来源: ntp / chrony, 为空表示无可用来源
+	Synced      bool              //内核或chrony报告的同步状态, 均不可用时为false
+	InTolerance bool              //是否在容忍范围内, 超出时延迟结果会被标记或丢弃
+	Reason      string            `json:",omitempty"` //超出容忍范围的原因
+	Ntp         []NtpServerResult `json:",omitempty"`
+	Kernel      KernelClockState
+	Chrony      *ChronyState `json:",omitempty"`
+}
+
+// 时钟健康检查器
+type Checker struct {
+	cfg        Config
+	readKernel func() (KernelClockState, error)
+	readChrony func(timeout time.Duration) (ChronyState, error)
+}
+
+func NewChecker(cfg Config) *Checker {
+	if cfg.Samples <= 0 {
+		cfg.Samples = DefaultSamples
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxOffset <= 0 {
+		cfg.MaxOffset = DefaultMaxOffset
+	}
+	return &Checker{
+		cfg:        cfg,
+		readKernel: ReadKernelClockState,
+		readChrony: ReadChronyState,
+	}
+}
+
+// 查询所有NTP服务器及本地同步状态, 给出综合判断
+func (c *Checker) Check() ClockHealth {
+	health := ClockHealth{CheckTimeNs: time.Now().UnixNano()}
+
+	//NTP: 各服务器取中位数, 抗单个服务器异常
+	var offsets []int64
+	jitterSquareSum := 0.0
+	for _, server := range c.cfg.NtpServers {
+		result := c.queryServer(server)
+		health.Ntp = append(health.Ntp, result)
+		if result.Error == "" {
+			offsets = append(offsets, result.OffsetNs)
+			jitterSquareSum += float64(result.JitterNs) * float64(result.JitterNs)
+		}
+	}
+
+	if kernel, err := c.readKernel(); err == nil {
+		health.Kernel = kernel
+	}
+	if c.cfg.ReadChrony {
+		if chrony, err := c.readChrony(c.cfg.Timeout); err == nil {
+			health.Chrony = &chrony
+		}
+	}
+
+	switch {
+	case len(offsets) > 0:
+		health.Source = "ntp"
+		health.OffsetNs = medianInt64(offsets)
+		health.JitterNs = int64(math.Sqrt(jitterSquareSum / float64(len(offsets))))
+	case health.Chrony != nil:
+		health.Source = "chrony"
+		health.OffsetNs = health.Chrony.SystemOffsetNs
+		health.JitterNs = health.Chrony.RmsOffsetNs
+	}
+	if health.Chrony != nil {
+		health.Synced = health.Chrony.Synced
+	} else {
+		health.Synced = health.Kernel.Available && health.Kernel.Synced
+	}
+
+	//内核PLL待调整量不是相对参考时间的偏差, 不作为时间差来源, 仅提供同步状态及误差估计
+	var reasons []string
+	switch {
+	case health.Source == "" && len(c.cfg.NtpServers) > 0:
+		reasons = append(reasons, "NTP不可达")
+	case health.Source == "":
+		reasons = append(reasons, "无可用时钟来源")
+	}
+	if abs(health.OffsetNs) > int64(c.cfg.MaxOffset) {
+		reasons = append(reasons, fmt.Sprintf("时间差%.3fms超过%.3fms",
+			float64(health.OffsetNs)/1e6, float64(c.cfg.MaxOffset)/1e6))
+	}
+	if c.cfg.MaxJitter > 0 && health.JitterNs > int64(c.cfg.MaxJitter) {
+		reasons = append(reasons, fmt.Sprintf("抖动%.3fms超过%.3fms",
+			float64(health.JitterNs)/1e6, float64(c.cfg.MaxJitter)/1e6))
+	}
+	if c.cfg.RequireSync && !health.Synced {
+		reasons = append(reasons, "本地时钟未同步")
+	}
+	health.InTolerance = len(reasons) == 0
+	health.Reason = strings.Join(reasons, "; ")
+	return health
+}
+
+// 多次查询单个服务器, 取往返耗时最小的样本
+func (c *Checker) queryServer(server string) NtpServerResult {
+	result := NtpServerResult{Server: server}
+	var samples []NtpSample
+	var lastErr error
+	for i := 0; i < c.cfg.Samples; i++ {
+		sample, err := QueryNtp(server, c.cfg.Timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	result.SampleCount = len(samples)
+	if len(samples) == 0 {
+		result.Error = lastErr.Error()
+		return result
+	}
+	best := samples[0]
+	for _, s := range samples[1:] {
+		if s.RttNs < best.RttNs {
+			best = s
+		}
+	}
+	squareSum := 0.0
+	for _, s := range samples {
+		d := float64(s.OffsetNs - best.OffsetNs)
+		squareSum += d * d
+	}
+	result.OffsetNs = best.OffsetNs
+	result.RttNs = best.RttNs
+	result.Stratum = best.Stratum
+	result.JitterNs = int64(math.Sqrt(squareSum / float64(len(samples))))
+	return result
+}
+
+func medianInt64(values []int64) int64 {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return sorted[mid-1] + (sorted[mid]-sorted[mid-1])/2
+	}
+	return sorted[mid]
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
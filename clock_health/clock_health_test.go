@@ -0,0 +1,132 @@
+package clock_health
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// 本地NTP模拟服务器, 服务器时间比本地慢lag, 返回地址及关闭函数
+func newLocalNtpServer(t *testing.T, lag time.Duration, stratum byte) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			res := make([]byte, 48)
+			res[0] = 0<<6 | 4<<3 | 4 //LI=0, VN=4, Mode=4(server)
+			res[1] = stratum
+			copy(res[24:32], buf[40:48])
+			putNtpTime(res[32:40], time.Now().Add(-lag))
+			time.Sleep(time.Millisecond)
+			putNtpTime(res[40:48], time.Now().Add(-lag))
+			conn.WriteTo(res, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestQueryNtp(t *testing.T) {
+	server, closeServer := newLocalNtpServer(t, 20*time.Millisecond, 2)
+	defer closeServer()
+
+	sample, err := QueryNtp(server, time.Second)
+	if err != nil {
+		t.Fatalf("QueryNtp failed: %v", err)
+	}
+	if sample.Stratum != 2 {
+		t.Errorf("Expected stratum 2, got %d", sample.Stratum)
+	}
+	//服务端1ms处理耗时不计入往返
+	if sample.RttNs < 0 || sample.RttNs > int64(time.Millisecond) {
+		t.Errorf("Unexpected rtt %d ns", sample.RttNs)
+	}
+	if diff := sample.OffsetNs - int64(20*time.Millisecond); diff < -int64(time.Millisecond) || diff > int64(time.Millisecond) {
+		t.Errorf("Expected offset ≈ 20ms, got %d ns", sample.OffsetNs)
+	}
+
+	unsynced, closeUnsynced := newLocalNtpServer(t, 0, 0)
+	defer closeUnsynced()
+	if _, err := QueryNtp(unsynced, time.Second); err == nil {
+		t.Error("Expected error for stratum 0 reply")
+	}
+}
+
+func TestCheckerTolerance(t *testing.T) {
+	good, closeGood := newLocalNtpServer(t, 0, 1)
+	defer closeGood()
+	bad, closeBad := newLocalNtpServer(t, 50*time.Millisecond, 1)
+	defer closeBad()
+	bad2, closeBad2 := newLocalNtpServer(t, 50*time.Millisecond, 1)
+	defer closeBad2()
+
+	kernelSynced := func() (KernelClockState, error) {
+		return KernelClockState{Available: true, Synced: true}, nil
+	}
+	newChecker := func(cfg Config) *Checker {
+		c := NewChecker(cfg)
+		c.readKernel = kernelSynced
+		return c
+	}
+
+	health := newChecker(Config{NtpServers: []string{good}, Samples: 3, Timeout: time.Second}).Check()
+	if !health.InTolerance || health.Source != "ntp" || !health.Synced || len(health.Ntp) != 1 || health.Ntp[0].SampleCount != 3 {
+		t.Errorf("Expected healthy clock, got %+v", health)
+	}
+
+	//三个服务器取中位数: 两个慢50ms的服务器使本地时间差超限
+	health = newChecker(Config{NtpServers: []string{good, bad, bad2}, Samples: 2, Timeout: time.Second}).Check()
+	if health.InTolerance || health.OffsetNs < int64(45*time.Millisecond) || health.Reason == "" {
+		t.Errorf("Expected out-of-tolerance clock, got %+v", health)
+	}
+
+	//不可达的服务器记录错误, 回退到chrony状态
+	c := newChecker(Config{NtpServers: []string{"127.0.0.1:1"}, Samples: 1, Timeout: 200 * time.Millisecond, ReadChrony: true, RequireSync: true})
+	c.readChrony = func(time.Duration) (ChronyState, error) {
+		return parseChronyTracking("A29FC87B,ntp1.example.com,3,1697040000.123456789,0.000002000,-0.000001000,0.000030000,-12.345,0.001,0.020,0.010,0.001,64.5,Not synchronised\n")
+	}
+	health = c.Check()
+	if health.Ntp[0].Error == "" || health.Source != "chrony" {
+		t.Errorf("Expected chrony fallback, got %+v", health)
+	}
+	if health.OffsetNs != -2000 || health.JitterNs != 30000 || health.Synced || health.InTolerance {
+		t.Errorf("Unexpected chrony-based health %+v", health)
+	}
+
+	//NTP全部不可达且无chrony时, 不以内核状态代替时间差
+	health = newChecker(Config{NtpServers: []string{"127.0.0.1:1"}, Samples: 1, Timeout: 200 * time.Millisecond}).Check()
+	if health.InTolerance || health.Source != "" || health.Reason != "NTP不可达" || !health.Synced {
+		t.Errorf("Expected unreachable NTP out of tolerance, got %+v", health)
+	}
+
+	//无任何来源
+	c = NewChecker(Config{})
+	c.readKernel = func() (KernelClockState, error) { return KernelClockState{}, errors.New("unsupported") }
+	if health = c.Check(); health.InTolerance || health.Source != "" {
+		t.Errorf("Expected no clock source, got %+v", health)
+	}
+}
+
+func TestParseChronyTracking(t *testing.T) {
+	state, err := parseChronyTracking("C0A80001,192.168.0.1,2,1697040000.000000000,-0.000150000,0.000010000,0.000020000,1.0,0.0,0.0,0.0,0.0,16.0,Normal")
+	if err != nil {
+		t.Fatalf("parseChronyTracking failed: %v", err)
+	}
+	//System time为负表示本地时间快于NTP时间
+	if state.SystemOffsetNs != 150000 || state.LastOffsetNs != 10000 || state.Stratum != 2 || !state.Synced {
+		t.Errorf("Unexpected chrony state %+v", state)
+	}
+	if _, err := parseChronyTracking("506"); err == nil {
+		t.Error("Expected error for malformed output")
+	}
+}
@@ -0,0 +1,12 @@
+package clock_health
+
+// 内核时钟同步状态(adjtimex), 误差单位均为纳秒
+type KernelClockState struct {
+	Available  bool  //当前平台是否支持读取
+	Synced     bool  //内核未处于TIME_ERROR且STA_UNSYNC未置位
+	OffsetNs   int64 //内核PLL当前待调整的时间差
+	MaxErrorNs int64 //最大误差估计
+	EstErrorNs int64 //平均误差估计
+	Status     int   //STA_*状态位
+	FreqPpm    float64
+}
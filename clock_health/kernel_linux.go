@@ -0,0 +1,33 @@
+package clock_health
+
+import "syscall"
+
+const (
+	timeError = 5      //adjtimex返回TIME_ERROR表示时钟未同步
+	staUnsync = 0x0040 //STA_UNSYNC
+	staNano   = 0x2000 //STA_NANO, Offset单位为纳秒而非微秒
+)
+
+// 通过adjtimex只读查询内核时钟状态
+func ReadKernelClockState() (KernelClockState, error) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return KernelClockState{}, err
+	}
+	status := int(tx.Status)
+	offsetNs := int64(tx.Offset)
+	if status&staNano == 0 {
+		offsetNs *= 1000
+	}
+	return KernelClockState{
+		Available:  true,
+		Synced:     state != timeError && status&staUnsync == 0,
+		OffsetNs:   offsetNs,
+		MaxErrorNs: int64(tx.Maxerror) * 1000,
+		EstErrorNs: int64(tx.Esterror) * 1000,
+		Status:     status,
+		//freq单位为2^-16 ppm
+		FreqPpm: float64(tx.Freq) / 65536,
+	}, nil
+}
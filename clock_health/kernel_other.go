@@ -0,0 +1,8 @@
+//go:build !linux
+
+package clock_health
+
+// 非Linux平台不支持adjtimex
+func ReadKernelClockState() (KernelClockState, error) {
+	return KernelClockState{}, nil
+}
@@ -0,0 +1,88 @@
+package clock_health
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// NTP时间戳起点(1900-01-01)到Unix时间起点的秒数
+const ntpEpochOffset = 2208988800
+
+// 单次SNTP查询结果, 时间差以本地时间 - 服务器时间计
+type NtpSample struct {
+	OffsetNs int64
+	RttNs    int64 //往返耗时, 已扣除服务端处理耗时
+	Stratum  int
+}
+
+// 发送一次SNTP(v4 client)请求
+func QueryNtp(server string, timeout time.Duration) (NtpSample, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return NtpSample{}, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return NtpSample{}, err
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3 //LI=0, VN=4, Mode=3(client)
+	sendTime := time.Now()
+	putNtpTime(req[40:], sendTime)
+	if _, err := conn.Write(req); err != nil {
+		return NtpSample{}, err
+	}
+
+	res := make([]byte, 48)
+	n, err := conn.Read(res)
+	recvTime := time.Now()
+	if err != nil {
+		return NtpSample{}, err
+	}
+	if n < 48 {
+		return NtpSample{}, fmt.Errorf("NTP应答长度异常: %d", n)
+	}
+	if mode := res[0] & 0x7; mode != 4 {
+		return NtpSample{}, fmt.Errorf("NTP应答模式异常: %d", mode)
+	}
+	stratum := int(res[1])
+	if stratum == 0 || res[0]>>6 == 3 {
+		return NtpSample{}, errors.New("NTP服务器未同步(kiss-o'-death或LI=3)")
+	}
+	//应答的originate应回显请求的transmit, 防止串包
+	if binary.BigEndian.Uint64(res[24:32]) != binary.BigEndian.Uint64(req[40:48]) {
+		return NtpSample{}, errors.New("NTP应答originate时间戳不匹配")
+	}
+
+	t1 := sendTime.UnixNano()
+	t2 := ntpTimeNs(res[32:40])
+	t3 := ntpTimeNs(res[40:48])
+	t4 := recvTime.UnixNano()
+	return NtpSample{
+		OffsetNs: ((t1 - t2) + (t4 - t3)) / 2,
+		RttNs:    (t4 - t1) - (t3 - t2),
+		Stratum:  stratum,
+	}, nil
+}
+
+// 写入64位NTP时间戳(32位秒 + 32位秒小数)
+func putNtpTime(b []byte, t time.Time) {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint64(b, sec<<32|frac)
+}
+
+// 解析64位NTP时间戳为Unix纳秒
+func ntpTimeNs(b []byte) int64 {
+	v := binary.BigEndian.Uint64(b)
+	sec := int64(v>>32) - ntpEpochOffset
+	frac := int64((v & 0xffffffff) * 1e9 >> 32)
+	return sec*1e9 + frac
+}
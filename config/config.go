@@ -65,6 +65,10 @@ func GetConfigBool(name string) bool {
 	return viper.GetBool(name)
 }
 
+func GetConfigFloat64(name string) float64 {
+	return viper.GetFloat64(name)
+}
+
 func GetConfigSlice(name string) []string {
 	result := viper.GetStringSlice(name)
 	return result
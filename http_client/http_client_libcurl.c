@@ -7,6 +7,7 @@
 
 struct HttpClientLibcurl {
     CURL* curl_handle;
+    struct curl_slist* resolve_list; // 固定解析 host:port:addr, 每次请求reset后重新设置
     int is_initialized;
 };
 
@@ -73,10 +74,25 @@ HttpClientLibcurl* http_client_new_libcurl() {
         return NULL;
     }
     
+    client->resolve_list = NULL;
     client->is_initialized = 1;
     return client;
 }
 
+int http_client_set_resolve_libcurl(HttpClientLibcurl* client, const char** entries) {
+    if (!client || !client->is_initialized) return -1;
+    if (client->resolve_list) {
+        curl_slist_free_all(client->resolve_list);
+        client->resolve_list = NULL;
+    }
+    if (entries) {
+        for (int i = 0; entries[i] != NULL; i++) {
+            client->resolve_list = curl_slist_append(client->resolve_list, entries[i]);
+        }
+    }
+    return 0;
+}
+
 HttpResultLibcurl http_request_libcurl(HttpClientLibcurl* client, const char* url, int timeout_ms, 
                                       int force_http_version, HttpMethod method,
                                       const char* post_data, const char** headers) {
@@ -99,6 +115,9 @@ HttpResultLibcurl http_request_libcurl(HttpClientLibcurl* client, const char* ur
     curl_easy_setopt(client->curl_handle, CURLOPT_TIMEOUT_MS, (long)timeout_ms);
     curl_easy_setopt(client->curl_handle, CURLOPT_CONNECTTIMEOUT_MS, (long)(timeout_ms / 2));
     curl_easy_setopt(client->curl_handle, CURLOPT_USERAGENT, "HTTPLatencyTest/1.0");
+    if (client->resolve_list) {
+        curl_easy_setopt(client->curl_handle, CURLOPT_RESOLVE, client->resolve_list);
+    }
     
     if (force_http_version == 0) {
         curl_easy_setopt(client->curl_handle, CURLOPT_HTTP_VERSION, 
@@ -199,6 +218,10 @@ void http_client_destroy_libcurl(HttpClientLibcurl* client) {
             curl_easy_cleanup(client->curl_handle);
             client->curl_handle = NULL;
         }
+        if (client->resolve_list) {
+            curl_slist_free_all(client->resolve_list);
+            client->resolve_list = NULL;
+        }
         client->is_initialized = 0;
         free(client);
     }
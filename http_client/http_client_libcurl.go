@@ -57,6 +57,29 @@ func (c *ClientLibcurl) Close() {
 	}
 }
 
+// SetResolve 设置固定解析, 形如 "host:port:addr", 之后的请求均连接指定地址
+// 应在首次请求前设置: 已写入句柄DNS缓存的解析及已建立的连接不会因再次设置而失效
+func (c *ClientLibcurl) SetResolve(entries []string) error {
+	if c.client == nil {
+		return &CError{Code: -1}
+	}
+
+	var cEntries **C.char
+	if len(entries) > 0 {
+		cEntriesArray := make([]*C.char, len(entries)+1)
+		for i, entry := range entries {
+			cEntriesArray[i] = C.CString(entry)
+			defer C.free(unsafe.Pointer(cEntriesArray[i]))
+		}
+		cEntriesArray[len(entries)] = nil
+		cEntries = &cEntriesArray[0]
+	}
+	if r := C.http_client_set_resolve_libcurl((*C.HttpClientLibcurl)(c.client), cEntries); r != 0 {
+		return &CError{Code: int(r)}
+	}
+	return nil
+}
+
 // Request 执行HTTP请求
 func (c *ClientLibcurl) Request(url string, timeoutMs int, forceHttpVersion int, method int, postData string, headers []string) ResultLibcurl {
 	if c.client == nil {
@@ -41,6 +41,8 @@ int http_client_init_libcurl();
 HttpResultLibcurl http_request_libcurl(HttpClientLibcurl* client, const char* url, int timeout_ms, 
                                       int force_http_version, HttpMethod method,
                                       const char* post_data, const char** headers);
+// 设置固定解析列表, 形如 "host:port:addr", 以NULL结尾
+int http_client_set_resolve_libcurl(HttpClientLibcurl* client, const char** entries);
 void http_free_error_libcurl(char* ptr);
 void http_free_response_libcurl(char* ptr);
 void http_client_destroy_libcurl(HttpClientLibcurl* client);
@@ -1,6 +1,9 @@
 package http_client
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 )
 
@@ -70,3 +73,36 @@ func TestClientLifecycle(t *testing.T) {
 		t.Errorf("Expected error after closing client, got none")
 	}
 }
+
+// 测试固定解析: 不可解析的主机名通过SetResolve连接到本地服务
+func TestClientSetResolve(t *testing.T) {
+	if err := InitLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupLibcurl()
+
+	hostChan := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hostChan <- r.Host
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	client, err := NewClientLibcurl()
+	if err != nil {
+		t.Fatalf("NewClientLibcurl failed: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SetResolve([]string{"pinned.invalid:" + u.Port() + ":127.0.0.1"}); err != nil {
+		t.Fatalf("SetResolve failed: %v", err)
+	}
+	res := client.Get("http://pinned.invalid:"+u.Port()+"/", 5000, 0)
+	if res.Error != "" || res.StatusCode != 200 || res.ResponseBody != "ok" {
+		t.Fatalf("Expected pinned request to succeed, got %+v", res)
+	}
+	if host := <-hostChan; host != "pinned.invalid:"+u.Port() {
+		t.Errorf("Expected Host header of pinned name, got %s", host)
+	}
+}
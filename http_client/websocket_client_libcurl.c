@@ -3,13 +3,21 @@
 #include <stdlib.h>
 #include <string.h>
 #include <time.h>
+#include <poll.h>
 #include <curl/curl.h>
 
 struct WebSocketClientLibcurl {
     CURL *curl_handle;
+    struct curl_slist *header_list; // 握手请求头, 需在连接存续期间保持有效
+    struct curl_slist *resolve_list; // 固定解析 host:port:addr
     int is_initialized;
 };
 
+typedef struct {
+    char* data;
+    size_t size;
+} HeaderData;
+
 static int global_ws_initialized = 0;
 
 static int64_t get_time_ns() {
@@ -30,6 +38,46 @@ static char* make_error(const char* msg) {
     return err;
 }
 
+// 收集升级响应头, 遇到新的状态行(重定向)时丢弃之前的内容
+static size_t header_callback(char* buffer, size_t size, size_t nitems, void* userp) {
+    HeaderData* hdr = (HeaderData*)userp;
+    size_t realsize = size * nitems;
+
+    if (realsize >= 5 && strncmp(buffer, "HTTP/", 5) == 0) {
+        hdr->size = 0;
+    }
+
+    char* ptr = realloc(hdr->data, hdr->size + realsize + 1);
+    if (!ptr) return 0;
+
+    hdr->data = ptr;
+    memcpy(&(hdr->data[hdr->size]), buffer, realsize);
+    hdr->size += realsize;
+    hdr->data[hdr->size] = 0;
+
+    return realsize;
+}
+
+// curl计时为从请求开始的累计值(微秒), 转为单阶段纳秒耗时
+static int64_t phase_ns(curl_off_t end_us, curl_off_t start_us) {
+    if (end_us <= 0 || end_us < start_us) return 0;
+    return (int64_t)(end_us - start_us) * 1000;
+}
+
+// 等待连接套接字可读, 取不到套接字时退化为固定休眠
+static void wait_socket_readable(CURL* curl_handle, int timeout_ms) {
+    curl_socket_t sockfd = CURL_SOCKET_BAD;
+    if (curl_easy_getinfo(curl_handle, CURLINFO_ACTIVESOCKET, &sockfd) == CURLE_OK && sockfd != CURL_SOCKET_BAD) {
+        struct pollfd pfd = {0};
+        pfd.fd = sockfd;
+        pfd.events = POLLIN;
+        poll(&pfd, 1, timeout_ms);
+        return;
+    }
+    struct timespec ts = {0, (long)timeout_ms * 1000000L};
+    nanosleep(&ts, NULL);
+}
+
 int websocket_client_init_libcurl() {
     if (global_ws_initialized) return 0;
     if (curl_global_init(CURL_GLOBAL_DEFAULT) != CURLE_OK) return -1;
@@ -49,12 +97,15 @@ WebSocketClientLibcurl* websocket_client_new_libcurl() {
         return NULL;
     }
 
+    client->header_list = NULL;
+    client->resolve_list = NULL;
     client->is_initialized = 1;
     return client;
 }
 
 // 建立 WebSocket 连接
-WebSocketResultLibcurl websocket_connect_libcurl(WebSocketClientLibcurl* client, const char* url, int timeout_ms) {
+WebSocketResultLibcurl websocket_connect_libcurl(WebSocketClientLibcurl* client, const char* url, int timeout_ms,
+                                                 const char** headers, const char** resolve) {
     WebSocketResultLibcurl result = {0};
     result.latency_ns = -1;
 
@@ -76,10 +127,67 @@ WebSocketResultLibcurl websocket_connect_libcurl(WebSocketClientLibcurl* client,
     curl_easy_setopt(client->curl_handle, CURLOPT_HTTP_VERSION, CURL_HTTP_VERSION_1_1);
     curl_easy_setopt(client->curl_handle, CURLOPT_FOLLOWLOCATION, 1L);
 
+    // 自定义握手请求头(子协议/Origin等), 上一次连接的请求头在reset后即可释放
+    if (client->header_list) {
+        curl_slist_free_all(client->header_list);
+        client->header_list = NULL;
+    }
+    if (headers) {
+        for (int i = 0; headers[i] != NULL; i++) {
+            client->header_list = curl_slist_append(client->header_list, headers[i]);
+        }
+        if (client->header_list) {
+            curl_easy_setopt(client->curl_handle, CURLOPT_HTTPHEADER, client->header_list);
+        }
+    }
+
+    // 固定解析到指定后端地址, 跳过DNS
+    if (client->resolve_list) {
+        curl_slist_free_all(client->resolve_list);
+        client->resolve_list = NULL;
+    }
+    if (resolve) {
+        for (int i = 0; resolve[i] != NULL; i++) {
+            client->resolve_list = curl_slist_append(client->resolve_list, resolve[i]);
+        }
+        if (client->resolve_list) {
+            curl_easy_setopt(client->curl_handle, CURLOPT_RESOLVE, client->resolve_list);
+        }
+    }
+
+    HeaderData hdr = {0};
+    curl_easy_setopt(client->curl_handle, CURLOPT_HEADERFUNCTION, header_callback);
+    curl_easy_setopt(client->curl_handle, CURLOPT_HEADERDATA, &hdr);
+
     CURLcode res = curl_easy_perform(client->curl_handle);
+
+    // 握手结束后不再收集响应头, 避免回调引用已失效的栈变量
+    curl_easy_setopt(client->curl_handle, CURLOPT_HEADERFUNCTION, NULL);
+    curl_easy_setopt(client->curl_handle, CURLOPT_HEADERDATA, NULL);
+
+    long response_code = 0;
+    curl_easy_getinfo(client->curl_handle, CURLINFO_RESPONSE_CODE, &response_code);
+    result.status_code = (int)response_code;
+
+    if (hdr.data && hdr.size > 0) {
+        result.response_headers = hdr.data;
+    } else {
+        free(hdr.data);
+    }
+
     if (res == CURLE_OK) {
         result.latency_ns = get_time_ns() - start_time;
-        result.status_code = 101; // WebSocket 握手成功 (HTTP 101 Switching Protocols)
+
+        curl_off_t dns_time = 0, connect_time = 0, app_connect_time = 0, total_time = 0;
+        curl_easy_getinfo(client->curl_handle, CURLINFO_NAMELOOKUP_TIME_T, &dns_time);
+        curl_easy_getinfo(client->curl_handle, CURLINFO_CONNECT_TIME_T, &connect_time);
+        curl_easy_getinfo(client->curl_handle, CURLINFO_APPCONNECT_TIME_T, &app_connect_time);
+        curl_easy_getinfo(client->curl_handle, CURLINFO_TOTAL_TIME_T, &total_time);
+
+        result.dns_time_ns = phase_ns(dns_time, 0);
+        result.tcp_time_ns = phase_ns(connect_time, dns_time);
+        result.tls_time_ns = phase_ns(app_connect_time, connect_time);
+        result.upgrade_time_ns = phase_ns(total_time, app_connect_time > 0 ? app_connect_time : connect_time);
     } else {
         result.error_message = make_error(curl_easy_strerror(res));
     }
@@ -119,12 +227,19 @@ int websocket_send_libcurl(WebSocketClientLibcurl* client, const char* msg, size
 }
 
 // 接收 WebSocket 消息（改进版本）
-char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, int* out_is_text) {
-    if (!client || !client->is_initialized || !client->curl_handle) return NULL;
+char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, int* out_is_text, int* out_error) {
+    if (out_error) *out_error = WEBSOCKET_OK;
+    if (!client || !client->is_initialized || !client->curl_handle) {
+        if (out_error) *out_error = WEBSOCKET_ERROR_INVALID_CLIENT;
+        return NULL;
+    }
 
     size_t buffer_size = WEBSOCKET_INITIAL_BUFFER_SIZE;
     char* buffer = malloc(buffer_size);
-    if (!buffer) return NULL;
+    if (!buffer) {
+        if (out_error) *out_error = WEBSOCKET_ERROR_MEMORY;
+        return NULL;
+    }
 
     size_t total_received = 0;
     const struct curl_ws_frame *frame = NULL;
@@ -146,6 +261,7 @@ char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, in
             char* new_buffer = realloc(buffer, new_size);
             if (!new_buffer) {
                 free(buffer);
+                if (out_error) *out_error = WEBSOCKET_ERROR_MEMORY;
                 return NULL; // 内存扩展失败
             }
             buffer = new_buffer;
@@ -156,6 +272,7 @@ char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, in
         // 检查是否达到最大缓冲区限制
         if (available_space < 1024) {
             free(buffer);
+            if (out_error) *out_error = WEBSOCKET_ERROR_BUFFER_OVERFLOW;
             return NULL; // 缓冲区溢出
         }
 
@@ -172,9 +289,8 @@ char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, in
             if (total_received > 0 && frame && !(frame->flags & CURLWS_CONT)) {
                 break; // 已有完整帧，可以返回
             }
-            // 短暂等待后重试（使用简单的延时模拟）
-            struct timespec ts = {0, 10000000}; // 10ms
-            nanosleep(&ts, NULL);
+            // 等待套接字可读后重试，最多等待10ms，避免固定休眠带来的接收延迟偏差
+            wait_socket_readable(client->curl_handle, 10);
             continue;
         }
         
@@ -184,7 +300,15 @@ char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, in
                 break;
             }
             free(buffer);
-            return NULL; // 接收错误且无数据
+            if (out_error) *out_error = WEBSOCKET_ERROR_NETWORK;
+            return NULL; // 接收错误且无数据(连接已断开)
+        }
+
+        // 对端发送关闭帧，连接已不可用
+        if (frame && (frame->flags & CURLWS_CLOSE)) {
+            free(buffer);
+            if (out_error) *out_error = WEBSOCKET_ERROR_CLOSED;
+            return NULL;
         }
         
         // 重置重试计数（收到数据时）
@@ -244,6 +368,14 @@ void websocket_client_destroy_libcurl(WebSocketClientLibcurl* client) {
             curl_easy_cleanup(client->curl_handle);
             client->curl_handle = NULL;
         }
+        if (client->header_list) {
+            curl_slist_free_all(client->header_list);
+            client->header_list = NULL;
+        }
+        if (client->resolve_list) {
+            curl_slist_free_all(client->resolve_list);
+            client->resolve_list = NULL;
+        }
         client->is_initialized = 0;
         free(client);
     }
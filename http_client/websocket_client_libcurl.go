@@ -8,7 +8,13 @@ package http_client
 */
 import "C"
 import (
+	"bufio"
 	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -22,13 +28,42 @@ const (
 	WEBSOCKET_ERROR_TIMEOUT         = -5
 	WEBSOCKET_ERROR_MEMORY          = -6
 	WEBSOCKET_ERROR_BUFFER_OVERFLOW = -7
+	WEBSOCKET_ERROR_CLOSED          = -8
 )
 
 // WebSocketResultLibcurl 结构体（与C保持一致）
+// 各阶段耗时为单阶段耗时, 之和约等于 LatencyNs
 type WebSocketResultLibcurl struct {
-	LatencyNs  int64
-	StatusCode int
-	Error      string
+	LatencyNs       int64
+	StatusCode      int
+	Error           string
+	DNSTimeNs       int64       // DNS解析耗时
+	TCPTimeNs       int64       // TCP连接耗时
+	TLSTimeNs       int64       // TLS握手耗时
+	UpgradeTimeNs   int64       // HTTP Upgrade耗时
+	ResponseHeaders http.Header // 升级响应头
+	Subprotocol     string      // 服务端选定的子协议
+}
+
+// WebSocketConnectOptions 握手可选参数
+type WebSocketConnectOptions struct {
+	Headers      []string // 自定义请求头, 形如 "Key: Value"
+	Subprotocols []string // 请求的子协议列表, 写入 Sec-WebSocket-Protocol
+	Origin       string   // Origin 请求头
+	Resolve      []string // 固定解析, 形如 "host:port:addr", 用于连接指定后端IP
+}
+
+// headerLines 将握手参数转换为请求头行
+func (o WebSocketConnectOptions) headerLines() []string {
+	lines := make([]string, 0, len(o.Headers)+2)
+	lines = append(lines, o.Headers...)
+	if len(o.Subprotocols) > 0 {
+		lines = append(lines, "Sec-WebSocket-Protocol: "+strings.Join(o.Subprotocols, ", "))
+	}
+	if o.Origin != "" {
+		lines = append(lines, "Origin: "+o.Origin)
+	}
+	return lines
 }
 
 // WebSocketError 封装WebSocket特定错误
@@ -53,13 +88,17 @@ func (e *WebSocketError) Error() string {
 		return "Memory allocation failed"
 	case WEBSOCKET_ERROR_BUFFER_OVERFLOW:
 		return "Buffer overflow detected"
+	case WEBSOCKET_ERROR_CLOSED:
+		return "Connection closed by peer"
 	default:
 		return fmt.Sprintf("Unknown WebSocket error (code: %d)", e.Code)
 	}
 }
 
 // WebSocketClientLibcurl Go封装的客户端
+// libcurl句柄非线程安全, 所有C调用由mu串行化, 以便Stream读协程与Send并发使用
 type WebSocketClientLibcurl struct {
+	mu     sync.Mutex
 	client unsafe.Pointer
 }
 
@@ -88,6 +127,8 @@ func NewWebSocketClientLibcurl() (*WebSocketClientLibcurl, error) {
 
 // Close 关闭并释放WebSocket客户端
 func (c *WebSocketClientLibcurl) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.client != nil {
 		C.websocket_client_destroy_libcurl((*C.WebSocketClientLibcurl)(c.client))
 		c.client = nil
@@ -96,6 +137,13 @@ func (c *WebSocketClientLibcurl) Close() {
 
 // Connect 建立WebSocket连接
 func (c *WebSocketClientLibcurl) Connect(url string, timeoutMs int) WebSocketResultLibcurl {
+	return c.ConnectWithOptions(url, timeoutMs, WebSocketConnectOptions{})
+}
+
+// ConnectWithOptions 携带自定义请求头/子协议/Origin建立WebSocket连接
+func (c *WebSocketClientLibcurl) ConnectWithOptions(url string, timeoutMs int, opts WebSocketConnectOptions) WebSocketResultLibcurl {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.client == nil {
 		return WebSocketResultLibcurl{Error: "Client not initialized"}
 	}
@@ -103,7 +151,30 @@ func (c *WebSocketClientLibcurl) Connect(url string, timeoutMs int) WebSocketRes
 	cURL := C.CString(url)
 	defer C.free(unsafe.Pointer(cURL))
 
-	res := C.websocket_connect_libcurl((*C.WebSocketClientLibcurl)(c.client), cURL, C.int(timeoutMs))
+	var cHeaders **C.char
+	headers := opts.headerLines()
+	if len(headers) > 0 {
+		cHeadersArray := make([]*C.char, len(headers)+1)
+		for i, header := range headers {
+			cHeadersArray[i] = C.CString(header)
+			defer C.free(unsafe.Pointer(cHeadersArray[i]))
+		}
+		cHeadersArray[len(headers)] = nil
+		cHeaders = &cHeadersArray[0]
+	}
+
+	var cResolve **C.char
+	if len(opts.Resolve) > 0 {
+		cResolveArray := make([]*C.char, len(opts.Resolve)+1)
+		for i, entry := range opts.Resolve {
+			cResolveArray[i] = C.CString(entry)
+			defer C.free(unsafe.Pointer(cResolveArray[i]))
+		}
+		cResolveArray[len(opts.Resolve)] = nil
+		cResolve = &cResolveArray[0]
+	}
+
+	res := C.websocket_connect_libcurl((*C.WebSocketClientLibcurl)(c.client), cURL, C.int(timeoutMs), cHeaders, cResolve)
 
 	var goErr string
 	if res.error_message != nil {
@@ -111,44 +182,90 @@ func (c *WebSocketClientLibcurl) Connect(url string, timeoutMs int) WebSocketRes
 		C.websocket_free_error_libcurl(res.error_message)
 	}
 
+	var responseHeaders http.Header
+	if res.response_headers != nil {
+		responseHeaders = parseResponseHeaders(C.GoString(res.response_headers))
+		C.websocket_free_error_libcurl(res.response_headers)
+	}
+
 	return WebSocketResultLibcurl{
-		LatencyNs:  int64(res.latency_ns),
-		StatusCode: int(res.status_code),
-		Error:      goErr,
+		LatencyNs:       int64(res.latency_ns),
+		StatusCode:      int(res.status_code),
+		Error:           goErr,
+		DNSTimeNs:       int64(res.dns_time_ns),
+		TCPTimeNs:       int64(res.tcp_time_ns),
+		TLSTimeNs:       int64(res.tls_time_ns),
+		UpgradeTimeNs:   int64(res.upgrade_time_ns),
+		ResponseHeaders: responseHeaders,
+		Subprotocol:     responseHeaders.Get("Sec-WebSocket-Protocol"),
+	}
+}
+
+// parseResponseHeaders 解析升级响应头原文, 跳过状态行
+func parseResponseHeaders(raw string) http.Header {
+	header := http.Header{}
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "HTTP/") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		header.Add(textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key)), strings.TrimSpace(value))
 	}
+	return header
 }
 
 // Send 发送WebSocket消息
 // isText = true 发送文本，false 发送二进制
 func (c *WebSocketClientLibcurl) Send(msg string, isText bool) (int, error) {
-	if c.client == nil {
-		return -1, &WebSocketError{Code: WEBSOCKET_ERROR_INVALID_CLIENT}
-	}
+	sent, _, err := c.sendAt(msg, isText)
+	return sent, err
+}
 
+// sendAt 发送消息并返回写入前的纳秒时间戳, 时间戳在取得锁之后记录, 不含等待读协程的时间
+func (c *WebSocketClientLibcurl) sendAt(msg string, isText bool) (int, int64, error) {
 	cMsg := C.CString(msg)
 	defer C.free(unsafe.Pointer(cMsg))
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		return -1, 0, &WebSocketError{Code: WEBSOCKET_ERROR_INVALID_CLIENT}
+	}
+
+	sendTimeNs := time.Now().UnixNano()
 	sent := C.websocket_send_libcurl((*C.WebSocketClientLibcurl)(c.client),
 		cMsg, C.size_t(len(msg)), C.int(boolToInt(isText)))
 
 	if sent < 0 {
-		return int(sent), &WebSocketError{Code: int(sent)}
+		return int(sent), sendTimeNs, &WebSocketError{Code: int(sent)}
 	}
-	return int(sent), nil
+	return int(sent), sendTimeNs, nil
 }
 
 // Recv 接收WebSocket消息
 // 返回消息字符串、是否文本、错误
+// 连接断开或收到关闭帧时返回 WEBSOCKET_ERROR_NETWORK / WEBSOCKET_ERROR_CLOSED
 func (c *WebSocketClientLibcurl) Recv() (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.client == nil {
 		return "", false, &WebSocketError{Code: WEBSOCKET_ERROR_INVALID_CLIENT}
 	}
 
 	var outLen C.size_t
 	var outIsText C.int
+	var outError C.int
 
-	msg := C.websocket_recv_libcurl((*C.WebSocketClientLibcurl)(c.client), &outLen, &outIsText)
+	msg := C.websocket_recv_libcurl((*C.WebSocketClientLibcurl)(c.client), &outLen, &outIsText, &outError)
 	if msg == nil {
+		if outError != WEBSOCKET_OK {
+			return "", false, &WebSocketError{Code: int(outError)}
+		}
 		return "", false, nil // 暂无数据，不是错误
 	}
 	defer C.websocket_free_message_libcurl(msg)
@@ -17,7 +17,8 @@ typedef enum {
     WEBSOCKET_ERROR_NETWORK = -4,
     WEBSOCKET_ERROR_TIMEOUT = -5,
     WEBSOCKET_ERROR_MEMORY = -6,
-    WEBSOCKET_ERROR_BUFFER_OVERFLOW = -7
+    WEBSOCKET_ERROR_BUFFER_OVERFLOW = -7,
+    WEBSOCKET_ERROR_CLOSED = -8
 } WebSocketError;
 
 // WebSocket 缓冲区大小常量
@@ -29,9 +30,14 @@ typedef struct WebSocketClientLibcurl WebSocketClientLibcurl;
 
 // WebSocket 请求结果结构
 typedef struct {
-    int64_t latency_ns;     // 握手耗时 (纳秒)
-    int status_code;        // 连接返回的状态码 (101 表示成功)
-    char* error_message;    // 错误消息 (失败时有效)
+    int64_t latency_ns;       // 握手耗时 (纳秒)
+    int status_code;          // 连接返回的状态码 (101 表示成功)
+    char* error_message;      // 错误消息 (失败时有效)
+    int64_t dns_time_ns;      // DNS解析阶段耗时 (纳秒)
+    int64_t tcp_time_ns;      // TCP连接阶段耗时 (纳秒)
+    int64_t tls_time_ns;      // TLS握手阶段耗时 (纳秒, 非wss为0)
+    int64_t upgrade_time_ns;  // HTTP Upgrade阶段耗时 (纳秒)
+    char* response_headers;   // 升级响应头原文 (需要用 websocket_free_error_libcurl 释放)
 } WebSocketResultLibcurl;
 
 // 初始化/销毁
@@ -41,7 +47,10 @@ void websocket_client_destroy_libcurl(WebSocketClientLibcurl* client);
 void websocket_client_cleanup_libcurl();
 
 // 建立连接
-WebSocketResultLibcurl websocket_connect_libcurl(WebSocketClientLibcurl* client, const char* url, int timeout_ms);
+// headers 为以NULL结尾的自定义握手请求头数组, 可为NULL
+// resolve 为以NULL结尾的固定解析数组, 形如 "host:port:addr", 可为NULL
+WebSocketResultLibcurl websocket_connect_libcurl(WebSocketClientLibcurl* client, const char* url, int timeout_ms,
+                                                 const char** headers, const char** resolve);
 
 // 发送消息
 // is_text=1 表示文本消息, 0 表示二进制消息
@@ -50,7 +59,8 @@ int websocket_send_libcurl(WebSocketClientLibcurl* client, const char* msg, size
 // 接收消息
 // 返回堆分配的字符串, 需要用 websocket_free_message_libcurl 释放
 // out_len 返回消息长度, out_is_text=1 表示文本消息
-char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, int* out_is_text);
+// out_error 返回错误码, 返回NULL且错误码为 WEBSOCKET_OK 表示暂无数据
+char* websocket_recv_libcurl(WebSocketClientLibcurl* client, size_t* out_len, int* out_is_text, int* out_error);
 
 // 释放辅助函数
 void websocket_free_error_libcurl(char* ptr);
@@ -1,9 +1,13 @@
 package http_client
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // 测试新的客户端接口
@@ -217,6 +221,7 @@ func TestWebSocketErrorHandling(t *testing.T) {
 			{WEBSOCKET_ERROR_TIMEOUT, "timed out"},
 			{WEBSOCKET_ERROR_MEMORY, "Memory allocation"},
 			{WEBSOCKET_ERROR_BUFFER_OVERFLOW, "Buffer overflow"},
+			{WEBSOCKET_ERROR_CLOSED, "closed by peer"},
 			{-999, "Unknown WebSocket error"}, // 测试未知错误码
 		}
 
@@ -276,3 +281,135 @@ func TestWebSocketDynamicBuffer(t *testing.T) {
 			expectedInitialSize, expectedMaxSize)
 	})
 }
+
+// 本地WebSocket测试服务, handler处理升级后的连接
+func newLocalWsServer(t *testing.T, subprotocols []string, handler func(conn *websocket.Conn, r *http.Request)) (string, func()) {
+	upgrader := websocket.Upgrader{
+		Subprotocols: subprotocols,
+		CheckOrigin:  func(r *http.Request) bool { return true },
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, http.Header{"X-Test-Server": []string{"local"}})
+		if err != nil {
+			t.Logf("upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		handler(conn, r)
+	}))
+	return "ws" + strings.TrimPrefix(server.URL, "http"), server.Close
+}
+
+// 测试握手自定义请求头、子协议及耗时分解
+func TestWebSocketConnectWithOptions(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	reqHeaderChan := make(chan http.Header, 1)
+	url, closeServer := newLocalWsServer(t, []string{"v2.test", "v1.test"}, func(conn *websocket.Conn, r *http.Request) {
+		reqHeaderChan <- r.Header.Clone()
+		conn.ReadMessage()
+	})
+	defer closeServer()
+
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	res := client.ConnectWithOptions(url, 5000, WebSocketConnectOptions{
+		Headers:      []string{"X-Api-Key: test-key"},
+		Subprotocols: []string{"v1.test", "v2.test"},
+		Origin:       "https://example.com",
+	})
+	if res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+	if res.StatusCode != 101 {
+		t.Errorf("Expected status 101, got %d", res.StatusCode)
+	}
+	if res.Subprotocol != "v2.test" {
+		t.Errorf("Expected subprotocol v2.test, got %q", res.Subprotocol)
+	}
+	if res.ResponseHeaders.Get("X-Test-Server") != "local" {
+		t.Errorf("Expected response header X-Test-Server, got %v", res.ResponseHeaders)
+	}
+	if res.DNSTimeNs < 0 || res.TCPTimeNs < 0 || res.TLSTimeNs != 0 || res.UpgradeTimeNs <= 0 {
+		t.Errorf("Unexpected phase timing: %+v", res)
+	}
+	t.Logf("Phases: dns=%d tcp=%d tls=%d upgrade=%d total=%d",
+		res.DNSTimeNs, res.TCPTimeNs, res.TLSTimeNs, res.UpgradeTimeNs, res.LatencyNs)
+
+	select {
+	case reqHeader := <-reqHeaderChan:
+		if reqHeader.Get("X-Api-Key") != "test-key" {
+			t.Errorf("Expected X-Api-Key header, got %v", reqHeader)
+		}
+		if reqHeader.Get("Origin") != "https://example.com" {
+			t.Errorf("Expected Origin header, got %q", reqHeader.Get("Origin"))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not receive handshake")
+	}
+}
+
+// 测试升级被拒绝时返回真实状态码
+func TestWebSocketConnectRejected(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Reject-Reason", "forbidden")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	res := client.Connect("ws"+strings.TrimPrefix(server.URL, "http"), 5000)
+	if res.Error == "" {
+		t.Fatalf("Expected upgrade error, got none")
+	}
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", res.StatusCode)
+	}
+	if res.ResponseHeaders.Get("X-Reject-Reason") != "forbidden" {
+		t.Errorf("Expected reject header, got %v", res.ResponseHeaders)
+	}
+}
+
+// 测试握手固定解析到本地服务
+func TestWebSocketConnectResolve(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	serverUrl, closeServer := newLocalWsServer(t, nil, func(conn *websocket.Conn, r *http.Request) {
+		conn.ReadMessage()
+	})
+	defer closeServer()
+	port := serverUrl[strings.LastIndex(serverUrl, ":")+1:]
+
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	res := client.ConnectWithOptions("ws://pinned.invalid:"+port+"/", 5000, WebSocketConnectOptions{
+		Resolve: []string{"pinned.invalid:" + port + ":127.0.0.1"},
+	})
+	if res.Error != "" || res.StatusCode != 101 {
+		t.Fatalf("Expected pinned connect to succeed, got %+v", res)
+	}
+}
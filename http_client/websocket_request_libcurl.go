@@ -0,0 +1,217 @@
+package http_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// ErrWebSocketRequesterClosed 底层消息流已结束
+var ErrWebSocketRequesterClosed = errors.New("WebSocket requester closed")
+
+// ErrWebSocketRequestIdPending 同一id的请求仍在等待应答
+var ErrWebSocketRequestIdPending = errors.New("WebSocket request id already pending")
+
+// WebSocketIdExtractor 从消息中提取应答id, 非应答消息返回false
+type WebSocketIdExtractor func(msg string) (string, bool)
+
+// WebSocketReply 与请求关联的应答
+type WebSocketReply struct {
+	Id         string
+	Data       string
+	SendTimeNs int64 // 请求写入连接前的纳秒时间戳
+	RecvTimeNs int64 // 应答被读协程取到时的纳秒时间戳
+	RttNs      int64 // 应用层往返耗时
+}
+
+// WebSocketRequesterOptions 关联请求配置
+type WebSocketRequesterOptions struct {
+	Stream      WebSocketStreamOptions // 底层消息流配置
+	IdExtractor WebSocketIdExtractor   // 应答id提取方式, 默认取顶层"id"字段
+}
+
+// wsSender 可记录发送时刻的连接, 客户端与会话均满足
+type wsSender interface {
+	sendAt(msg string, isText bool) (int, int64, error)
+}
+
+type wsConn interface {
+	wsSender
+	wsReceiver
+}
+
+// WebSocketRequester 在已建立的连接上按id关联请求与应答
+// 未匹配到等待中请求的消息(行情推送、过期应答等)从Frames转出
+type WebSocketRequester struct {
+	sender  wsSender
+	stream  *WebSocketStream
+	extract WebSocketIdExtractor
+
+	mu      sync.Mutex
+	pending map[string]chan WebSocketReply
+	nextId  int64
+
+	frames  chan WebSocketFrame
+	dropped int64 // Frames写满或重复应答时丢弃的帧数
+}
+
+// NewRequester 基于客户端创建关联请求器, 内部启动读协程, 此后不应再直接调用Recv
+func (c *WebSocketClientLibcurl) NewRequester(ctx context.Context, opts WebSocketRequesterOptions) *WebSocketRequester {
+	return newWebSocketRequester(ctx, c, opts)
+}
+
+// NewRequester 基于会话创建关联请求器, 重连期间发出的请求在超时前不会收到应答
+func (s *WebSocketSessionLibcurl) NewRequester(ctx context.Context, opts WebSocketRequesterOptions) *WebSocketRequester {
+	return newWebSocketRequester(ctx, s, opts)
+}
+
+func newWebSocketRequester(ctx context.Context, conn wsConn, opts WebSocketRequesterOptions) *WebSocketRequester {
+	if opts.IdExtractor == nil {
+		opts.IdExtractor = DefaultWebSocketIdExtractor
+	}
+	stream := newWebSocketStream(ctx, conn, opts.Stream)
+	r := &WebSocketRequester{
+		sender:  conn,
+		stream:  stream,
+		extract: opts.IdExtractor,
+		pending: make(map[string]chan WebSocketReply),
+		frames:  make(chan WebSocketFrame, cap(stream.frames)),
+	}
+	go r.dispatch()
+	return r
+}
+
+// DefaultWebSocketIdExtractor 提取顶层"id"字段, 数字id转为十进制字符串
+// 适用于币安 {"result":null,"id":1}、币安ws-api及OKX带id的应答
+func DefaultWebSocketIdExtractor(msg string) (string, bool) {
+	if !strings.Contains(msg, `"id"`) {
+		return "", false
+	}
+	var reply struct {
+		Id interface{} `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(msg), &reply); err != nil {
+		return "", false
+	}
+	switch id := reply.Id.(type) {
+	case string:
+		return id, id != ""
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// NextId 生成连接内递增的请求id
+func (r *WebSocketRequester) NextId() int64 {
+	return atomic.AddInt64(&r.nextId, 1)
+}
+
+// Frames 未关联到请求的消息帧, 流结束时关闭
+func (r *WebSocketRequester) Frames() <-chan WebSocketFrame {
+	return r.frames
+}
+
+// Dropped 丢弃的帧数, 包括底层消息流丢弃、Frames写满丢弃及同一请求的重复应答
+func (r *WebSocketRequester) Dropped() int64 {
+	return r.stream.Dropped() + atomic.LoadInt64(&r.dropped)
+}
+
+// Done 底层消息流结束信号
+func (r *WebSocketRequester) Done() <-chan struct{} {
+	return r.stream.Done()
+}
+
+// Err 底层消息流结束原因
+func (r *WebSocketRequester) Err() error {
+	return r.stream.Err()
+}
+
+// Call 发送携带id的请求并等待对应应答, ctx控制等待超时
+// 同一id已有请求在等待时返回 ErrWebSocketRequestIdPending
+func (r *WebSocketRequester) Call(ctx context.Context, id string, request string) (WebSocketReply, error) {
+	replyChan := make(chan WebSocketReply, 1)
+	r.mu.Lock()
+	if _, exists := r.pending[id]; exists {
+		r.mu.Unlock()
+		return WebSocketReply{}, ErrWebSocketRequestIdPending
+	}
+	r.pending[id] = replyChan
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	_, sendTimeNs, err := r.sender.sendAt(request, true)
+	if err != nil {
+		return WebSocketReply{}, err
+	}
+
+	select {
+	case reply := <-replyChan:
+		reply.SendTimeNs = sendTimeNs
+		reply.RttNs = reply.RecvTimeNs - sendTimeNs
+		return reply, nil
+	case <-r.stream.Done():
+		return WebSocketReply{}, ErrWebSocketRequesterClosed
+	case <-ctx.Done():
+		return WebSocketReply{}, ctx.Err()
+	}
+}
+
+// CallJSON 序列化请求并发送, 请求中未设置"id"时自动分配递增id, 不修改传入的request
+func (r *WebSocketRequester) CallJSON(ctx context.Context, request map[string]interface{}) (WebSocketReply, error) {
+	id, ok := request["id"]
+	if !ok {
+		id = r.NextId()
+		withId := make(map[string]interface{}, len(request)+1)
+		for k, v := range request {
+			withId[k] = v
+		}
+		withId["id"] = id
+		request = withId
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return WebSocketReply{}, err
+	}
+	return r.Call(ctx, fmt.Sprint(id), string(data))
+}
+
+// dispatch 将应答投递给等待中的请求, 其余消息转出
+func (r *WebSocketRequester) dispatch() {
+	defer close(r.frames)
+	for frame := range r.stream.Frames() {
+		if id, ok := r.extract(frame.Data); ok {
+			r.mu.Lock()
+			replyChan, waiting := r.pending[id]
+			r.mu.Unlock()
+			if waiting {
+				select {
+				case replyChan <- WebSocketReply{Id: id, Data: frame.Data, RecvTimeNs: frame.RecvTimeNs}:
+				default:
+					//已有应答未被取走, 重复应答计为丢弃
+					atomic.AddInt64(&r.dropped, 1)
+				}
+				continue
+			}
+		}
+		select {
+		case r.frames <- frame:
+		default:
+			//无人消费时丢弃并计数, 避免阻塞应答投递
+			atomic.AddInt64(&r.dropped, 1)
+		}
+	}
+}
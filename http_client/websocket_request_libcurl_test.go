@@ -0,0 +1,178 @@
+package http_client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 测试按id关联请求与应答并计算往返耗时
+func TestWebSocketRequesterCall(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	//模拟币安: 先推送一条行情, 再延迟应答, 数字id原样返回
+	url, closeServer := newLocalWsServer(t, nil, func(conn *websocket.Conn, r *http.Request) {
+		for {
+			var req map[string]interface{}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"stream":"btcusdt@depth","data":{"E":1}}`))
+			time.Sleep(20 * time.Millisecond)
+			conn.WriteJSON(map[string]interface{}{"result": nil, "id": req["id"]})
+		}
+	})
+	defer closeServer()
+
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+	if res := client.Connect(url, 5000); res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requester := client.NewRequester(ctx, WebSocketRequesterOptions{})
+
+	request := map[string]interface{}{
+		"method": "SUBSCRIBE",
+		"params": []string{"btcusdt@depth"},
+	}
+	for i := 0; i < 3; i++ {
+		callCtx, callCancel := context.WithTimeout(ctx, 2*time.Second)
+		reply, err := requester.CallJSON(callCtx, request)
+		callCancel()
+		if err != nil {
+			t.Fatalf("Call %d failed: %v", i, err)
+		}
+		if reply.Id != fmt.Sprint(i+1) {
+			t.Errorf("Expected id %d, got %s", i+1, reply.Id)
+		}
+		if reply.RttNs < int64(20*time.Millisecond) || reply.RttNs > int64(time.Second) {
+			t.Errorf("Unexpected RTT %d ns", reply.RttNs)
+		}
+		t.Logf("Reply %s RTT %.3f ms", reply.Data, float64(reply.RttNs)/1e6)
+	}
+	if _, ok := request["id"]; ok {
+		t.Errorf("CallJSON should not modify caller's request, got %v", request)
+	}
+
+	select {
+	case frame := <-requester.Frames():
+		if frame.Data != `{"stream":"btcusdt@depth","data":{"E":1}}` {
+			t.Errorf("Unexpected unmatched frame: %s", frame.Data)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected unmatched stream frame")
+	}
+}
+
+// 测试等待应答超时
+func TestWebSocketRequesterTimeout(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	url, closeServer := newLocalWsServer(t, nil, func(conn *websocket.Conn, r *http.Request) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer closeServer()
+
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+	if res := client.Connect(url, 5000); res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+
+	requester := client.NewRequester(context.Background(), WebSocketRequesterOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	//同一id仍在等待时, 第二个请求直接返回错误, 不覆盖第一个请求
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := requester.Call(ctx, "abc", `{"id":"abc","op":"ping"}`)
+		firstErr <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		requester.mu.Lock()
+		_, pending := requester.pending["abc"]
+		requester.mu.Unlock()
+		if pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := requester.Call(context.Background(), "abc", `{"id":"abc","op":"ping"}`); err != ErrWebSocketRequestIdPending {
+		t.Errorf("Expected ErrWebSocketRequestIdPending, got %v", err)
+	}
+	if err := <-firstErr; err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+// 测试无人消费未关联消息时丢弃并计数
+func TestWebSocketRequesterDropped(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	client, cleanup := connectCountingServer(t, 20)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requester := client.NewRequester(ctx, WebSocketRequesterOptions{Stream: WebSocketStreamOptions{BufferSize: 3}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && requester.Dropped() < 17 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if requester.Dropped() != 17 {
+		t.Errorf("Expected 17 drops, got %d", requester.Dropped())
+	}
+	if frame := <-requester.Frames(); frame.Data != "0" {
+		t.Errorf("Expected first buffered frame 0, got %s", frame.Data)
+	}
+}
+
+// 测试默认id提取规则
+func TestDefaultWebSocketIdExtractor(t *testing.T) {
+	testCases := []struct {
+		msg string
+		id  string
+		ok  bool
+	}{
+		{`{"result":null,"id":1}`, "1", true},
+		{`{"id":"1512","event":"subscribe","arg":{"channel":"bbo-tbt"}}`, "1512", true},
+		{`{"id":"b3f1","status":200,"result":{"serverTime":1}}`, "b3f1", true},
+		{`{"stream":"btcusdt@depth","data":{"E":1}}`, "", false},
+		{`{"data":{"id":5}}`, "", false},
+		{`not json "id"`, "", false},
+	}
+	for _, tc := range testCases {
+		id, ok := DefaultWebSocketIdExtractor(tc.msg)
+		if id != tc.id || ok != tc.ok {
+			t.Errorf("Extract %s: expected (%q,%v), got (%q,%v)", tc.msg, tc.id, tc.ok, id, ok)
+		}
+	}
+}
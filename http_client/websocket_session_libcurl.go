@@ -0,0 +1,352 @@
+package http_client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WebSocketSessionEventType 连接生命周期事件类型
+type WebSocketSessionEventType string
+
+const (
+	WebSocketSessionEventConnected    WebSocketSessionEventType = "connected"    //连接建立
+	WebSocketSessionEventDropped      WebSocketSessionEventType = "dropped"      //连接断开
+	WebSocketSessionEventResubscribed WebSocketSessionEventType = "resubscribed" //订阅消息已重放
+	WebSocketSessionEventRotated      WebSocketSessionEventType = "rotated"      //连接到期主动轮换完成
+)
+
+// ErrWebSocketSessionClosed 会话已关闭
+var ErrWebSocketSessionClosed = errors.New("WebSocket session closed")
+
+// WebSocketSessionEvent 连接生命周期事件
+type WebSocketSessionEvent struct {
+	Type        WebSocketSessionEventType
+	TimestampNs int64                  // 事件发生时的纳秒时间戳
+	Attempt     int                    // 本次断线后的重连次数
+	Error       string                 // 断线或重连失败原因
+	Connect     WebSocketResultLibcurl // 建立连接时的握手结果
+}
+
+// WebSocketSessionConfig 会话配置
+type WebSocketSessionConfig struct {
+	Url            string
+	TimeoutMs      int
+	ConnectOptions WebSocketConnectOptions
+	MinBackoff     time.Duration // 重连初始等待, 默认500ms
+	MaxBackoff     time.Duration // 重连最大等待, 默认30s
+	IdleTimeout    time.Duration // 超过该时长未收到任何消息视为断线, 0表示不检测
+	MaxConnAge     time.Duration // 连接存活上限, 到期前主动轮换(如交易所24小时强制断开), 0表示不轮换
+	EventBuffer    int           // 事件通道缓冲大小, 默认100, 满时丢弃事件
+}
+
+// WebSocketSessionLibcurl 自动重连的WebSocket会话
+// 断线后按指数退避重连并重放已登记的订阅消息
+// 连接到期轮换时新旧连接短暂并存, 直到新连接收到首条消息才切换, 切换前后可能出现少量重复消息
+type WebSocketSessionLibcurl struct {
+	cfg WebSocketSessionConfig
+
+	mu            sync.Mutex
+	client        *WebSocketClientLibcurl
+	connectedAt   time.Time
+	lastRecvAt    time.Time
+	pending       *WebSocketClientLibcurl // 轮换中的新连接
+	subscriptions []string
+	attempt       int
+	backoff       time.Duration
+	closed        bool
+
+	events chan WebSocketSessionEvent
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewWebSocketSessionLibcurl 创建WebSocket会话, 需先调用 InitWebSocketLibcurl
+func NewWebSocketSessionLibcurl(cfg WebSocketSessionConfig) *WebSocketSessionLibcurl {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = 30 * time.Second
+		if cfg.MaxBackoff < cfg.MinBackoff {
+			cfg.MaxBackoff = cfg.MinBackoff
+		}
+	}
+	if cfg.EventBuffer <= 0 {
+		cfg.EventBuffer = 100
+	}
+	s := &WebSocketSessionLibcurl{
+		cfg:     cfg,
+		backoff: cfg.MinBackoff,
+		events:  make(chan WebSocketSessionEvent, cfg.EventBuffer),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// Events 连接生命周期事件通道
+func (s *WebSocketSessionLibcurl) Events() <-chan WebSocketSessionEvent {
+	return s.events
+}
+
+// Connect 首次建立连接, 失败时不重试, 后续Recv会按退避策略重连
+func (s *WebSocketSessionLibcurl) Connect() WebSocketResultLibcurl {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return WebSocketResultLibcurl{Error: ErrWebSocketSessionClosed.Error()}
+	}
+	client, res := s.dial()
+	if client == nil {
+		return res
+	}
+	s.swapClient(client)
+	s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventConnected, Connect: res})
+	return res
+}
+
+// Subscribe 登记订阅消息并在当前连接上发送, 重连后自动重放
+func (s *WebSocketSessionLibcurl) Subscribe(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions = append(s.subscriptions, msg)
+	if s.client == nil {
+		return nil
+	}
+	_, err := s.client.Send(msg, true)
+	return err
+}
+
+// Send 在当前连接上发送消息, 未连接时返回 WEBSOCKET_ERROR_INVALID_CLIENT
+func (s *WebSocketSessionLibcurl) Send(msg string, isText bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return -1, ErrWebSocketSessionClosed
+	}
+	if s.client == nil {
+		return -1, &WebSocketError{Code: WEBSOCKET_ERROR_INVALID_CLIENT}
+	}
+	return s.client.Send(msg, isText)
+}
+
+// sendAt 在当前连接上发送消息并返回写入前的纳秒时间戳
+func (s *WebSocketSessionLibcurl) sendAt(msg string, isText bool) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return -1, 0, ErrWebSocketSessionClosed
+	}
+	if s.client == nil {
+		return -1, 0, &WebSocketError{Code: WEBSOCKET_ERROR_INVALID_CLIENT}
+	}
+	return s.client.sendAt(msg, isText)
+}
+
+// Recv 接收消息, 与 WebSocketClientLibcurl.Recv 语义一致
+// 断线时在内部完成重连与订阅重放, 仅在会话关闭时返回错误
+func (s *WebSocketSessionLibcurl) Recv() (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return "", false, ErrWebSocketSessionClosed
+	}
+
+	if s.client == nil {
+		if !s.reconnect() {
+			return "", false, ErrWebSocketSessionClosed
+		}
+	}
+
+	// 连接到期, 建立新连接并重放订阅
+	if s.cfg.MaxConnAge > 0 && s.pending == nil && time.Since(s.connectedAt) >= s.cfg.MaxConnAge {
+		s.startRotate()
+	}
+
+	if s.pending != nil {
+		msg, isText, err := s.pending.Recv()
+		if err != nil {
+			s.pending.Close()
+			s.pending = nil
+		} else if msg != "" {
+			//新连接已有数据, 切换并关闭旧连接
+			s.swapClient(s.pending)
+			s.pending = nil
+			s.lastRecvAt = time.Now()
+			s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventRotated})
+			return msg, isText, nil
+		}
+	}
+
+	msg, isText, err := s.client.Recv()
+	if err != nil {
+		s.drop(err.Error())
+		return "", false, nil
+	}
+	if msg == "" {
+		if s.cfg.IdleTimeout > 0 && time.Since(s.lastRecvAt) >= s.cfg.IdleTimeout {
+			s.drop("idle timeout")
+		}
+		return "", false, nil
+	}
+	s.lastRecvAt = time.Now()
+	return msg, isText, nil
+}
+
+// Close 关闭会话及底层连接, 并关闭事件通道
+func (s *WebSocketSessionLibcurl) Close() {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+	if s.pending != nil {
+		s.pending.Close()
+		s.pending = nil
+	}
+}
+
+// dial 新建客户端并建立连接
+func (s *WebSocketSessionLibcurl) dial() (*WebSocketClientLibcurl, WebSocketResultLibcurl) {
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		return nil, WebSocketResultLibcurl{Error: err.Error()}
+	}
+	res := client.ConnectWithOptions(s.cfg.Url, s.cfg.TimeoutMs, s.cfg.ConnectOptions)
+	if res.Error != "" {
+		client.Close()
+		return nil, res
+	}
+	return client, res
+}
+
+// replay 在指定连接上重放全部订阅消息
+func (s *WebSocketSessionLibcurl) replay(client *WebSocketClientLibcurl) error {
+	for _, sub := range s.subscriptions {
+		if _, err := client.Send(sub, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swapClient 替换当前连接并关闭旧连接
+func (s *WebSocketSessionLibcurl) swapClient(client *WebSocketClientLibcurl) {
+	if s.client != nil {
+		s.client.Close()
+	}
+	s.client = client
+	s.connectedAt = time.Now()
+	s.lastRecvAt = s.connectedAt
+}
+
+// drop 关闭当前连接并记录断线事件
+func (s *WebSocketSessionLibcurl) drop(reason string) {
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+	s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventDropped, Error: reason})
+}
+
+// reconnect 按指数退避重连直到成功或会话关闭
+// 调用时需持有s.mu, 退避等待及建立连接期间释放锁, 期间Send等调用直接返回未连接错误而不阻塞
+func (s *WebSocketSessionLibcurl) reconnect() bool {
+	for {
+		backoff := time.Duration(0)
+		if s.attempt > 0 {
+			backoff = s.backoff
+			s.backoff *= 2
+			if s.backoff > s.cfg.MaxBackoff {
+				s.backoff = s.cfg.MaxBackoff
+			}
+		}
+		s.attempt++
+
+		s.mu.Unlock()
+		client, res := s.waitAndDial(backoff)
+		s.mu.Lock()
+		if s.ctx.Err() != nil {
+			if client != nil {
+				client.Close()
+			}
+			return false
+		}
+		if s.client != nil {
+			//释放锁期间已由Connect建立连接
+			if client != nil {
+				client.Close()
+			}
+			s.attempt = 0
+			s.backoff = s.cfg.MinBackoff
+			return true
+		}
+		if client == nil {
+			s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventDropped, Attempt: s.attempt, Error: res.Error})
+			continue
+		}
+		//订阅在持锁时重放, 包含等待期间新登记的订阅
+		if err := s.replay(client); err != nil {
+			client.Close()
+			s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventDropped, Attempt: s.attempt, Error: err.Error()})
+			continue
+		}
+		s.swapClient(client)
+		s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventConnected, Attempt: s.attempt, Connect: res})
+		if len(s.subscriptions) > 0 {
+			s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventResubscribed, Attempt: s.attempt})
+		}
+		s.attempt = 0
+		s.backoff = s.cfg.MinBackoff
+		return true
+	}
+}
+
+// waitAndDial 等待退避时长后建立连接, 不访问受s.mu保护的状态
+func (s *WebSocketSessionLibcurl) waitAndDial(backoff time.Duration) (*WebSocketClientLibcurl, WebSocketResultLibcurl) {
+	if backoff > 0 {
+		select {
+		case <-s.ctx.Done():
+			return nil, WebSocketResultLibcurl{Error: ErrWebSocketSessionClosed.Error()}
+		case <-time.After(backoff):
+		}
+	}
+	return s.dial()
+}
+
+// startRotate 建立轮换用的新连接, 失败时保留旧连接, 下次Recv重试
+func (s *WebSocketSessionLibcurl) startRotate() {
+	client, res := s.dial()
+	if client == nil {
+		//推迟下一次轮换尝试, 避免每次Recv都发起连接
+		s.connectedAt = s.connectedAt.Add(s.cfg.MinBackoff)
+		return
+	}
+	if err := s.replay(client); err != nil {
+		client.Close()
+		s.connectedAt = s.connectedAt.Add(s.cfg.MinBackoff)
+		return
+	}
+	s.pending = client
+	s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventConnected, Connect: res})
+	if len(s.subscriptions) > 0 {
+		s.emit(WebSocketSessionEvent{Type: WebSocketSessionEventResubscribed})
+	}
+}
+
+// emit 非阻塞发送事件, 通道满时丢弃
+func (s *WebSocketSessionLibcurl) emit(event WebSocketSessionEvent) {
+	event.TimestampNs = time.Now().UnixNano()
+	select {
+	case s.events <- event:
+	default:
+	}
+}
@@ -0,0 +1,247 @@
+package http_client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 收集会话事件直到出现指定类型或超时
+func waitSessionEvent(t *testing.T, session *WebSocketSessionLibcurl, eventType WebSocketSessionEventType, seen *[]WebSocketSessionEventType) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-session.Events():
+			*seen = append(*seen, event.Type)
+			if event.TimestampNs <= 0 {
+				t.Errorf("Event without timestamp: %+v", event)
+			}
+			if event.Type == eventType {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s, seen %v", eventType, *seen)
+		}
+	}
+}
+
+// 测试断线重连与订阅重放
+func TestWebSocketSessionReconnect(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	var connCount int64
+	url, closeServer := newLocalWsServer(t, nil, func(conn *websocket.Conn, r *http.Request) {
+		n := atomic.AddInt64(&connCount, 1)
+		_, sub, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		for i := 0; i < 3; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%s-%d-%d", sub, n, i)))
+		}
+		if n == 1 {
+			//第一个连接发送完即断开，模拟交易所断线
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "bye"))
+			return
+		}
+		conn.ReadMessage()
+	})
+	defer closeServer()
+
+	session := NewWebSocketSessionLibcurl(WebSocketSessionConfig{
+		Url:        url,
+		TimeoutMs:  5000,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
+	})
+	defer session.Close()
+
+	res := session.Connect()
+	if res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+	if err := session.Subscribe("sub"); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	received := map[string]bool{}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(received) < 6 && time.Now().Before(deadline) {
+		msg, _, err := session.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if msg != "" {
+			received[msg] = true
+		}
+	}
+	for _, want := range []string{"sub-1-2", "sub-2-0", "sub-2-2"} {
+		if !received[want] {
+			t.Errorf("Expected message %s, got %v", want, received)
+		}
+	}
+
+	var seen []WebSocketSessionEventType
+	waitSessionEvent(t, session, WebSocketSessionEventResubscribed, &seen)
+	expected := []WebSocketSessionEventType{
+		WebSocketSessionEventConnected,
+		WebSocketSessionEventDropped,
+		WebSocketSessionEventConnected,
+		WebSocketSessionEventResubscribed,
+	}
+	if fmt.Sprint(seen) != fmt.Sprint(expected) {
+		t.Errorf("Expected events %v, got %v", expected, seen)
+	}
+
+	session.Close()
+	if _, _, err := session.Recv(); err != ErrWebSocketSessionClosed {
+		t.Errorf("Expected ErrWebSocketSessionClosed after Close, got %v", err)
+	}
+}
+
+// 测试连接到期轮换时数据流不中断
+func TestWebSocketSessionRotate(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	var seq int64
+	url, closeServer := newLocalWsServer(t, nil, func(conn *websocket.Conn, r *http.Request) {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for {
+			msg := fmt.Sprintf("%d", atomic.AddInt64(&seq, 1))
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+	defer closeServer()
+
+	session := NewWebSocketSessionLibcurl(WebSocketSessionConfig{
+		Url:        url,
+		TimeoutMs:  5000,
+		MaxConnAge: 200 * time.Millisecond,
+	})
+	defer session.Close()
+
+	if res := session.Connect(); res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+	session.Subscribe("sub")
+
+	var seen []WebSocketSessionEventType
+	var lastRecv time.Time
+	var maxGap time.Duration
+	deadline := time.Now().Add(3 * time.Second)
+	rotated := false
+	for time.Now().Before(deadline) && !rotated {
+		msg, _, err := session.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if msg != "" {
+			if !lastRecv.IsZero() && time.Since(lastRecv) > maxGap {
+				maxGap = time.Since(lastRecv)
+			}
+			lastRecv = time.Now()
+		}
+		select {
+		case event := <-session.Events():
+			seen = append(seen, event.Type)
+			if event.Type == WebSocketSessionEventDropped {
+				t.Errorf("Unexpected drop during rotation: %+v", event)
+			}
+			rotated = event.Type == WebSocketSessionEventRotated
+		default:
+		}
+	}
+	if !rotated {
+		t.Fatalf("Expected rotation, seen %v", seen)
+	}
+	t.Logf("Events %v, max gap between messages %v", seen, maxGap)
+}
+
+// 测试退避等待期间Send立即返回未连接错误, 不阻塞到重连完成
+func TestWebSocketSessionSendDuringBackoff(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	var connCount int64
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&connCount, 1) > 1 {
+			//只接受第一个连接, 之后的重连均失败
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "bye"))
+	}))
+	defer server.Close()
+
+	session := NewWebSocketSessionLibcurl(WebSocketSessionConfig{
+		Url:        "ws" + strings.TrimPrefix(server.URL, "http"),
+		TimeoutMs:  5000,
+		MinBackoff: 5 * time.Second,
+	})
+	defer session.Close()
+	if res := session.Connect(); res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+
+	recvDone := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := session.Recv(); err != nil {
+				recvDone <- err
+				return
+			}
+		}
+	}()
+
+	//首次重连立即失败, 之后进入5秒退避
+	var seen []WebSocketSessionEventType
+	for {
+		waitSessionEvent(t, session, WebSocketSessionEventDropped, &seen)
+		if atomic.LoadInt64(&connCount) > 1 {
+			break
+		}
+	}
+	start := time.Now()
+	_, err := session.Send("ping", true)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Send blocked %v during backoff", elapsed)
+	}
+	if wsErr, ok := err.(*WebSocketError); !ok || wsErr.Code != WEBSOCKET_ERROR_INVALID_CLIENT {
+		t.Errorf("Expected WEBSOCKET_ERROR_INVALID_CLIENT, got %v", err)
+	}
+
+	session.Close()
+	select {
+	case err := <-recvDone:
+		if err != ErrWebSocketSessionClosed {
+			t.Errorf("Expected ErrWebSocketSessionClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Recv not interrupted by Close during backoff")
+	}
+}
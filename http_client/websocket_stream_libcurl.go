@@ -0,0 +1,147 @@
+package http_client
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocketOverflowPolicy 帧通道写满时的处理策略
+type WebSocketOverflowPolicy int
+
+const (
+	WebSocketOverflowBlock      WebSocketOverflowPolicy = iota // 阻塞读协程直到消费者取走数据
+	WebSocketOverflowDropOldest                                // 丢弃通道中最旧的帧并计数
+	WebSocketOverflowDropNewest                                // 丢弃新到达的帧并计数
+)
+
+// WebSocketFrame 带本地接收时间戳的消息帧
+type WebSocketFrame struct {
+	Data       string
+	IsText     bool
+	RecvTimeNs int64 // 读协程取到消息时的纳秒时间戳
+}
+
+// WebSocketStreamOptions 流式接收配置
+type WebSocketStreamOptions struct {
+	BufferSize int                     // 帧通道缓冲大小, 默认1024
+	Overflow   WebSocketOverflowPolicy // 通道写满时的处理策略
+}
+
+// WebSocketStream 由独立读协程驱动的消息流
+type WebSocketStream struct {
+	frames  chan WebSocketFrame
+	dropped int64
+	err     error
+	done    chan struct{}
+}
+
+// wsReceiver 可被流式读取的连接, 客户端与会话均满足
+type wsReceiver interface {
+	Recv() (string, bool, error)
+}
+
+// Stream 启动读协程, 将收到的消息帧写入通道
+// ctx取消或连接出错时通道关闭, 之后可通过Err获取原因
+func (c *WebSocketClientLibcurl) Stream(ctx context.Context, opts WebSocketStreamOptions) *WebSocketStream {
+	return newWebSocketStream(ctx, c, opts)
+}
+
+// Stream 启动读协程, 断线重连由会话内部完成, 仅在ctx取消或会话关闭时结束
+func (s *WebSocketSessionLibcurl) Stream(ctx context.Context, opts WebSocketStreamOptions) *WebSocketStream {
+	return newWebSocketStream(ctx, s, opts)
+}
+
+func newWebSocketStream(ctx context.Context, receiver wsReceiver, opts WebSocketStreamOptions) *WebSocketStream {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1024
+	}
+	stream := &WebSocketStream{
+		frames: make(chan WebSocketFrame, opts.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go stream.run(ctx, receiver, opts.Overflow)
+	return stream
+}
+
+// Frames 消息帧通道, 流结束时关闭
+func (s *WebSocketStream) Frames() <-chan WebSocketFrame {
+	return s.frames
+}
+
+// Dropped 因通道写满被丢弃的帧数
+func (s *WebSocketStream) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Done 流结束信号
+func (s *WebSocketStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 流结束原因, ctx取消时为ctx.Err(), 需在Done之后读取
+func (s *WebSocketStream) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+func (s *WebSocketStream) run(ctx context.Context, receiver wsReceiver, overflow WebSocketOverflowPolicy) {
+	defer close(s.done)
+	defer close(s.frames)
+	for {
+		if err := ctx.Err(); err != nil {
+			s.err = err
+			return
+		}
+		msg, isText, err := receiver.Recv()
+		if err != nil {
+			s.err = err
+			return
+		}
+		if msg == "" {
+			continue
+		}
+		frame := WebSocketFrame{Data: msg, IsText: isText, RecvTimeNs: time.Now().UnixNano()}
+		if !s.push(ctx, frame, overflow) {
+			s.err = ctx.Err()
+			return
+		}
+	}
+}
+
+// push 按溢出策略写入帧, ctx取消时返回false
+func (s *WebSocketStream) push(ctx context.Context, frame WebSocketFrame, overflow WebSocketOverflowPolicy) bool {
+	switch overflow {
+	case WebSocketOverflowDropOldest:
+		for {
+			select {
+			case s.frames <- frame:
+				return true
+			default:
+			}
+			select {
+			case <-s.frames:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	case WebSocketOverflowDropNewest:
+		select {
+		case s.frames <- frame:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+		return true
+	default:
+		select {
+		case s.frames <- frame:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
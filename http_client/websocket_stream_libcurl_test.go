@@ -0,0 +1,160 @@
+package http_client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 连接到按序发送count条消息的本地服务
+func connectCountingServer(t *testing.T, count int) (*WebSocketClientLibcurl, func()) {
+	url, closeServer := newLocalWsServer(t, nil, func(conn *websocket.Conn, r *http.Request) {
+		for i := 0; i < count; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d", i)))
+		}
+		conn.ReadMessage()
+	})
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if res := client.Connect(url, 5000); res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+	return client, func() {
+		client.Close()
+		closeServer()
+	}
+}
+
+// 等待读协程把服务端消息全部读入通道
+func waitStreamIdle(stream *WebSocketStream, want int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(stream.frames)+int(stream.Dropped()) < want {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 测试阻塞策略下按序收到全部消息及接收时间戳
+func TestWebSocketStreamBlock(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	client, cleanup := connectCountingServer(t, 50)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := client.Stream(ctx, WebSocketStreamOptions{BufferSize: 4})
+
+	start := time.Now().UnixNano()
+	for i := 0; i < 50; i++ {
+		select {
+		case frame := <-stream.Frames():
+			if frame.Data != fmt.Sprintf("%d", i) {
+				t.Fatalf("Expected frame %d, got %s", i, frame.Data)
+			}
+			if !frame.IsText || frame.RecvTimeNs < start {
+				t.Errorf("Unexpected frame metadata: %+v", frame)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out at frame %d", i)
+		}
+	}
+	if stream.Dropped() != 0 {
+		t.Errorf("Expected no drops, got %d", stream.Dropped())
+	}
+
+	cancel()
+	<-stream.Done()
+	if stream.Err() != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", stream.Err())
+	}
+	for range stream.Frames() {
+	}
+}
+
+// 测试丢弃策略
+func TestWebSocketStreamOverflow(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	testCases := []struct {
+		name   string
+		policy WebSocketOverflowPolicy
+		first  string
+	}{
+		{"drop oldest", WebSocketOverflowDropOldest, "17"},
+		{"drop newest", WebSocketOverflowDropNewest, "0"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, cleanup := connectCountingServer(t, 20)
+			defer cleanup()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := client.Stream(ctx, WebSocketStreamOptions{BufferSize: 3, Overflow: tc.policy})
+			waitStreamIdle(stream, 20)
+
+			if stream.Dropped() != 17 {
+				t.Errorf("Expected 17 drops, got %d", stream.Dropped())
+			}
+			frame := <-stream.Frames()
+			if frame.Data != tc.first {
+				t.Errorf("Expected first buffered frame %s, got %s", tc.first, frame.Data)
+			}
+		})
+	}
+}
+
+// 测试连接断开时流结束并返回错误
+func TestWebSocketStreamClosedByPeer(t *testing.T) {
+	if err := InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer CleanupWebSocketLibcurl()
+
+	url, closeServer := newLocalWsServer(t, nil, func(conn *websocket.Conn, r *http.Request) {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, append([]byte("echo:"), msg...))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	})
+	defer closeServer()
+
+	client, err := NewWebSocketClientLibcurl()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+	if res := client.Connect(url, 5000); res.Error != "" {
+		t.Fatalf("Connect failed: %s", res.Error)
+	}
+
+	stream := client.Stream(context.Background(), WebSocketStreamOptions{})
+	//读协程运行期间并发发送
+	if _, err := client.Send("ping", true); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	var frames []string
+	for frame := range stream.Frames() {
+		frames = append(frames, frame.Data)
+	}
+	if len(frames) != 1 || frames[0] != "echo:ping" {
+		t.Errorf("Expected echo frame, got %v", frames)
+	}
+	if wsErr, ok := stream.Err().(*WebSocketError); !ok || wsErr.Code != WEBSOCKET_ERROR_CLOSED {
+		t.Errorf("Expected WEBSOCKET_ERROR_CLOSED, got %v", stream.Err())
+	}
+}
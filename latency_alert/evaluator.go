@@ -0,0 +1,344 @@
+package latency_alert
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+
+	defaultBaseline = time.Hour
+)
+
+// 告警通知, 以JSON发送到webhook
+type Notification struct {
+	Status    string  `json:"status"`
+	Rule      string  `json:"rule"`
+	Severity  string  `json:"severity"`
+	Node      string  `json:"node"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold,omitempty"`
+	Baseline  float64 `json:"baseline,omitempty"`
+	StartsAt  string  `json:"starts_at"`
+	EndsAt    string  `json:"ends_at,omitempty"`
+	Message   string  `json:"message"`
+}
+
+// 通知发送
+type Notifier interface {
+	Notify(n Notification)
+}
+
+// 当前告警
+type Alert struct {
+	Rule      string
+	Severity  string
+	Node      string
+	Metric    string
+	Value     float64
+	Baseline  float64 `json:",omitempty"`
+	PendingNs int64   //条件开始满足的时间
+	Firing    bool    //是否已达到持续时长
+	FiringNs  int64   `json:",omitempty"` //触发时间
+	Notified  bool    //是否已发送触发通知
+	Silenced  bool
+}
+
+type alertKey struct {
+	rule   string
+	node   string
+	metric string
+}
+
+type sample struct {
+	timeNs int64
+	value  float64
+}
+
+// 单条规则下单个序列的状态
+type alertState struct {
+	samples    []sample //基线窗口内的历史值
+	lastSeenNs int64    //本地最近收到的时间, 用于判断停止更新
+	value      float64
+	baseline   float64
+	pending    bool //条件是否满足中
+	pendingNs  int64
+	firing     bool //是否已达到持续时长
+	firingNs   int64
+	notified   bool
+}
+
+// 按规则评估每次更新, 触发及恢复时通知, 同一告警持续期间只通知一次
+type Evaluator struct {
+	rules    []Rule
+	notifier Notifier
+	now      func() int64
+
+	mu       sync.Mutex
+	states   map[alertKey]*alertState
+	silences []Silence
+}
+
+func NewEvaluator(rules []Rule, silences []Silence, notifier Notifier) *Evaluator {
+	for i := range rules {
+		if rules[i].ChangePercent != 0 && rules[i].Baseline <= 0 {
+			rules[i].Baseline = defaultBaseline
+		}
+	}
+	return &Evaluator{
+		rules:    rules,
+		notifier: notifier,
+		now:      func() int64 { return time.Now().UnixNano() },
+		states:   make(map[alertKey]*alertState),
+		silences: silences,
+	}
+}
+
+func (e *Evaluator) Rules() []Rule {
+	return e.rules
+}
+
+// 评估一个数据点
+func (e *Evaluator) Observe(node string, metric string, timeNs int64, value float64) {
+	var notifications []Notification
+	e.mu.Lock()
+	nowNs := e.now()
+	for _, rule := range e.rules {
+		if !rule.matches(node, metric) {
+			continue
+		}
+		key := alertKey{rule: rule.Name, node: node, metric: metric}
+		state, ok := e.states[key]
+		if !ok {
+			state = &alertState{}
+			e.states[key] = state
+		}
+		state.lastSeenNs = nowNs
+		state.value = value
+		if rule.Absent {
+			//重新收到数据即恢复
+			notifications = e.transition(rule, key, state, false, nowNs, nowNs, notifications)
+			continue
+		}
+
+		//基线取条件持续时长之前的历史均值, 避免被正在异常的数据拉高
+		baseline, hasBaseline := state.baselineBefore(timeNs-int64(rule.Duration), timeNs-int64(rule.Duration)-int64(rule.Baseline))
+		state.baseline = baseline
+		breached := rule.breached(value, baseline, hasBaseline)
+		if rule.ChangePercent != 0 {
+			state.samples = append(state.samples, sample{timeNs: timeNs, value: value})
+			state.trim(timeNs - int64(rule.Duration) - int64(rule.Baseline))
+		}
+		if breached && !state.pending {
+			state.pending, state.pendingNs = true, timeNs
+		}
+		notifications = e.transition(rule, key, state, breached, timeNs, nowNs, notifications)
+	}
+	e.mu.Unlock()
+	e.send(notifications)
+}
+
+// 检查Absent规则下停止更新的序列, 及静默到期后需补发的通知, 需定时调用
+func (e *Evaluator) Check() {
+	var notifications []Notification
+	e.mu.Lock()
+	nowNs := e.now()
+	for _, rule := range e.rules {
+		for key, state := range e.states {
+			if key.rule != rule.Name {
+				continue
+			}
+			if rule.Absent {
+				silent := nowNs-state.lastSeenNs >= int64(rule.Duration)
+				if silent && !state.pending {
+					state.pending, state.pendingNs = true, state.lastSeenNs
+				}
+				notifications = e.transition(rule, key, state, silent, nowNs, nowNs, notifications)
+			} else if state.firing && !state.notified {
+				notifications = e.transition(rule, key, state, true, state.firingNs, nowNs, notifications)
+			}
+		}
+	}
+	e.mu.Unlock()
+	e.send(notifications)
+}
+
+// 更新告警状态, 返回追加的通知
+// timeNs为数据时间, 用于判断持续时长; nowNs为本地时间, 用于判断静默
+func (e *Evaluator) transition(rule Rule, key alertKey, state *alertState, breached bool, timeNs int64, nowNs int64, notifications []Notification) []Notification {
+	if !breached {
+		if state.firing && state.notified {
+			n := e.notification(rule, key, state, StatusResolved)
+			n.EndsAt = formatTime(timeNs)
+			notifications = append(notifications, n)
+		}
+		state.pending, state.firing, state.notified = false, false, false
+		return notifications
+	}
+	if !state.firing && timeNs-state.pendingNs >= int64(rule.Duration) {
+		state.firing, state.firingNs = true, timeNs
+	}
+	if state.firing && !state.notified && !e.silenced(rule.Name, key.node, nowNs) {
+		state.notified = true
+		notifications = append(notifications, e.notification(rule, key, state, StatusFiring))
+	}
+	return notifications
+}
+
+func (e *Evaluator) notification(rule Rule, key alertKey, state *alertState, status string) Notification {
+	n := Notification{
+		Status:    status,
+		Rule:      rule.Name,
+		Severity:  rule.Severity,
+		Node:      key.node,
+		Metric:    key.metric,
+		Value:     state.value,
+		Threshold: rule.Threshold,
+		Baseline:  state.baseline,
+		StartsAt:  formatTime(state.pendingNs),
+	}
+	switch {
+	case rule.Absent:
+		n.Message = fmt.Sprintf("节点[%s]指标%s超过%v未更新", key.node, key.metric, rule.Duration)
+	case status == StatusResolved:
+		n.Message = fmt.Sprintf("节点[%s]指标%s已恢复: %.6g", key.node, key.metric, state.value)
+	case rule.ChangePercent != 0 && state.baseline > 0:
+		n.Message = fmt.Sprintf("节点[%s]指标%s为%.6g, 基线%.6g, 变化%.1f%%", key.node, key.metric,
+			state.value, state.baseline, (state.value/state.baseline-1)*100)
+	default:
+		n.Message = fmt.Sprintf("节点[%s]指标%s为%.6g, 阈值%.6g", key.node, key.metric, state.value, rule.Threshold)
+	}
+	return n
+}
+
+func (e *Evaluator) send(notifications []Notification) {
+	if e.notifier == nil {
+		return
+	}
+	for _, n := range notifications {
+		e.notifier.Notify(n)
+	}
+}
+
+func (e *Evaluator) silenced(rule string, node string, nowNs int64) bool {
+	for _, s := range e.silences {
+		if s.matches(rule, node, nowNs) {
+			return true
+		}
+	}
+	return false
+}
+
+// 添加静默, 同名静默覆盖
+func (e *Evaluator) AddSilence(s Silence) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.silences {
+		if e.silences[i].Name == s.Name {
+			e.silences[i] = s
+			return
+		}
+	}
+	e.silences = append(e.silences, s)
+}
+
+// 按名称删除静默, 被静默的触发中告警在下次检查时通知; 不存在时返回false
+func (e *Evaluator) RemoveSilence(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.silences {
+		if e.silences[i].Name == name {
+			e.silences = append(e.silences[:i], e.silences[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// 未到期的静默
+func (e *Evaluator) Silences() []Silence {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	nowNs := e.now()
+	silences := make([]Silence, 0, len(e.silences))
+	for _, s := range e.silences {
+		if nowNs < s.UntilNs {
+			silences = append(silences, s)
+		}
+	}
+	return silences
+}
+
+// 条件满足中(含未达持续时长)的告警, 按规则、节点及指标排序
+func (e *Evaluator) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	nowNs := e.now()
+	severity := make(map[string]string, len(e.rules))
+	for _, rule := range e.rules {
+		severity[rule.Name] = rule.Severity
+	}
+	var alerts []Alert
+	for key, state := range e.states {
+		if !state.pending {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			Rule:      key.rule,
+			Severity:  severity[key.rule],
+			Node:      key.node,
+			Metric:    key.metric,
+			Value:     state.value,
+			Baseline:  state.baseline,
+			PendingNs: state.pendingNs,
+			Firing:    state.firing,
+			FiringNs:  state.firingNs,
+			Notified:  state.notified,
+			Silenced:  e.silenced(key.rule, key.node, nowNs),
+		})
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		return a.Metric < b.Metric
+	})
+	return alerts
+}
+
+// [fromNs, toNs) 内历史值的均值
+func (s *alertState) baselineBefore(toNs int64, fromNs int64) (float64, bool) {
+	var sum float64
+	count := 0
+	for _, p := range s.samples {
+		if p.timeNs >= fromNs && p.timeNs < toNs {
+			sum += p.value
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+func (s *alertState) trim(fromNs int64) {
+	i := 0
+	for i < len(s.samples) && s.samples[i].timeNs < fromNs {
+		i++
+	}
+	s.samples = s.samples[i:]
+}
+
+func formatTime(timeNs int64) string {
+	return time.Unix(0, timeNs).UTC().Format(time.RFC3339Nano)
+}
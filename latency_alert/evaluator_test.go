@@ -0,0 +1,201 @@
+package latency_alert
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	notifications []Notification
+}
+
+func (r *recordingNotifier) Notify(n Notification) {
+	r.notifications = append(r.notifications, n)
+}
+
+func (r *recordingNotifier) take() []Notification {
+	notifications := r.notifications
+	r.notifications = nil
+	return notifications
+}
+
+func newTestEvaluator(rules []Rule, silences []Silence) (*Evaluator, *recordingNotifier, *int64) {
+	notifier := &recordingNotifier{}
+	e := NewEvaluator(rules, silences, notifier)
+	nowNs := int64(0)
+	e.now = func() int64 { return nowNs }
+	return e, notifier, &nowNs
+}
+
+// 阈值需持续满足duration才触发, 持续期间只通知一次, 恢复时发送resolved
+func TestEvaluatorThreshold(t *testing.T) {
+	second := int64(time.Second)
+	e, notifier, _ := newTestEvaluator([]Rule{{Name: "slow", Metric: "binance.ws.*", Nodes: []string{"10.0.0.*"},
+		Threshold: 50, Duration: 20 * time.Second, Severity: "warning"}}, nil)
+
+	e.Observe("10.0.0.1:9000", "binance.ws.future", 0, 80)
+	e.Observe("10.0.0.1:9000", "binance.ws.future", 10*second, 90)
+	e.Observe("192.168.0.1:9000", "binance.ws.future", 10*second, 500) //节点不匹配
+	e.Observe("10.0.0.1:9000", "okx.ws.public", 10*second, 500)        //指标不匹配
+	if n := notifier.take(); len(n) != 0 {
+		t.Fatalf("Expected no notification before duration, got %+v", n)
+	}
+	if alerts := e.Alerts(); len(alerts) != 1 || alerts[0].Firing {
+		t.Errorf("Expected one pending alert, got %+v", alerts)
+	}
+
+	e.Observe("10.0.0.1:9000", "binance.ws.future", 20*second, 100)
+	e.Observe("10.0.0.1:9000", "binance.ws.future", 30*second, 100)
+	fired := notifier.take()
+	if len(fired) != 1 || fired[0].Status != StatusFiring || fired[0].Severity != "warning" || fired[0].Value != 100 || fired[0].StartsAt != formatTime(0) {
+		t.Fatalf("Expected one firing notification, got %+v", fired)
+	}
+
+	//中途回落重新计时
+	e.Observe("10.0.0.1:9000", "binance.ws.future", 40*second, 10)
+	if resolved := notifier.take(); len(resolved) != 1 || resolved[0].Status != StatusResolved || resolved[0].EndsAt != formatTime(40*second) {
+		t.Fatalf("Expected one resolved notification, got %+v", resolved)
+	}
+	e.Observe("10.0.0.1:9000", "binance.ws.future", 50*second, 10)
+	if n := notifier.take(); len(n) != 0 || len(e.Alerts()) != 0 {
+		t.Errorf("Expected no more notifications, got %+v", n)
+	}
+}
+
+// 相对基线翻倍时触发, 基线不包含持续时长内的数据
+func TestEvaluatorChangePercent(t *testing.T) {
+	minute := int64(time.Minute)
+	e, notifier, _ := newTestEvaluator([]Rule{{Name: "doubled", Metric: "binance.ws.future", ChangePercent: 100,
+		Baseline: 10 * time.Minute, Duration: 2 * time.Minute, Severity: "critical"}}, nil)
+
+	for i := int64(0); i < 10; i++ {
+		e.Observe("a", "binance.ws.future", i*minute, 10)
+	}
+	for i := int64(10); i <= 12; i++ {
+		e.Observe("a", "binance.ws.future", i*minute, 25)
+	}
+	fired := notifier.take()
+	if len(fired) != 1 || fired[0].Baseline != 10 || fired[0].Value != 25 || fired[0].StartsAt != formatTime(10*minute) {
+		t.Fatalf("Expected firing against baseline 10, got %+v", fired)
+	}
+}
+
+// 停止更新超过duration触发, 重新收到数据恢复
+func TestEvaluatorAbsent(t *testing.T) {
+	second := int64(time.Second)
+	e, notifier, nowNs := newTestEvaluator([]Rule{{Name: "silent", Metric: "node_latency", Absent: true, Duration: time.Minute}}, nil)
+
+	e.Observe("b", "node_latency", 0, 1)
+	*nowNs = 30 * second
+	e.Check()
+	if n := notifier.take(); len(n) != 0 {
+		t.Fatalf("Expected no notification, got %+v", n)
+	}
+	*nowNs = 90 * second
+	e.Check()
+	e.Check()
+	fired := notifier.take()
+	if len(fired) != 1 || fired[0].Node != "b" || fired[0].StartsAt != formatTime(0) {
+		t.Fatalf("Expected one firing notification, got %+v", fired)
+	}
+	*nowNs = 100 * second
+	e.Observe("b", "node_latency", 100*second, 1)
+	if resolved := notifier.take(); len(resolved) != 1 || resolved[0].Status != StatusResolved {
+		t.Fatalf("Expected resolved notification, got %+v", resolved)
+	}
+}
+
+// 静默期间不通知, 到期后仍在触发的告警补发
+func TestEvaluatorSilence(t *testing.T) {
+	second := int64(time.Second)
+	e, notifier, nowNs := newTestEvaluator([]Rule{{Name: "slow", Metric: "m", Threshold: 50}},
+		[]Silence{{Name: "maintenance", Rule: "slow", Node: "a", UntilNs: 60 * second}})
+
+	e.Observe("a", "m", 0, 100)
+	e.Observe("b", "m", 0, 100)
+	if fired := notifier.take(); len(fired) != 1 || fired[0].Node != "b" {
+		t.Fatalf("Expected only unsilenced node notified, got %+v", fired)
+	}
+	if alerts := e.Alerts(); len(alerts) != 2 || !alerts[0].Silenced || alerts[0].Notified {
+		t.Errorf("Unexpected alerts %+v", alerts)
+	}
+
+	*nowNs = 70 * second
+	if len(e.Silences()) != 0 {
+		t.Errorf("Expected expired silence hidden")
+	}
+	e.Check()
+	if fired := notifier.take(); len(fired) != 1 || fired[0].Node != "a" {
+		t.Fatalf("Expected notification after silence expired, got %+v", fired)
+	}
+
+	//静默期间恢复的告警不发送resolved
+	e.AddSilence(Silence{Name: "again", Node: "b", UntilNs: 200 * second})
+	e.Observe("c", "m", 70*second, 100)
+	e.AddSilence(Silence{Name: "again", Node: "c", UntilNs: 200 * second})
+	e.Observe("c", "m", 80*second, 10)
+	if n := notifier.take(); len(n) != 2 || n[0].Status != StatusFiring || n[1].Status != StatusResolved {
+		t.Errorf("Expected firing then resolved for notified alert, got %+v", n)
+	}
+}
+
+// 删除静默后仍在触发的告警在下次检查时通知
+func TestEvaluatorRemoveSilence(t *testing.T) {
+	second := int64(time.Second)
+	e, notifier, _ := newTestEvaluator([]Rule{{Name: "slow", Metric: "m", Threshold: 50}},
+		[]Silence{{Name: "maintenance", Rule: "slow", Node: "a", UntilNs: 60 * second}})
+
+	e.Observe("a", "m", 0, 100)
+	if fired := notifier.take(); len(fired) != 0 {
+		t.Fatalf("Expected silenced alert not notified, got %+v", fired)
+	}
+	if e.RemoveSilence("unknown") || !e.RemoveSilence("maintenance") || len(e.Silences()) != 0 {
+		t.Fatalf("Expected only existing silence removed, got %+v", e.Silences())
+	}
+	e.Check()
+	if fired := notifier.take(); len(fired) != 1 || fired[0].Node != "a" {
+		t.Errorf("Expected notification after silence removed, got %+v", fired)
+	}
+}
+
+// 本地HTTP接收webhook, 失败时重试
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Notification, 2)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var n Notification
+		if err := json.Unmarshal(body, &n); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Invalid webhook body %s: %v", body, err)
+		}
+		received <- n
+	}))
+	defer server.Close()
+
+	webhook := NewWebhookNotifier([]string{server.URL}, time.Second, func(url string, n Notification, err error) {
+		t.Errorf("Unexpected webhook error: %v", err)
+	})
+	webhook.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go webhook.Run(ctx)
+
+	webhook.Notify(Notification{Status: StatusFiring, Rule: "slow", Node: "a", Metric: "m", Value: 100})
+	select {
+	case n := <-received:
+		if n.Rule != "slow" || n.Status != StatusFiring || n.Value != 100 {
+			t.Errorf("Unexpected notification %+v", n)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Webhook not received")
+	}
+}
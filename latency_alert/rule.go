@@ -0,0 +1,81 @@
+package latency_alert
+
+import (
+	"path"
+	"time"
+)
+
+const (
+	OperatorAbove = "above"
+	OperatorBelow = "below"
+)
+
+// 告警规则, 按节点及指标分别评估
+// Threshold与ChangePercent二选一(均设置时任一满足即触发), Absent规则在序列超过Duration未更新时触发
+type Rule struct {
+	Name          string
+	Metric        string   //指标名, 支持通配符如 binance.ws.*
+	Nodes         []string //节点通配符, 为空表示所有节点
+	Operator      string   //above(默认) / below
+	Threshold     float64  //阈值, 单位同指标值(延迟类指标为纳秒), 0表示不按阈值判断
+	ChangePercent float64  //相对基线的变化百分比, 如100表示翻倍(below时为下降百分比), 0表示不按变化判断
+	Baseline      time.Duration
+	Absent        bool          //序列停止更新(如节点失联)时触发
+	Duration      time.Duration //条件持续满足该时长才触发
+	Severity      string
+}
+
+// 静默, 匹配的告警不发送通知, 到期后仍在触发的告警补发通知
+type Silence struct {
+	Name    string
+	Rule    string //规则名通配符, 为空表示所有规则
+	Node    string //节点通配符, 为空表示所有节点
+	UntilNs int64
+	Comment string `json:",omitempty"`
+}
+
+func matchPattern(pattern string, value string) bool {
+	if pattern == "" || pattern == value {
+		return true
+	}
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
+
+func (r Rule) matches(node string, metric string) bool {
+	if !matchPattern(r.Metric, metric) {
+		return false
+	}
+	if len(r.Nodes) == 0 {
+		return true
+	}
+	for _, pattern := range r.Nodes {
+		if matchPattern(pattern, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按阈值或相对基线判断是否满足告警条件, 无基线时只按阈值判断
+func (r Rule) breached(value float64, baseline float64, hasBaseline bool) bool {
+	below := r.Operator == OperatorBelow
+	if r.Threshold != 0 {
+		if (!below && value > r.Threshold) || (below && value < r.Threshold) {
+			return true
+		}
+	}
+	if r.ChangePercent != 0 && hasBaseline && baseline > 0 {
+		if !below && value > baseline*(1+r.ChangePercent/100) {
+			return true
+		}
+		if below && value < baseline*(1-r.ChangePercent/100) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Silence) matches(rule string, node string, nowNs int64) bool {
+	return nowNs < s.UntilNs && matchPattern(s.Rule, rule) && matchPattern(s.Node, node)
+}
@@ -0,0 +1,100 @@
+package latency_alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// 以JSON POST通知到各webhook, 通过有界队列异步发送, 失败时重试
+type WebhookNotifier struct {
+	urls     []string
+	client   *http.Client
+	retries  int
+	interval time.Duration
+	queue    chan Notification
+	onError  func(url string, n Notification, err error)
+}
+
+func NewWebhookNotifier(urls []string, timeout time.Duration, onError func(url string, n Notification, err error)) *WebhookNotifier {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &WebhookNotifier{
+		urls:     urls,
+		client:   &http.Client{Timeout: timeout},
+		retries:  3,
+		interval: time.Second,
+		queue:    make(chan Notification, 1000),
+		onError:  onError,
+	}
+}
+
+// 加入发送队列, 队列满时丢弃
+func (w *WebhookNotifier) Notify(n Notification) {
+	select {
+	case w.queue <- n:
+	default:
+		if w.onError != nil {
+			w.onError("", n, fmt.Errorf("通知队列已满"))
+		}
+	}
+}
+
+// 依次发送队列中的通知直到ctx结束
+func (w *WebhookNotifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-w.queue:
+			for _, url := range w.urls {
+				//退出时中断的发送不视为失败
+				if err := w.post(ctx, url, n); err != nil && ctx.Err() == nil && w.onError != nil {
+					w.onError(url, n, err)
+				}
+			}
+		}
+	}
+}
+
+func (w *WebhookNotifier) post(ctx context.Context, url string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err = w.postOnce(ctx, url, body)
+		if err == nil || attempt >= w.retries-1 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+func (w *WebhookNotifier) postOnce(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook返回%d", res.StatusCode)
+	}
+	return nil
+}
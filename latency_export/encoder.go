@@ -0,0 +1,73 @@
+package latency_export
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 单个测量值, 值的单位由指标决定(延迟类指标为纳秒)
+type Point struct {
+	Node   string
+	Metric string
+	TimeNs int64
+	Value  float64
+}
+
+// 数据点编码, 每个点编码为一行(含换行符)追加到buf
+type Encoder interface {
+	Encode(buf []byte, p Point) []byte
+}
+
+// InfluxDB line protocol: <measurement>,node=<node>,metric=<metric> value=<纳秒> <纳秒时间戳>
+type InfluxEncoder struct {
+	Measurement string
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+var influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+
+func (e InfluxEncoder) Encode(buf []byte, p Point) []byte {
+	buf = append(buf, influxMeasurementEscaper.Replace(e.Measurement)...)
+	buf = append(buf, ",node="...)
+	buf = append(buf, influxTagEscaper.Replace(p.Node)...)
+	buf = append(buf, ",metric="...)
+	buf = append(buf, influxTagEscaper.Replace(p.Metric)...)
+	buf = append(buf, " value="...)
+	buf = strconv.AppendFloat(buf, p.Value, 'f', -1, 64)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, p.TimeNs, 10)
+	return append(buf, '\n')
+}
+
+// StatsD计时器: <prefix>.<node>.<metric>:<毫秒>|ms, StatsD不带时间戳, 以收到时间为准
+type StatsdEncoder struct {
+	Prefix string
+}
+
+// StatsD名称中的节点名及端点名(如 1.2.3.4:9000 / spot@api1.binance.com#1.2.3.4)替换为下划线
+func statsdName(name string, keepDots bool) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r == '.' && keepDots:
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func (e StatsdEncoder) Encode(buf []byte, p Point) []byte {
+	if e.Prefix != "" {
+		buf = append(buf, statsdName(e.Prefix, true)...)
+		buf = append(buf, '.')
+	}
+	buf = append(buf, statsdName(p.Node, false)...)
+	buf = append(buf, '.')
+	buf = append(buf, statsdName(p.Metric, true)...)
+	buf = append(buf, ':')
+	buf = strconv.AppendFloat(buf, p.Value/float64(time.Millisecond), 'f', -1, 64)
+	return append(buf, "|ms\n"...)
+}
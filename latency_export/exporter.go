@@ -0,0 +1,204 @@
+package latency_export
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	FormatInflux = "influx"
+	FormatStatsd = "statsd"
+
+	ProtocolUdp  = "udp"
+	ProtocolHttp = "http"
+)
+
+// 推送设置
+type Config struct {
+	Format        string        //influx / statsd
+	Protocol      string        //udp / http, statsd仅支持udp
+	Address       string        //UDP地址 host:port, HTTP时为写入URL
+	Token         string        //HTTP推送的Authorization: Token
+	Prefix        string        //influx的measurement / statsd的名称前缀
+	BatchSize     int           //每批最多发送的点数, 攒够一批立即发送
+	FlushInterval time.Duration //未攒够一批时的发送间隔, 发送失败后也按该间隔重试
+	MaxBuffer     int           //待发送(含失败待重试)点数上限, 超出时丢弃最旧的点
+	MaxPacket     int           //UDP单包最大字节数
+	Timeout       time.Duration //HTTP推送超时
+}
+
+// 推送状态
+type Stats struct {
+	Sent    int64 //已发送点数
+	Dropped int64 //缓冲区满丢弃的点数
+	Failed  int64 //发送失败次数
+	Pending int   //当前待发送点数
+}
+
+// 批量推送测量值, 发送失败的点保留在有界缓冲区中下次重试
+type Exporter struct {
+	cfg       Config
+	encoder   Encoder
+	transport Transport
+
+	mu      sync.Mutex
+	pending []Point
+	stats   Stats
+	notify  chan struct{}
+}
+
+func NewExporter(cfg Config) (*Exporter, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("未配置推送地址")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "cgolatency"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxBuffer < cfg.BatchSize {
+		cfg.MaxBuffer = cfg.BatchSize
+	}
+	if cfg.MaxPacket <= 0 {
+		cfg.MaxPacket = 1432
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	var encoder Encoder
+	switch cfg.Format {
+	case FormatInflux, "":
+		encoder = InfluxEncoder{Measurement: cfg.Prefix}
+	case FormatStatsd:
+		encoder = StatsdEncoder{Prefix: cfg.Prefix}
+	default:
+		return nil, fmt.Errorf("不支持的推送格式: %s", cfg.Format)
+	}
+	var transport Transport
+	switch cfg.Protocol {
+	case ProtocolUdp, "":
+		udp, err := newUdpTransport(cfg.Address, cfg.MaxPacket)
+		if err != nil {
+			return nil, err
+		}
+		transport = udp
+	case ProtocolHttp:
+		if cfg.Format == FormatStatsd {
+			return nil, fmt.Errorf("StatsD仅支持UDP推送")
+		}
+		transport = newHttpTransport(cfg.Address, cfg.Token, cfg.Timeout)
+	default:
+		return nil, fmt.Errorf("不支持的推送协议: %s", cfg.Protocol)
+	}
+	return newExporter(cfg, encoder, transport), nil
+}
+
+func newExporter(cfg Config, encoder Encoder, transport Transport) *Exporter {
+	return &Exporter{cfg: cfg, encoder: encoder, transport: transport, notify: make(chan struct{}, 1)}
+}
+
+// 加入待发送缓冲, 不阻塞
+func (e *Exporter) Push(p Point) {
+	e.mu.Lock()
+	e.pending = append(e.pending, p)
+	if over := len(e.pending) - e.cfg.MaxBuffer; over > 0 {
+		e.pending = append(e.pending[:0], e.pending[over:]...)
+		e.stats.Dropped += int64(over)
+	}
+	full := len(e.pending) >= e.cfg.BatchSize
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *Exporter) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := e.stats
+	stats.Pending = len(e.pending)
+	return stats
+}
+
+// 按批发送所有待发送的点, 某批失败时放回缓冲区并停止本轮发送
+func (e *Exporter) Flush() error {
+	for {
+		e.mu.Lock()
+		n := min(len(e.pending), e.cfg.BatchSize)
+		if n == 0 {
+			e.mu.Unlock()
+			return nil
+		}
+		batch := make([]Point, n)
+		copy(batch, e.pending)
+		e.pending = append(e.pending[:0], e.pending[n:]...)
+		e.mu.Unlock()
+
+		if err := e.send(batch); err != nil {
+			e.mu.Lock()
+			e.stats.Failed++
+			//失败的批次放回队首, 超出上限时丢弃最旧的点
+			e.pending = append(batch, e.pending...)
+			if over := len(e.pending) - e.cfg.MaxBuffer; over > 0 {
+				e.pending = e.pending[over:]
+				e.stats.Dropped += int64(over)
+			}
+			e.mu.Unlock()
+			return err
+		}
+		e.mu.Lock()
+		e.stats.Sent += int64(n)
+		e.mu.Unlock()
+	}
+}
+
+// 编码一批点, 超过单次发送上限时按行拆分发送, 中途失败时整批重试, 已发出的包可能重复
+func (e *Exporter) send(batch []Point) error {
+	maxPayload := e.transport.MaxPayload()
+	var payload, line []byte
+	for _, p := range batch {
+		line = e.encoder.Encode(line[:0], p)
+		if maxPayload > 0 && len(payload) > 0 && len(payload)+len(line) > maxPayload {
+			if err := e.transport.Send(payload); err != nil {
+				return err
+			}
+			payload = payload[:0]
+		}
+		payload = append(payload, line...)
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	return e.transport.Send(payload)
+}
+
+// 攒够一批或到发送间隔时发送, ctx结束时尽量发送剩余的点后关闭
+func (e *Exporter) Run(ctx context.Context, onError func(err error)) {
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	defer e.transport.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := e.Flush(); err != nil && onError != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+		case <-e.notify:
+		}
+		if err := e.Flush(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package latency_export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncoders(t *testing.T) {
+	p := Point{Node: "1.2.3.4:9000", Metric: "binance.http.spot@api1.binance.com", TimeNs: 1700000000000000000, Value: 1500000}
+	influx := string(InfluxEncoder{Measurement: "cgolatency"}.Encode(nil, p))
+	if expected := "cgolatency,node=1.2.3.4:9000,metric=binance.http.spot@api1.binance.com value=1500000 1700000000000000000\n"; influx != expected {
+		t.Errorf("Expected %q, got %q", expected, influx)
+	}
+	escaped := string(InfluxEncoder{Measurement: "m"}.Encode(nil, Point{Node: "a b", Metric: "x,y=z", Value: 1}))
+	if expected := `m,node=a\ b,metric=x\,y\=z value=1 0` + "\n"; escaped != expected {
+		t.Errorf("Expected %q, got %q", expected, escaped)
+	}
+	statsd := string(StatsdEncoder{Prefix: "cgolatency"}.Encode(nil, p))
+	if expected := "cgolatency.1_2_3_4_9000.binance.http.spot_api1.binance.com:1.5|ms\n"; statsd != expected {
+		t.Errorf("Expected %q, got %q", expected, statsd)
+	}
+}
+
+// 本地UDP监听接收InfluxDB行协议, 超过单包上限时按行拆包
+func TestExporterUdp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	defer conn.Close()
+
+	e, err := NewExporter(Config{Format: FormatInflux, Protocol: ProtocolUdp, Address: conn.LocalAddr().String(),
+		BatchSize: 3, FlushInterval: time.Hour, MaxPacket: 100})
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, func(err error) { t.Errorf("Unexpected push error: %v", err) })
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	//攒够一批立即发送, 不等待发送间隔
+	for i := 0; i < 3; i++ {
+		e.Push(Point{Node: "a:1", Metric: "binance.ws.spot", TimeNs: int64(i), Value: float64(i)})
+	}
+	var lines []string
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for len(lines) < 3 {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom failed after %v: %v", lines, err)
+		}
+		if n > 100 {
+			t.Errorf("Expected packet <= 100 bytes, got %d", n)
+		}
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(buf[:n]), "\n"), "\n")...)
+	}
+	if lines[2] != "cgolatency,node=a:1,metric=binance.ws.spot value=2 2" {
+		t.Errorf("Unexpected lines %q", lines)
+	}
+	if stats := e.Stats(); stats.Sent != 3 || stats.Pending != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+type failingTransport struct {
+	fail     bool
+	payloads []string
+}
+
+func (t *failingTransport) Send(payload []byte) error {
+	if t.fail {
+		return errors.New("unreachable")
+	}
+	t.payloads = append(t.payloads, string(payload))
+	return nil
+}
+
+func (t *failingTransport) MaxPayload() int { return 0 }
+func (t *failingTransport) Close() error    { return nil }
+
+// 发送失败的点保留重试, 缓冲区满时丢弃最旧的点
+func TestExporterRetryBuffer(t *testing.T) {
+	transport := &failingTransport{fail: true}
+	e := newExporter(Config{BatchSize: 2, MaxBuffer: 4}, StatsdEncoder{}, transport)
+	for i := 1; i <= 3; i++ {
+		e.Push(Point{Node: "n", Metric: "m", Value: float64(i) * float64(time.Millisecond)})
+	}
+	if err := e.Flush(); err == nil {
+		t.Fatalf("Expected flush error")
+	}
+	for i := 4; i <= 6; i++ {
+		e.Push(Point{Node: "n", Metric: "m", Value: float64(i) * float64(time.Millisecond)})
+	}
+	if stats := e.Stats(); stats.Pending != 4 || stats.Dropped != 2 || stats.Failed != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	transport.fail = false
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	expected := []string{"n.m:3|ms\nn.m:4|ms\n", "n.m:5|ms\nn.m:6|ms\n"}
+	if strings.Join(transport.payloads, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, transport.payloads)
+	}
+	if stats := e.Stats(); stats.Sent != 4 || stats.Pending != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestExporterHttp(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	if _, err := NewExporter(Config{Format: FormatStatsd, Protocol: ProtocolHttp, Address: server.URL}); err == nil {
+		t.Errorf("Expected StatsD over HTTP rejected")
+	}
+	e, err := NewExporter(Config{Protocol: ProtocolHttp, Address: server.URL + "/api/v2/write", Token: "wrong"})
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	e.Push(Point{Node: "a:1", Metric: "node_latency", TimeNs: 5, Value: 7})
+	if err := e.Flush(); err == nil || e.Stats().Pending != 1 {
+		t.Errorf("Expected unauthorized push kept for retry, got %v %+v", err, e.Stats())
+	}
+
+	e, _ = NewExporter(Config{Protocol: ProtocolHttp, Address: server.URL + "/api/v2/write", Token: "secret"})
+	e.Push(Point{Node: "a:1", Metric: "node_latency", TimeNs: 5, Value: 7})
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if body := <-received; body != "cgolatency,node=a:1,metric=node_latency value=7 5\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
@@ -0,0 +1,85 @@
+package latency_export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 推送通道
+type Transport interface {
+	Send(payload []byte) error
+	MaxPayload() int //单次发送的最大字节数, 0表示不限制
+	Close() error
+}
+
+// UDP推送, 按行拼包, 单包不超过maxPacket
+type udpTransport struct {
+	conn      net.Conn
+	maxPacket int
+}
+
+func newUdpTransport(address string, maxPacket int) (*udpTransport, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("连接UDP地址%s失败: %w", address, err)
+	}
+	return &udpTransport{conn: conn, maxPacket: maxPacket}, nil
+}
+
+func (t *udpTransport) Send(payload []byte) error {
+	_, err := t.conn.Write(payload)
+	return err
+}
+
+func (t *udpTransport) MaxPayload() int {
+	return t.maxPacket
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+// HTTP推送, 整批POST到写入URL(如InfluxDB /api/v2/write), 非2xx视为失败
+type httpTransport struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newHttpTransport(url string, token string, timeout time.Duration) *httpTransport {
+	return &httpTransport{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+func (t *httpTransport) Send(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Token "+t.token)
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("HTTP推送返回%d: %s", res.StatusCode, body)
+	}
+	return nil
+}
+
+func (t *httpTransport) MaxPayload() int {
+	return 0
+}
+
+func (t *httpTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,41 @@
+package latency_history
+
+// 降采样后的数据点, 每个步长一个桶, 无数据的桶不输出
+type Bucket struct {
+	TimeNs int64   //桶起始时间
+	Value  float64 //桶内均值
+	Min    float64
+	Max    float64
+	Count  int
+}
+
+// 将按时间升序的数据点以fromNs为起点按stepNs分桶, stepNs<=0时每个点单独成桶
+func Downsample(points []Point, fromNs int64, stepNs int64) []Bucket {
+	var buckets []Bucket
+	var sum float64
+	for _, p := range points {
+		start := p.TimeNs
+		if stepNs > 0 {
+			start = fromNs + (p.TimeNs-fromNs)/stepNs*stepNs
+			if p.TimeNs < fromNs && (p.TimeNs-fromNs)%stepNs != 0 {
+				start -= stepNs
+			}
+		}
+		if n := len(buckets); n > 0 && buckets[n-1].TimeNs == start {
+			b := &buckets[n-1]
+			sum += p.Value
+			b.Count++
+			b.Value = sum / float64(b.Count)
+			if p.Value < b.Min {
+				b.Min = p.Value
+			}
+			if p.Value > b.Max {
+				b.Max = p.Value
+			}
+			continue
+		}
+		sum = p.Value
+		buckets = append(buckets, Bucket{TimeNs: start, Value: p.Value, Min: p.Value, Max: p.Value, Count: 1})
+	}
+	return buckets
+}
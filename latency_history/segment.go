@@ -0,0 +1,351 @@
+package latency_history
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	segmentPrefix     = "seg-"
+	segmentSuffix     = ".jsonl"
+	segmentTimeLayout = "20060102T150405Z"
+)
+
+// 磁盘存储设置
+type DiskOptions struct {
+	Dir             string
+	SegmentDuration time.Duration //每个分段文件覆盖的时长
+	Retention       time.Duration //超过该时长的分段删除, 0表示不删除
+	DownsampleAfter time.Duration //超过该时长的分段降采样, 0表示不降采样
+	DownsampleStep  time.Duration //降采样步长, 桶内取均值
+}
+
+// 分段文件中的一行
+type diskPoint struct {
+	Node   string  `json:"n"`
+	Metric string  `json:"m"`
+	TimeNs int64   `json:"t"`
+	Value  float64 `json:"v"`
+	Count  int     `json:"c,omitempty"` //降采样桶内的原始点数, 原始数据为空
+}
+
+// 合并降采样时的权重, 原始数据点计为1
+func (p diskPoint) weight() int {
+	if p.Count > 0 {
+		return p.Count
+	}
+	return 1
+}
+
+// 分段文件, 文件名 seg-<UTC起始时间>[-<降采样步长>].jsonl
+type segment struct {
+	path    string
+	startNs int64
+	step    time.Duration //0表示原始数据
+}
+
+// 追加写入的分段存储, 每行一个JSON数据点, 按时间切分文件
+// 重启后可直接读取, 进程异常退出时末尾不完整的行在读取时跳过
+type DiskStore struct {
+	opts DiskOptions
+
+	mu      sync.Mutex
+	file    *os.File
+	fileSeg int64 //当前打开分段的起始时间
+}
+
+func OpenDiskStore(opts DiskOptions) (*DiskStore, error) {
+	if opts.SegmentDuration <= 0 {
+		opts.SegmentDuration = time.Hour
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建历史数据目录失败: %w", err)
+	}
+	return &DiskStore{opts: opts}, nil
+}
+
+func (d *DiskStore) segmentStart(timeNs int64) int64 {
+	step := int64(d.opts.SegmentDuration)
+	start := timeNs / step * step
+	if timeNs < 0 && timeNs%step != 0 {
+		start -= step
+	}
+	return start
+}
+
+func (d *DiskStore) segmentPath(startNs int64, step time.Duration) string {
+	name := segmentPrefix + time.Unix(0, startNs).UTC().Format(segmentTimeLayout)
+	if step > 0 {
+		name += "-" + step.String()
+	}
+	return filepath.Join(d.opts.Dir, name+segmentSuffix)
+}
+
+// 追加一个数据点, 写入其时间所在的原始分段
+func (d *DiskStore) Append(node string, metric string, timeNs int64, value float64) error {
+	line, err := json.Marshal(diskPoint{Node: node, Metric: metric, TimeNs: timeNs, Value: value})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	start := d.segmentStart(timeNs)
+	if d.file == nil || d.fileSeg != start {
+		if d.file != nil {
+			d.file.Close()
+			d.file = nil
+		}
+		file, err := os.OpenFile(d.segmentPath(start, 0), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("打开历史分段失败: %w", err)
+		}
+		d.file, d.fileSeg = file, start
+	}
+	_, err = d.file.Write(line)
+	return err
+}
+
+func (d *DiskStore) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+// 列出所有分段, 按起始时间升序, 同一时间原始分段在前
+func (d *DiskStore) segments() ([]segment, error) {
+	entries, err := os.ReadDir(d.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix)
+		stamp, stepStr, downsampled := strings.Cut(base, "-")
+		start, err := time.Parse(segmentTimeLayout, stamp)
+		if err != nil {
+			continue
+		}
+		seg := segment{path: filepath.Join(d.opts.Dir, name), startNs: start.UnixNano()}
+		if downsampled {
+			if seg.step, err = time.ParseDuration(stepStr); err != nil || seg.step <= 0 {
+				continue
+			}
+		}
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].startNs != segments[j].startNs {
+			return segments[i].startNs < segments[j].startNs
+		}
+		return segments[i].step < segments[j].step
+	})
+	return segments, nil
+}
+
+// 逐行读取分段, 跳过无法解析的行
+func readSegment(path string, fn func(p diskPoint)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var p diskPoint
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil || p.Metric == "" {
+			continue
+		}
+		fn(p)
+	}
+	return scanner.Err()
+}
+
+// 遍历与 [fromNs, toNs] 重叠的分段中的数据点
+// 同一时间段同时存在原始及降采样分段时只读降采样分段: 原始分段为降采样后迟到的点, 下次压缩时合并,
+// 压缩中途也可能是已合并到降采样分段但尚未删除的数据
+func (d *DiskStore) scan(fromNs int64, toNs int64, fn func(p diskPoint)) error {
+	segments, err := d.segments()
+	if err != nil {
+		return err
+	}
+	downsampled := make(map[int64]bool)
+	for _, seg := range segments {
+		if seg.step > 0 {
+			downsampled[seg.startNs] = true
+		}
+	}
+	for _, seg := range segments {
+		if seg.startNs > toNs || seg.startNs+int64(d.opts.SegmentDuration) <= fromNs {
+			continue
+		}
+		if seg.step == 0 && downsampled[seg.startNs] {
+			continue
+		}
+		err := readSegment(seg.path, func(p diskPoint) {
+			if p.TimeNs >= fromNs && p.TimeNs <= toNs {
+				fn(p)
+			}
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 查询指标在 [fromNs, toNs] 内的数据点, node为空时查询所有节点, 返回 节点 -> 按时间升序的数据点
+func (d *DiskStore) Query(node string, metric string, fromNs int64, toNs int64) (map[string][]Point, error) {
+	result := make(map[string][]Point)
+	err := d.scan(fromNs, toNs, func(p diskPoint) {
+		if p.Metric == metric && (node == "" || p.Node == node) {
+			result[p.Node] = append(result[p.Node], Point{TimeNs: p.TimeNs, Value: p.Value})
+		}
+	})
+	for _, points := range result {
+		sort.SliceStable(points, func(i, j int) bool { return points[i].TimeNs < points[j].TimeNs })
+	}
+	return result, err
+}
+
+// 按时间顺序回放fromNs之后的所有数据点, 用于重启后恢复内存历史
+func (d *DiskStore) Replay(fromNs int64, fn func(node string, metric string, p Point)) error {
+	return d.scan(fromNs, 1<<63-1, func(p diskPoint) {
+		fn(p.Node, p.Metric, Point{TimeNs: p.TimeNs, Value: p.Value})
+	})
+}
+
+// 删除超过保留时长的分段, 并将超过降采样时长的原始分段按步长取均值重写
+func (d *DiskStore) Compact(nowNs int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	segments, err := d.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		endNs := seg.startNs + int64(d.opts.SegmentDuration)
+		if endNs > nowNs {
+			continue
+		}
+		if d.opts.Retention > 0 && endNs <= nowNs-int64(d.opts.Retention) {
+			if d.file != nil && d.fileSeg == seg.startNs {
+				d.file.Close()
+				d.file = nil
+			}
+			if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if seg.step == 0 && d.opts.DownsampleAfter > 0 && d.opts.DownsampleStep > 0 && endNs <= nowNs-int64(d.opts.DownsampleAfter) {
+			if err := d.downsampleSegment(seg); err != nil {
+				return fmt.Errorf("降采样历史分段%s失败: %w", filepath.Base(seg.path), err)
+			}
+		}
+	}
+	return nil
+}
+
+// 将原始分段降采样后合并到同一时间的降采样分段, 再删除原始分段
+func (d *DiskStore) downsampleSegment(seg segment) error {
+	if d.file != nil && d.fileSeg == seg.startNs {
+		d.file.Close()
+		d.file = nil
+	}
+	target := d.segmentPath(seg.startNs, d.opts.DownsampleStep)
+	type bucketKey struct {
+		series SeriesKey
+		timeNs int64
+	}
+	type bucketSum struct {
+		sum   float64
+		count int
+	}
+	step := int64(d.opts.DownsampleStep)
+	buckets := make(map[bucketKey]*bucketSum)
+	//较晚到达的点写入了已降采样时间段的原始分段, 与已有降采样数据按点数加权重新分桶
+	collect := func(p diskPoint) {
+		start := seg.startNs + (p.TimeNs-seg.startNs)/step*step
+		if p.TimeNs < seg.startNs && (p.TimeNs-seg.startNs)%step != 0 {
+			start -= step
+		}
+		key := bucketKey{series: SeriesKey{Node: p.Node, Metric: p.Metric}, timeNs: start}
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucketSum{}
+			buckets[key] = b
+		}
+		b.sum += p.Value * float64(p.weight())
+		b.count += p.weight()
+	}
+	if err := readSegment(target, collect); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := readSegment(seg.path, collect); err != nil {
+		return err
+	}
+
+	lines := make([]diskPoint, 0, len(buckets))
+	for key, b := range buckets {
+		lines = append(lines, diskPoint{Node: key.series.Node, Metric: key.series.Metric, TimeNs: key.timeNs,
+			Value: b.sum / float64(b.count), Count: b.count})
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].TimeNs != lines[j].TimeNs {
+			return lines[i].TimeNs < lines[j].TimeNs
+		}
+		if lines[i].Node != lines[j].Node {
+			return lines[i].Node < lines[j].Node
+		}
+		return lines[i].Metric < lines[j].Metric
+	})
+
+	tmp := target + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, p := range lines {
+		line, err := json.Marshal(p)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+	return os.Remove(seg.path)
+}
@@ -0,0 +1,114 @@
+package latency_history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiskStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	hour := int64(time.Hour)
+	d, err := OpenDiskStore(DiskOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("OpenDiskStore failed: %v", err)
+	}
+	d.Append("a:1", "binance.ws.spot", 10*hour+1, 1)
+	d.Append("b:1", "binance.ws.spot", 10*hour+2, 2)
+	d.Append("a:1", "binance.ws.spot", 11*hour+1, 3)
+	d.Append("a:1", "node_latency", 11*hour+2, 4)
+	//较晚到达的点写回所属分段
+	d.Append("a:1", "binance.ws.spot", 10*hour, 5)
+	d.Close()
+
+	//模拟进程异常退出留下的不完整行
+	file, _ := os.OpenFile(filepath.Join(dir, "seg-19700101T110000Z.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"n":"a:1","m":"binan`)
+	file.Close()
+
+	d, err = OpenDiskStore(DiskOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer d.Close()
+	result, err := d.Query("", "binance.ws.spot", 0, 12*hour)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	expected := map[string][]Point{
+		"a:1": {{10 * hour, 5}, {10*hour + 1, 1}, {11*hour + 1, 3}},
+		"b:1": {{10*hour + 2, 2}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	if result, _ := d.Query("a:1", "binance.ws.spot", 11*hour, 12*hour); len(result["a:1"]) != 1 || len(result) != 1 {
+		t.Errorf("Unexpected range query %v", result)
+	}
+
+	var replayed []string
+	d.Replay(11*hour, func(node string, metric string, p Point) {
+		replayed = append(replayed, node+" "+metric)
+	})
+	if !reflect.DeepEqual(replayed, []string{"a:1 binance.ws.spot", "a:1 node_latency"}) {
+		t.Errorf("Unexpected replay %v", replayed)
+	}
+}
+
+func TestDiskStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	hour, minute := int64(time.Hour), int64(time.Minute)
+	d, err := OpenDiskStore(DiskOptions{Dir: dir, Retention: 48 * time.Hour, DownsampleAfter: 24 * time.Hour, DownsampleStep: time.Minute})
+	if err != nil {
+		t.Fatalf("OpenDiskStore failed: %v", err)
+	}
+	defer d.Close()
+	for i := int64(0); i < 4; i++ {
+		d.Append("a:1", "m", i*15*int64(time.Second), float64(i)) //第0小时, 超过保留时长
+		d.Append("a:1", "m", 30*hour+i*15*int64(time.Second), float64(i))
+		d.Append("a:1", "m", 30*hour+minute+i*15*int64(time.Second), float64(10*i))
+		d.Append("a:1", "m", 70*hour+i, float64(i)) //未超过降采样时长
+	}
+
+	if err := d.Compact(72 * hour); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	names := func() []string {
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+	expectedNames := []string{"seg-19700102T060000Z-1m0s.jsonl", "seg-19700103T220000Z.jsonl"}
+	if got := names(); !reflect.DeepEqual(got, expectedNames) {
+		t.Fatalf("Expected segments %v, got %v", expectedNames, got)
+	}
+	result, _ := d.Query("a:1", "m", 0, 72*hour)
+	expected := []Point{{30 * hour, 1.5}, {30*hour + minute, 15}, {70 * hour, 0}, {70*hour + 1, 1}, {70*hour + 2, 2}, {70*hour + 3, 3}}
+	if !reflect.DeepEqual(result["a:1"], expected) {
+		t.Errorf("Expected %v, got %v", expected, result["a:1"])
+	}
+
+	//已降采样时间段又收到点时, 压缩前只读取降采样分段, 不与迟到的原始点重复
+	d.Append("a:1", "m", 30*hour+30*int64(time.Second), 100)
+	result, _ = d.Query("a:1", "m", 30*hour, 30*hour+2*minute)
+	if !reflect.DeepEqual(result["a:1"], expected[:2]) {
+		t.Errorf("Expected only downsampled points before compaction, got %v", result["a:1"])
+	}
+
+	//再次压缩时按桶内点数加权合并到降采样分段
+	if err := d.Compact(72 * hour); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if got := names(); !reflect.DeepEqual(got, expectedNames) {
+		t.Errorf("Expected segments %v, got %v", expectedNames, got)
+	}
+	result, _ = d.Query("a:1", "m", 30*hour, 30*hour+2*minute)
+	if len(result["a:1"]) != 2 || result["a:1"][0].Value != (1.5*4+100)/5 || result["a:1"][1].Value != 15 {
+		t.Errorf("Unexpected merged buckets %v", result["a:1"])
+	}
+}
@@ -0,0 +1,120 @@
+package latency_history
+
+import (
+	"sort"
+	"sync"
+)
+
+// 单个数据点, 值的单位由指标决定(延迟类指标为纳秒)
+type Point struct {
+	TimeNs int64
+	Value  float64
+}
+
+// 序列标识
+type SeriesKey struct {
+	Node   string
+	Metric string
+}
+
+// 序列概况
+type SeriesInfo struct {
+	Node    string
+	Metric  string
+	Count   int
+	FirstNs int64
+	LastNs  int64
+}
+
+// 固定容量环形缓冲, 写满后覆盖最旧的点
+type ring struct {
+	points []Point
+	start  int
+	size   int
+}
+
+func (r *ring) push(p Point) {
+	if r.size < len(r.points) {
+		r.points[(r.start+r.size)%len(r.points)] = p
+		r.size++
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+func (r *ring) at(i int) Point {
+	return r.points[(r.start+i)%len(r.points)]
+}
+
+// 按节点及指标保存最近capacity个数据点的内存历史
+type Store struct {
+	mu       sync.RWMutex
+	capacity int
+	series   map[SeriesKey]*ring
+}
+
+func NewStore(capacity int) *Store {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &Store{capacity: capacity, series: make(map[SeriesKey]*ring)}
+}
+
+// 记录一个数据点
+func (s *Store) Record(node string, metric string, timeNs int64, value float64) {
+	key := SeriesKey{Node: node, Metric: metric}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.series[key]
+	if !ok {
+		r = &ring{points: make([]Point, s.capacity)}
+		s.series[key] = r
+	}
+	r.push(Point{TimeNs: timeNs, Value: value})
+}
+
+// 查询 [fromNs, toNs] 内的数据点, 按时间升序
+func (s *Store) Query(node string, metric string, fromNs int64, toNs int64) []Point {
+	s.mu.RLock()
+	r, ok := s.series[SeriesKey{Node: node, Metric: metric}]
+	var points []Point
+	if ok {
+		for i := 0; i < r.size; i++ {
+			if p := r.at(i); p.TimeNs >= fromNs && p.TimeNs <= toNs {
+				points = append(points, p)
+			}
+		}
+	}
+	s.mu.RUnlock()
+	//远程节点结果可能乱序到达
+	sort.SliceStable(points, func(i, j int) bool { return points[i].TimeNs < points[j].TimeNs })
+	return points
+}
+
+// 所有序列概况, 按节点及指标排序
+func (s *Store) Series() []SeriesInfo {
+	s.mu.RLock()
+	infos := make([]SeriesInfo, 0, len(s.series))
+	for key, r := range s.series {
+		info := SeriesInfo{Node: key.Node, Metric: key.Metric, Count: r.size}
+		for i := 0; i < r.size; i++ {
+			p := r.at(i)
+			if info.FirstNs == 0 || p.TimeNs < info.FirstNs {
+				info.FirstNs = p.TimeNs
+			}
+			if p.TimeNs > info.LastNs {
+				info.LastNs = p.TimeNs
+			}
+		}
+		infos = append(infos, info)
+	}
+	s.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Node != infos[j].Node {
+			return infos[i].Node < infos[j].Node
+		}
+		return infos[i].Metric < infos[j].Metric
+	})
+	return infos
+}
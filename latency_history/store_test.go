@@ -0,0 +1,54 @@
+package latency_history
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStoreRing(t *testing.T) {
+	s := NewStore(3)
+	for i := int64(1); i <= 5; i++ {
+		s.Record("a:1", "binance.ws.spot", i*10, float64(i))
+	}
+	s.Record("b:1", "node_latency", 7, 1)
+
+	//容量3, 只保留最近3个点
+	points := s.Query("a:1", "binance.ws.spot", 0, 100)
+	expected := []Point{{30, 3}, {40, 4}, {50, 5}}
+	if !reflect.DeepEqual(points, expected) {
+		t.Errorf("Expected %v, got %v", expected, points)
+	}
+	if points := s.Query("a:1", "binance.ws.spot", 35, 45); len(points) != 1 || points[0].Value != 4 {
+		t.Errorf("Unexpected range query %v", points)
+	}
+	if points := s.Query("a:1", "missing", 0, 100); len(points) != 0 {
+		t.Errorf("Expected empty series, got %v", points)
+	}
+
+	//乱序到达的点查询时按时间排序
+	s.Record("b:1", "node_latency", 3, 2)
+	if points := s.Query("b:1", "node_latency", 0, 100); !reflect.DeepEqual(points, []Point{{3, 2}, {7, 1}}) {
+		t.Errorf("Expected sorted points, got %v", points)
+	}
+
+	series := s.Series()
+	if len(series) != 2 || series[0].Node != "a:1" || series[0].Count != 3 || series[0].FirstNs != 30 || series[0].LastNs != 50 {
+		t.Errorf("Unexpected series %+v", series)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	points := []Point{{0, 1}, {5, 3}, {10, 10}, {25, 4}, {29, 6}}
+	buckets := Downsample(points, 0, 10)
+	expected := []Bucket{
+		{TimeNs: 0, Value: 2, Min: 1, Max: 3, Count: 2},
+		{TimeNs: 10, Value: 10, Min: 10, Max: 10, Count: 1},
+		{TimeNs: 20, Value: 5, Min: 4, Max: 6, Count: 2},
+	}
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, buckets)
+	}
+	if raw := Downsample(points, 0, 0); len(raw) != len(points) || raw[3].TimeNs != 25 {
+		t.Errorf("Expected one bucket per point, got %+v", raw)
+	}
+}
@@ -0,0 +1,210 @@
+package latency_stats
+
+import (
+	"math"
+	"sort"
+)
+
+// 异常值过滤方式
+type FilterMode string
+
+const (
+	FilterNone        FilterMode = "none"         //不过滤
+	FilterTrimmedMean FilterMode = "trimmed_mean" //去掉最高及最低各TrimRatio比例的样本
+	FilterMAD         FilterMode = "mad"          //修正Z分数(基于中位数绝对偏差)超过MadThreshold的样本视为异常
+	FilterMinOfN      FilterMode = "min_of_n"     //每连续MinOfN个样本只保留最小值
+)
+
+const (
+	DefaultTrimRatio    = 0.1
+	DefaultMadThreshold = 3.5
+	DefaultMinOfN       = 5
+)
+
+// 过滤配置, 零值参数使用默认值
+type Filter struct {
+	Mode         FilterMode
+	TrimRatio    float64
+	MadThreshold float64
+	MinOfN       int
+}
+
+// 过滤结果, 与统计一同上报
+type FilterResult struct {
+	Mode    FilterMode
+	Removed int64 //被剔除的样本数
+}
+
+// 按过滤方式剔除异常样本, 返回的样本保持原有顺序(抖动依赖样本顺序)
+func (f Filter) Apply(samples []int64) []int64 {
+	switch f.Mode {
+	case FilterTrimmedMean:
+		return f.trim(samples)
+	case FilterMAD:
+		return f.mad(samples)
+	case FilterMinOfN:
+		return f.minOfN(samples)
+	}
+	return samples
+}
+
+func (f Filter) trim(samples []int64) []int64 {
+	ratio := f.TrimRatio
+	if ratio <= 0 {
+		ratio = DefaultTrimRatio
+	}
+	if ratio >= 0.5 {
+		ratio = 0.49
+	}
+	k := int(float64(len(samples)) * ratio)
+	if k == 0 {
+		return samples
+	}
+	//按值排序下标, 剔除两端各k个
+	idx := make([]int, len(samples))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return samples[idx[i]] < samples[idx[j]] })
+	removed := make([]bool, len(samples))
+	for _, i := range idx[:k] {
+		removed[i] = true
+	}
+	for _, i := range idx[len(idx)-k:] {
+		removed[i] = true
+	}
+	kept := make([]int64, 0, len(samples)-2*k)
+	for i, v := range samples {
+		if !removed[i] {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func (f Filter) mad(samples []int64) []int64 {
+	if len(samples) < 3 {
+		return samples
+	}
+	threshold := f.MadThreshold
+	if threshold <= 0 {
+		threshold = DefaultMadThreshold
+	}
+	median := medianOf(samples)
+	deviations := make([]int64, len(samples))
+	for i, v := range samples {
+		deviations[i] = absInt64(v - median)
+	}
+	mad := medianOf(deviations)
+	if mad == 0 {
+		//过半样本相同, 无法估计离散程度
+		return samples
+	}
+	kept := make([]int64, 0, len(samples))
+	for i, v := range samples {
+		//修正Z分数 = 0.6745 * |x - median| / MAD
+		if 0.6745*float64(deviations[i])/float64(mad) <= threshold {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func (f Filter) minOfN(samples []int64) []int64 {
+	n := f.MinOfN
+	if n <= 0 {
+		n = DefaultMinOfN
+	}
+	if n == 1 {
+		return samples
+	}
+	kept := make([]int64, 0, (len(samples)+n-1)/n)
+	for start := 0; start < len(samples); start += n {
+		end := start + n
+		if end > len(samples) {
+			end = len(samples)
+		}
+		min := int64(math.MaxInt64)
+		for _, v := range samples[start:end] {
+			if v < min {
+				min = v
+			}
+		}
+		kept = append(kept, min)
+	}
+	return kept
+}
+
+// 中位数, 偶数个样本取中间两值均值
+func medianOf(values []int64) int64 {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return sorted[mid-1] + (sorted[mid]-sorted[mid-1])/2
+	}
+	return sorted[mid]
+}
+
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// 收集原始样本, 汇总时同时给出原始及过滤后的统计
+// 非并发安全
+type Sampler struct {
+	samples []int64
+}
+
+func NewSampler() *Sampler {
+	return &Sampler{}
+}
+
+// 记录一个样本
+func (s *Sampler) Record(v int64) {
+	s.samples = append(s.samples, v)
+}
+
+// 已记录样本数
+func (s *Sampler) Count() int64 {
+	return int64(len(s.samples))
+}
+
+// 原始及过滤后的延迟分布
+type Summary struct {
+	Stats    LatencyStats //过滤后的分布
+	RawStats LatencyStats //过滤前的分布
+	Filter   FilterResult
+}
+
+// 按过滤配置汇总样本
+func (s *Sampler) Summarize(filter Filter) Summary {
+	return summarize(s.samples, filter)
+}
+
+func summarize(samples []int64, filter Filter) Summary {
+	mode := filter.Mode
+	if mode == "" {
+		mode = FilterNone
+	}
+	kept := filter.Apply(samples)
+	return Summary{
+		Stats:    statsOf(kept),
+		RawStats: statsOf(samples),
+		Filter: FilterResult{
+			Mode:    mode,
+			Removed: int64(len(samples) - len(kept)),
+		},
+	}
+}
+
+func statsOf(samples []int64) LatencyStats {
+	h := NewHistogram()
+	for _, v := range samples {
+		h.Record(v)
+	}
+	return h.Stats()
+}
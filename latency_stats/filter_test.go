@@ -0,0 +1,49 @@
+package latency_stats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterApply(t *testing.T) {
+	samples := []int64{100, 102, 98, 101, 5000, 99, 103, 97, 100, 1}
+	cases := []struct {
+		filter   Filter
+		expected []int64
+	}{
+		{Filter{Mode: FilterNone}, samples},
+		{Filter{Mode: FilterTrimmedMean, TrimRatio: 0.1}, []int64{100, 102, 98, 101, 99, 103, 97, 100}},
+		{Filter{Mode: FilterTrimmedMean, TrimRatio: 0.2}, []int64{100, 102, 98, 101, 99, 100}},
+		{Filter{Mode: FilterMAD}, []int64{100, 102, 98, 101, 99, 103, 97, 100}},
+		{Filter{Mode: FilterMinOfN, MinOfN: 3}, []int64{98, 99, 97, 1}},
+		//参数为零值时使用默认值
+		{Filter{Mode: FilterMinOfN}, []int64{98, 1}},
+	}
+	for i, c := range cases {
+		if got := c.filter.Apply(samples); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("case %d %s: got %v, expected %v", i, c.filter.Mode, got, c.expected)
+		}
+	}
+}
+
+func TestSamplerSummarize(t *testing.T) {
+	s := NewSampler()
+	for _, v := range []int64{100, 102, 98, 101, 5000, 99, 103, 97, 100, 1} {
+		s.Record(v)
+	}
+	summary := s.Summarize(Filter{Mode: FilterMAD})
+	if summary.Filter.Mode != FilterMAD || summary.Filter.Removed != 2 {
+		t.Errorf("Unexpected filter result %+v", summary.Filter)
+	}
+	if summary.RawStats.Count != 10 || summary.RawStats.MaxNs != 5000 || summary.RawStats.MinNs != 1 {
+		t.Errorf("Unexpected raw stats %+v", summary.RawStats)
+	}
+	if summary.Stats.Count != 8 || summary.Stats.MaxNs != 103 || summary.Stats.MinNs != 97 || summary.Stats.MeanNs != 100 {
+		t.Errorf("Unexpected filtered stats %+v", summary.Stats)
+	}
+
+	summary = s.Summarize(Filter{})
+	if summary.Filter.Mode != FilterNone || summary.Filter.Removed != 0 || summary.Stats != summary.RawStats {
+		t.Errorf("Expected unfiltered summary, got %+v", summary)
+	}
+}
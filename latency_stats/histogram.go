@@ -0,0 +1,187 @@
+package latency_stats
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// 默认子桶位数, 2^11=2048个子桶约保留3位有效数字(相对误差<0.1%)
+const defaultSubBucketBits = 11
+
+// 延迟分布统计摘要, 单位均为纳秒
+type LatencyStats struct {
+	Count    int64
+	MinNs    int64
+	P50Ns    int64
+	P90Ns    int64
+	P99Ns    int64
+	P999Ns   int64
+	MaxNs    int64
+	MeanNs   int64
+	StddevNs int64
+	JitterNs int64 //相邻样本差值绝对值的均值
+}
+
+// HDR风格对数线性直方图, 按有效数字分桶, 内存与样本数无关
+// 支持负值(如修正时钟差后的单向延迟), 负值按绝对值单独分桶
+// 非并发安全
+type Histogram struct {
+	subBucketBits uint
+	pos           map[int64]int64 //桶键 -> 计数
+	neg           map[int64]int64
+
+	count     int64
+	min       int64
+	max       int64
+	mean      float64
+	m2        float64
+	last      int64
+	jitterSum float64
+}
+
+// 新建直方图, 保留约3位有效数字
+func NewHistogram() *Histogram {
+	return NewHistogramWithPrecision(defaultSubBucketBits)
+}
+
+// 新建直方图, subBucketBits越大精度越高, 相对误差约为 2^-(subBucketBits-1)
+func NewHistogramWithPrecision(subBucketBits uint) *Histogram {
+	if subBucketBits < 1 {
+		subBucketBits = 1
+	}
+	return &Histogram{
+		subBucketBits: subBucketBits,
+		pos:           make(map[int64]int64),
+		neg:           make(map[int64]int64),
+	}
+}
+
+// 计算非负值的桶键, 桶键随数值单调递增
+func (h *Histogram) bucketKey(v uint64) int64 {
+	shift := bits.Len64(v) - int(h.subBucketBits)
+	if shift <= 0 {
+		return int64(v)
+	}
+	return int64(shift)<<h.subBucketBits | int64(v>>uint(shift))
+}
+
+// 桶键对应的数值区间下界及宽度
+func (h *Histogram) bucketRange(key int64) (int64, int64) {
+	shift := key >> h.subBucketBits
+	if shift == 0 {
+		return key, 1
+	}
+	sub := key & (1<<h.subBucketBits - 1)
+	return sub << uint(shift), 1 << uint(shift)
+}
+
+// 记录一个样本
+func (h *Histogram) Record(v int64) {
+	if v >= 0 {
+		h.pos[h.bucketKey(uint64(v))]++
+	} else {
+		h.neg[h.bucketKey(uint64(-v))]++
+	}
+
+	h.count++
+	if h.count == 1 {
+		h.min, h.max = v, v
+	} else {
+		if v < h.min {
+			h.min = v
+		}
+		if v > h.max {
+			h.max = v
+		}
+		h.jitterSum += math.Abs(float64(v - h.last))
+	}
+	h.last = v
+
+	//Welford在线计算均值与方差
+	delta := float64(v) - h.mean
+	h.mean += delta / float64(h.count)
+	h.m2 += delta * (float64(v) - h.mean)
+}
+
+// 样本数
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// 计算百分位值(0-100), 返回所在桶的中点并限制在[min,max]内
+func (h *Histogram) ValueAtPercentile(percentile float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	if percentile <= 0 {
+		return h.min
+	}
+	if percentile >= 100 {
+		return h.max
+	}
+	rank := int64(math.Ceil(percentile / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	//负值按绝对值从大到小, 即数值从小到大
+	negKeys := sortedKeys(h.neg)
+	cumulative := int64(0)
+	for i := len(negKeys) - 1; i >= 0; i-- {
+		cumulative += h.neg[negKeys[i]]
+		if cumulative >= rank {
+			low, width := h.bucketRange(negKeys[i])
+			return h.clamp(-(low + (width-1)/2))
+		}
+	}
+	for _, key := range sortedKeys(h.pos) {
+		cumulative += h.pos[key]
+		if cumulative >= rank {
+			low, width := h.bucketRange(key)
+			return h.clamp(low + (width-1)/2)
+		}
+	}
+	return h.max
+}
+
+func (h *Histogram) clamp(v int64) int64 {
+	if v < h.min {
+		return h.min
+	}
+	if v > h.max {
+		return h.max
+	}
+	return v
+}
+
+// 统计摘要
+func (h *Histogram) Stats() LatencyStats {
+	if h.count == 0 {
+		return LatencyStats{}
+	}
+	stats := LatencyStats{
+		Count:  h.count,
+		MinNs:  h.min,
+		P50Ns:  h.ValueAtPercentile(50),
+		P90Ns:  h.ValueAtPercentile(90),
+		P99Ns:  h.ValueAtPercentile(99),
+		P999Ns: h.ValueAtPercentile(99.9),
+		MaxNs:  h.max,
+		MeanNs: int64(math.Round(h.mean)),
+	}
+	if h.count > 1 {
+		stats.StddevNs = int64(math.Round(math.Sqrt(h.m2 / float64(h.count-1))))
+		stats.JitterNs = int64(math.Round(h.jitterSum / float64(h.count-1)))
+	}
+	return stats
+}
+
+func sortedKeys(m map[int64]int64) []int64 {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
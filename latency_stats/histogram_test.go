@@ -0,0 +1,70 @@
+package latency_stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// 与精确排序结果对比, 误差应在有效数字精度内
+func TestHistogramPercentiles(t *testing.T) {
+	h := NewHistogram()
+	r := rand.New(rand.NewSource(1))
+	values := make([]int64, 0, 100000)
+	for i := 0; i < 100000; i++ {
+		//对数正态分布, 模拟长尾延迟: 中位数约1ms
+		v := int64(math.Exp(r.NormFloat64()*0.8) * 1e6)
+		values = append(values, v)
+		h.Record(v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	exact := func(p float64) int64 {
+		return values[int(math.Ceil(p/100*float64(len(values))))-1]
+	}
+	stats := h.Stats()
+	checks := []struct {
+		name     string
+		got, exp int64
+	}{
+		{"p50", stats.P50Ns, exact(50)},
+		{"p90", stats.P90Ns, exact(90)},
+		{"p99", stats.P99Ns, exact(99)},
+		{"p99.9", stats.P999Ns, exact(99.9)},
+	}
+	for _, c := range checks {
+		if relErr := math.Abs(float64(c.got-c.exp)) / float64(c.exp); relErr > 0.001 {
+			t.Errorf("%s: got %d, exact %d, relative error %.5f", c.name, c.got, c.exp, relErr)
+		}
+	}
+	if stats.Count != 100000 || stats.MinNs != values[0] || stats.MaxNs != values[len(values)-1] {
+		t.Errorf("Unexpected count/min/max: %+v", stats)
+	}
+}
+
+// 测试均值、标准差、抖动及负值
+func TestHistogramMomentsAndNegative(t *testing.T) {
+	h := NewHistogram()
+	for _, v := range []int64{-300, -100, 100, 300} {
+		h.Record(v)
+	}
+	stats := h.Stats()
+	if stats.MeanNs != 0 {
+		t.Errorf("Expected mean 0, got %d", stats.MeanNs)
+	}
+	//样本标准差 sqrt((9+1+1+9)*1e4/3)
+	if exp := int64(math.Round(math.Sqrt(200000.0 / 3))); stats.StddevNs != exp {
+		t.Errorf("Expected stddev %d, got %d", exp, stats.StddevNs)
+	}
+	if stats.JitterNs != 200 {
+		t.Errorf("Expected jitter 200, got %d", stats.JitterNs)
+	}
+	if stats.MinNs != -300 || stats.P50Ns != -100 || stats.MaxNs != 300 {
+		t.Errorf("Unexpected min/p50/max: %+v", stats)
+	}
+
+	if empty := NewHistogram().Stats(); empty != (LatencyStats{}) {
+		t.Errorf("Expected zero stats for empty histogram, got %+v", empty)
+	}
+}
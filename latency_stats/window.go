@@ -0,0 +1,73 @@
+package latency_stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 带时间戳的样本
+type timedSample struct {
+	TimeNs  int64
+	ValueNs int64
+}
+
+// 滚动窗口采样器, 保留最近maxWindow内的样本, 可按不超过maxWindow的任意窗口汇总
+// 并发安全: 接收协程写入的同时可由发布协程汇总
+type RollingSampler struct {
+	mu        sync.Mutex
+	maxWindow int64
+	samples   []timedSample //按时间升序, head之前为已淘汰样本
+	head      int
+	total     int64
+}
+
+func NewRollingSampler(maxWindow time.Duration) *RollingSampler {
+	return &RollingSampler{maxWindow: int64(maxWindow)}
+}
+
+// 记录timeNs时刻的样本, 时间应单调不减
+func (s *RollingSampler) Record(timeNs int64, valueNs int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, timedSample{TimeNs: timeNs, ValueNs: valueNs})
+	s.total++
+	s.evict(timeNs)
+}
+
+// 累计记录的样本数, 含已滑出窗口的样本
+func (s *RollingSampler) Total() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// 汇总 (nowNs - window, nowNs] 内的样本
+func (s *RollingSampler) Summarize(nowNs int64, window time.Duration, filter Filter) Summary {
+	s.mu.Lock()
+	s.evict(nowNs)
+	live := s.samples[s.head:]
+	cutoff := nowNs - int64(window)
+	start := sort.Search(len(live), func(i int) bool { return live[i].TimeNs > cutoff })
+	values := make([]int64, 0, len(live)-start)
+	for _, sample := range live[start:] {
+		if sample.TimeNs <= nowNs {
+			values = append(values, sample.ValueNs)
+		}
+	}
+	s.mu.Unlock()
+	return summarize(values, filter)
+}
+
+// 淘汰早于 nowNs - maxWindow 的样本, 淘汰部分过半时整理底层数组
+func (s *RollingSampler) evict(nowNs int64) {
+	cutoff := nowNs - s.maxWindow
+	for s.head < len(s.samples) && s.samples[s.head].TimeNs <= cutoff {
+		s.head++
+	}
+	if s.head > 0 && s.head*2 >= len(s.samples) {
+		n := copy(s.samples, s.samples[s.head:])
+		s.samples = s.samples[:n]
+		s.head = 0
+	}
+}
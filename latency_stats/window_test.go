@@ -0,0 +1,48 @@
+package latency_stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollingSampler(t *testing.T) {
+	s := NewRollingSampler(5 * time.Second)
+	second := int64(time.Second)
+	//每秒一个样本, 值为秒数
+	for i := int64(1); i <= 10; i++ {
+		s.Record(i*second, i*1000)
+	}
+	if s.Total() != 10 {
+		t.Errorf("Expected 10 total samples, got %d", s.Total())
+	}
+
+	now := 10 * second
+	last2 := s.Summarize(now, 2*time.Second, Filter{})
+	if last2.Stats.Count != 2 || last2.Stats.MinNs != 9000 || last2.Stats.MaxNs != 10000 {
+		t.Errorf("Unexpected 2s window %+v", last2.Stats)
+	}
+	//超过maxWindow的样本已淘汰
+	all := s.Summarize(now, time.Minute, Filter{})
+	if all.Stats.Count != 5 || all.Stats.MinNs != 6000 {
+		t.Errorf("Unexpected max window %+v", all.Stats)
+	}
+
+	//无新样本时窗口随时间滑空
+	if empty := s.Summarize(now+6*second, 5*time.Second, Filter{}); empty.Stats.Count != 0 {
+		t.Errorf("Expected empty window, got %+v", empty.Stats)
+	}
+	if s.Total() != 10 {
+		t.Errorf("Expected total to include evicted samples, got %d", s.Total())
+	}
+}
+
+func TestRollingSamplerFilter(t *testing.T) {
+	s := NewRollingSampler(time.Minute)
+	for i, v := range []int64{100, 102, 98, 101, 5000, 99, 103, 97, 100, 1} {
+		s.Record(int64(i), v)
+	}
+	summary := s.Summarize(10, time.Minute, Filter{Mode: FilterMAD})
+	if summary.RawStats.Count != 10 || summary.Stats.Count != 8 || summary.Filter.Removed != 2 {
+		t.Errorf("Unexpected filtered summary %+v", summary)
+	}
+}
@@ -47,20 +47,16 @@ func main() {
 
 	go p2pNode.StartHTTPServer(http_port)
 
-	log.Info("开始监控币安/OKX延迟信息...")
+	log.Info("开始监控交易所延迟信息...")
 	// 原有的延迟监控逻辑
 	for {
 		time.Sleep(time.Second * 30)
 
-		bnLatencyAll := p2pNode.GetBnLatencyAll()
-
-		for k, v := range bnLatencyAll {
-			log.Infof("节点[%s]币安延迟信息: %+v", k, v)
-		}
-
-		okxLatencyAll := p2pNode.GetOkxLatencyAll()
-		for k, v := range okxLatencyAll {
-			log.Infof("节点[%s]OKX延迟信息: %+v", k, v)
+		for _, probe := range p2p_latency.GetExchangeProbes() {
+			exchangeLatencyAll := p2pNode.GetExchangeLatencyAll(probe.Name())
+			for k, v := range exchangeLatencyAll {
+				log.Infof("节点[%s]%s延迟信息: %+v", k, probe.Name(), v)
+			}
 		}
 
 		nodeLatencyAll := p2pNode.GetAllAvgLatency()
@@ -0,0 +1,128 @@
+package p2p_latency
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 后端IP结果键的分隔符, 如 spot#13.225.1.2
+const endpointBackendSep = "#"
+
+// 解析主机全部A/AAAA记录, 测试时可替换
+var lookupBackendAddrs = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
+
+// 在原端点之外为每个后端IP追加固定解析的端点, 原端点仍由系统解析以便对照
+type backendProbe struct {
+	ExchangeProbe
+	http []HttpEndpoint
+	ws   []WsEndpoint
+}
+
+// 解析各端点主机名, 同一主机只解析一次; 只有一个地址的主机无需展开
+func withBackendFanout(probe ExchangeProbe, timeout time.Duration) ExchangeProbe {
+	resolved := make(map[string][]string)
+	backends := func(rawUrl string) []string {
+		u, err := url.Parse(rawUrl)
+		if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+			return nil
+		}
+		host := u.Hostname()
+		if addrs, ok := resolved[host]; ok {
+			return addrs
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		ipAddrs, err := lookupBackendAddrs(ctx, host)
+		if err != nil {
+			log.Warnf("解析%s后端IP失败: %v", host, err)
+		}
+		var addrs []string
+		seen := make(map[string]bool)
+		for _, ipAddr := range ipAddrs {
+			addr := ipAddr.IP.String()
+			if !seen[addr] {
+				seen[addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) < 2 {
+			addrs = nil
+		} else {
+			log.Infof("%s 解析到%d个后端IP: %s", host, len(addrs), strings.Join(addrs, ", "))
+		}
+		resolved[host] = addrs
+		return addrs
+	}
+
+	p := backendProbe{ExchangeProbe: probe}
+	for _, ep := range probe.HttpEndpoints() {
+		p.http = append(p.http, ep)
+		if ep.Backend != "" {
+			continue
+		}
+		for _, addr := range backends(ep.Url) {
+			pinned := ep
+			pinned.Name = ep.Name + endpointBackendSep + addr
+			pinned.Backend = addr
+			p.http = append(p.http, pinned)
+		}
+	}
+	for _, ep := range probe.WsEndpoints() {
+		p.ws = append(p.ws, ep)
+		if ep.Backend != "" {
+			continue
+		}
+		for _, addr := range backends(ep.Url) {
+			pinned := ep
+			pinned.Name = ep.Name + endpointBackendSep + addr
+			pinned.Backend = addr
+			p.ws = append(p.ws, pinned)
+		}
+	}
+	return p
+}
+
+func (p backendProbe) HttpEndpoints() []HttpEndpoint { return p.http }
+func (p backendProbe) WsEndpoints() []WsEndpoint     { return p.ws }
+
+// 生成CURLOPT_RESOLVE固定解析项 host:port:addr, backend为空时返回nil
+func backendResolve(rawUrl string, backend string) []string {
+	if backend == "" {
+		return nil
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https", "wss":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+	addr := backend
+	if strings.Contains(addr, ":") {
+		addr = "[" + addr + "]"
+	}
+	return []string{u.Hostname() + ":" + port + ":" + addr}
+}
+
+// 各端点按后端IP排名
+func rankBackends(result *ExchangeLatencyResult) []EndpointRanking {
+	return rankEndpoints(result, func(name string, backend string) string {
+		if backend == "" {
+			return ""
+		}
+		return strings.TrimSuffix(name, endpointBackendSep+backend)
+	}, func(rawUrl string, backend string) string {
+		return backend
+	})
+}
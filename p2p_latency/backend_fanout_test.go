@@ -0,0 +1,106 @@
+package p2p_latency
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+)
+
+func TestBackendResolve(t *testing.T) {
+	cases := []struct {
+		url, backend string
+		expected     []string
+	}{
+		{"https://api.binance.com/api/v3/ping", "13.225.1.2", []string{"api.binance.com:443:13.225.1.2"}},
+		{"wss://ws.okx.com:8443/ws/v5/public", "2600:9000::1", []string{"ws.okx.com:8443:[2600:9000::1]"}},
+		{"ws://example.com/stream", "10.0.0.1", []string{"example.com:80:10.0.0.1"}},
+		{"https://api.binance.com/api/v3/ping", "", nil},
+	}
+	for _, c := range cases {
+		if got := backendResolve(c.url, c.backend); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("backendResolve(%s, %s) = %v, expected %v", c.url, c.backend, got, c.expected)
+		}
+	}
+}
+
+// 将不可解析的主机名展开到本地两个回环地址, 逐个后端测试并排名
+func TestRunHttpProbeBackendFanout(t *testing.T) {
+	if err := http_client.InitLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupLibcurl()
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "exchange.invalid:") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		local := r.Context().Value(http.LocalAddrContextKey).(net.Addr).String()
+		mu.Lock()
+		hits[local[:strings.LastIndex(local, ":")]]++
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	lookup := lookupBackendAddrs
+	defer func() { lookupBackendAddrs = lookup }()
+	lookupBackendAddrs = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host != "exchange.invalid" {
+			t.Errorf("Unexpected lookup of %s", host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("127.0.0.2")}, {IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+
+	url := fmt.Sprintf("http://exchange.invalid:%d/ping", port)
+	probe := withBackendFanout(localTestProbe{httpEndpoints: []HttpEndpoint{{Name: "spot", Url: url}}}, time.Second)
+	var names []string
+	for _, ep := range probe.HttpEndpoints() {
+		names = append(names, ep.Name)
+	}
+	if expected := []string{"spot", "spot#127.0.0.1", "spot#127.0.0.2"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected endpoints %v, got %v", expected, names)
+	}
+
+	settings := testProbeSettings()
+	settings.HttpTimeoutMs = 1000
+	result := &ExchangeLatencyResult{Http: runHttpProbe(probe, settings)}
+	for _, backend := range []string{"127.0.0.1", "127.0.0.2"} {
+		r := result.Http["spot#"+backend]
+		if r.Backend != backend || r.SuccessCount != int64(settings.HttpSamples) {
+			t.Errorf("Unexpected result for backend %s: %+v", backend, r)
+		}
+		mu.Lock()
+		if hits[backend] != settings.HttpSamples {
+			t.Errorf("Expected %d requests on %s, got %d", settings.HttpSamples, backend, hits[backend])
+		}
+		mu.Unlock()
+	}
+
+	backends := rankBackends(result)
+	if len(backends) != 1 || backends[0].Product != "spot" || len(backends[0].Ranks) != 2 {
+		t.Fatalf("Unexpected backend ranking %+v", backends)
+	}
+	//后端IP端点不参与主机名变体排名
+	if rankings := rankEndpointVariants(result, map[string]endpointVariantGroup{"spot": {}}); len(rankings) != 0 {
+		t.Errorf("Expected no variant ranking, got %+v", rankings)
+	}
+}
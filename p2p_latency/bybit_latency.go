@@ -0,0 +1,102 @@
+package p2p_latency
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func init() {
+	RegisterExchangeProbe(bybitProbe{})
+}
+
+// Bybit v5延迟测试
+type bybitProbe struct{}
+
+func (bybitProbe) Name() string {
+	return "bybit"
+}
+
+// v5无独立ping接口, 以服务器时间接口作为REST延迟测试地址
+func (bybitProbe) HttpEndpoints() []HttpEndpoint {
+	return []HttpEndpoint{
+		//timeNano为纳秒时间戳, 按微秒精度计误差
+		{Name: "api", Url: "https://api.bybit.com/v5/market/time", ServerTimeUrl: "https://api.bybit.com/v5/market/time", ServerTimeResolution: time.Microsecond},
+	}
+}
+
+// {"retCode":0,"retMsg":"OK","result":{"timeSecond":"1688639403","timeNano":"1688639403423213947"},"time":1688639403423}
+func (bybitProbe) ParseServerTime(body string) (int64, error) {
+	var serverTime struct {
+		RetCode int `json:"retCode"`
+		Result  struct {
+			TimeNano string `json:"timeNano"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(body), &serverTime); err != nil {
+		return 0, err
+	}
+	if serverTime.RetCode != 0 || serverTime.Result.TimeNano == "" {
+		return 0, errors.New("timeNano字段缺失")
+	}
+	return strconv.ParseInt(serverTime.Result.TimeNano, 10, 64)
+}
+
+func (bybitProbe) WsEndpoints() []WsEndpoint {
+	subscribeMsg := `{"op":"subscribe","args":["orderbook.1.BTCUSDT","orderbook.1.ETHUSDT","publicTrade.BTCUSDT","publicTrade.ETHUSDT"]}`
+	return []WsEndpoint{
+		{Name: "spot", Url: "wss://stream.bybit.com/v5/public/spot", ServerTimeFrom: "api", SubscribeMsgs: []string{subscribeMsg}},
+		{Name: "linear", Url: "wss://stream.bybit.com/v5/public/linear", ServerTimeFrom: "api", SubscribeMsgs: []string{subscribeMsg}},
+	}
+}
+
+// orderbook: {"topic":"orderbook.1.BTCUSDT","type":"snapshot","ts":..,"data":{"s":"BTCUSDT","u":..,"seq":..},"cts":..}
+// publicTrade: {"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":..,"data":[{"T":..}]}
+// 推送时间ts作为事件时间, 盘口撮合引擎时间cts及成交时间T作为撮合时间; 订阅应答及pong不含topic
+func (bybitProbe) ExtractWsTick(msg string) (WsTick, bool) {
+	var wsRecv struct {
+		Topic string              `json:"topic"`
+		Ts    int64               `json:"ts"`
+		Cts   int64               `json:"cts"`
+		Data  jsoniter.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(msg), &wsRecv); err != nil {
+		return WsTick{}, false
+	}
+	if wsRecv.Topic == "" || wsRecv.Ts == 0 {
+		return WsTick{}, false
+	}
+	tick := WsTick{
+		Stream:         wsRecv.Topic,
+		EventTimeNs:    wsRecv.Ts * 1000000,
+		TransactTimeNs: wsRecv.Cts * 1000000,
+	}
+	if len(wsRecv.Data) == 0 {
+		return tick, true
+	}
+	switch wsRecv.Data[0] {
+	case '{':
+		//盘口更新id递增, 服务重启时u会回到1
+		var book struct {
+			U int64 `json:"u"`
+		}
+		if json.Unmarshal(wsRecv.Data, &book) == nil && book.U > 0 {
+			tick.Seq = WsSeq{Mode: WsSeqMonotonic, FirstId: book.U, LastId: book.U}
+		}
+	case '[':
+		//同一推送内多笔成交取最早成交时间
+		var trades []struct {
+			T int64 `json:"T"`
+		}
+		if json.Unmarshal(wsRecv.Data, &trades) == nil {
+			for _, trade := range trades {
+				if trade.T > 0 && (tick.TransactTimeNs == 0 || trade.T*1000000 < tick.TransactTimeNs) {
+					tick.TransactTimeNs = trade.T * 1000000
+				}
+			}
+		}
+	}
+	return tick, true
+}
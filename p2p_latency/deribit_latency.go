@@ -0,0 +1,186 @@
+package p2p_latency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const deribitWsUrl = "wss://www.deribit.com/ws/api/v2"
+
+func init() {
+	RegisterExchangeProbe(deribitProbe{})
+}
+
+// Deribit延迟测试, 时间校准及请求往返均通过WebSocket JSON-RPC完成
+type deribitProbe struct{}
+
+func (deribitProbe) Name() string {
+	return "deribit"
+}
+
+func (deribitProbe) HttpEndpoints() []HttpEndpoint {
+	return nil
+}
+
+// 服务器时间通过WS public/get_time获取, 不走HTTP
+func (deribitProbe) ParseServerTime(body string) (int64, error) {
+	return 0, errors.New("deribit服务器时间通过WS JSON-RPC获取")
+}
+
+func (deribitProbe) WsEndpoints() []WsEndpoint {
+	return []WsEndpoint{
+		{Name: "public", Url: deribitWsUrl, ServerTimeFrom: "rpc", SubscribeMsgs: []string{
+			`{"jsonrpc":"2.0","id":1,"method":"public/subscribe","params":{"channels":["book.BTC-PERPETUAL.raw","book.ETH-PERPETUAL.raw","trades.BTC-PERPETUAL.raw","trades.ETH-PERPETUAL.raw"]}}`,
+		}},
+	}
+}
+
+// book: {"method":"subscription","params":{"channel":"book.BTC-PERPETUAL.raw","data":{"type":"change","timestamp":..,"prev_change_id":..,"change_id":..}}}
+// trades: {"method":"subscription","params":{"channel":"trades.BTC-PERPETUAL.raw","data":[{"timestamp":..,"trade_seq":..}]}}
+func (deribitProbe) ExtractWsTick(msg string) (WsTick, bool) {
+	var wsRecv struct {
+		Method string `json:"method"`
+		Params struct {
+			Channel string              `json:"channel"`
+			Data    jsoniter.RawMessage `json:"data"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(msg), &wsRecv); err != nil {
+		return WsTick{}, false
+	}
+	if wsRecv.Method != "subscription" || len(wsRecv.Params.Data) == 0 {
+		return WsTick{}, false
+	}
+	tick := WsTick{Stream: wsRecv.Params.Channel}
+
+	if wsRecv.Params.Data[0] == '[' {
+		var trades []struct {
+			Timestamp int64 `json:"timestamp"`
+			TradeSeq  int64 `json:"trade_seq"`
+		}
+		if err := json.Unmarshal(wsRecv.Params.Data, &trades); err != nil || len(trades) == 0 || trades[0].Timestamp == 0 {
+			return WsTick{}, false
+		}
+		tick.EventTimeNs = trades[0].Timestamp * 1000000
+		tick.Seq = WsSeq{Mode: WsSeqMonotonic, FirstId: trades[0].TradeSeq, LastId: trades[len(trades)-1].TradeSeq}
+		return tick, true
+	}
+
+	var book struct {
+		Type         string `json:"type"`
+		Timestamp    int64  `json:"timestamp"`
+		ChangeId     int64  `json:"change_id"`
+		PrevChangeId int64  `json:"prev_change_id"`
+	}
+	if err := json.Unmarshal(wsRecv.Params.Data, &book); err != nil || book.Timestamp == 0 {
+		return WsTick{}, false
+	}
+	tick.EventTimeNs = book.Timestamp * 1000000
+	//快照不带prev_change_id, 视为序号重置
+	prevId := book.PrevChangeId
+	if book.Type == "snapshot" {
+		prevId = -1
+	}
+	tick.Seq = WsSeq{Mode: WsSeqPrevLinked, FirstId: book.ChangeId, LastId: book.ChangeId, PrevId: prevId}
+	return tick, true
+}
+
+func (deribitProbe) ProbeWsRpc() []WsRpcLatencyResult {
+	result, err := probeDeribitJsonRpc("rpc", deribitWsUrl, loadProbeSettings("deribit"))
+	if err != nil {
+		log.Error(err)
+		return []WsRpcLatencyResult{{Name: "rpc", Url: deribitWsUrl}}
+	}
+	return []WsRpcLatencyResult{*result}
+}
+
+// 通过public/get_time估算时间差, 通过public/test测量JSON-RPC往返耗时
+func probeDeribitJsonRpc(name string, url string, settings ProbeSettings) (*WsRpcLatencyResult, error) {
+	client, err := http_client.NewWebSocketClientLibcurl()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	res := client.Connect(url, settings.WsTimeoutMs)
+	if res.Error != "" {
+		observeProbeFailure("deribit", transportWsRpc, name, classifyProbeError(res.Error))
+		return nil, fmt.Errorf("[deribit %s] 连接失败: %s", name, res.Error)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requester := client.NewRequester(ctx, http_client.WebSocketRequesterOptions{})
+	call := func(method string) (http_client.WebSocketReply, error) {
+		callCtx, callCancel := context.WithTimeout(ctx, time.Duration(settings.RpcTimeoutMs)*time.Millisecond)
+		defer callCancel()
+		return requester.CallJSON(callCtx, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  method,
+			"params":  map[string]interface{}{},
+		})
+	}
+
+	result := &WsRpcLatencyResult{Name: name, Url: url}
+
+	//{"jsonrpc":"2.0","id":1,"result":1550147385946,"usIn":1550147385946123,"usOut":1550147385946456,"usDiff":333}
+	//usIn/usOut为服务端收发微秒时间, 缺失时回退到毫秒级result
+	estimator := newServerClockEstimator(time.Microsecond)
+	msEstimator := newServerClockEstimator(time.Millisecond)
+	for i := 0; i < settings.ServerTimeSamples; i++ {
+		reply, err := call("public/get_time")
+		if err != nil {
+			observeProbeFailure("deribit", transportWsRpc, name, classifyCallError(err))
+			log.Errorf("[deribit %s] public/get_time失败: %v", name, err)
+			continue
+		}
+		var getTime struct {
+			Result int64 `json:"result"`
+			UsIn   int64 `json:"usIn"`
+			UsOut  int64 `json:"usOut"`
+		}
+		if err := json.Unmarshal([]byte(reply.Data), &getTime); err != nil || getTime.Result == 0 {
+			log.Errorf("[deribit %s] 解析服务器时间失败: %s", name, reply.Data)
+			continue
+		}
+		if getTime.UsIn > 0 && getTime.UsOut >= getTime.UsIn {
+			estimator.AddNtp(reply.SendTimeNs, reply.RecvTimeNs, getTime.UsIn*1000, getTime.UsOut*1000)
+		} else {
+			msEstimator.Add(reply.SendTimeNs, reply.RecvTimeNs, getTime.Result*1000000)
+		}
+	}
+	if estimator.Count() == 0 {
+		estimator = msEstimator
+	}
+	if estimator.Count() == 0 {
+		return nil, fmt.Errorf("[deribit %s] 未能获取服务器时间", name)
+	}
+	result.ServerClock = estimator.Estimate()
+	result.ServerTimeDiffNs = result.ServerClock.OffsetNs
+	result.ServerTimeRttNs = result.ServerClock.RttNs
+	log.Infof("[deribit %s] 服务器%d次请求(取%d次最小往返)时间差: %d ns ≈ %.6f ± %.6f ms", name,
+		result.ServerClock.SampleCount, result.ServerClock.UsedCount, result.ServerTimeDiffNs,
+		float64(result.ServerTimeDiffNs)/1000000, float64(result.ServerClock.UncertaintyNs)/1000000)
+
+	sampler := latency_stats.NewSampler()
+	for i := 0; i < settings.RpcSamples; i++ {
+		reply, err := call("public/test")
+		if err != nil {
+			observeProbeFailure("deribit", transportWsRpc, name, classifyCallError(err))
+			log.Errorf("[deribit %s] public/test失败: %v", name, err)
+			continue
+		}
+		sampler.Record(reply.RttNs)
+		observeProbeSample("deribit", transportWsRpc, name, reply.RttNs)
+		result.SuccessCount++
+	}
+	result.Summary = sampler.Summarize(settings.Filter)
+	result.RttNs = result.Stats.MeanNs
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package p2p_latency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/gorilla/websocket"
+)
+
+// 测试JSON-RPC往返耗时及基于public/get_time的时间差估算
+func TestDeribitJsonRpcProbe(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	//模拟服务端时钟比本地慢200ms
+	const serverLag = 200 * time.Millisecond
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		for {
+			req, err := readJSONRequest(conn)
+			if err != nil {
+				return
+			}
+			usIn := time.Now().Add(-serverLag).UnixMicro()
+			time.Sleep(2 * time.Millisecond)
+			usOut := time.Now().Add(-serverLag).UnixMicro()
+			switch req["method"] {
+			case "public/get_time":
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req["id"], "result": usOut / 1000, "usIn": usIn, "usOut": usOut, "usDiff": usOut - usIn})
+			case "public/test":
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req["id"], "result": map[string]string{"version": "1.2.26"}, "usIn": usIn, "usOut": usOut})
+			default:
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req["id"], "error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+			}
+		}
+	})
+	defer closeServer()
+
+	result, err := probeDeribitJsonRpc("rpc", url, ProbeSettings{ServerTimeSamples: 3, RpcSamples: 3, WsTimeoutMs: 2000, RpcTimeoutMs: 2000})
+	if err != nil {
+		t.Fatalf("probeDeribitJsonRpc failed: %v", err)
+	}
+	if result.SuccessCount != 3 {
+		t.Errorf("Expected 3 successful calls, got %d", result.SuccessCount)
+	}
+	if result.RttNs < int64(2*time.Millisecond) || result.RttNs > int64(time.Second) {
+		t.Errorf("Unexpected RTT %d ns", result.RttNs)
+	}
+	//时间差误差不超过往返耗时
+	if diff := result.ServerTimeDiffNs - int64(serverLag); diff < -result.ServerTimeRttNs || diff > result.ServerTimeRttNs {
+		t.Errorf("Expected server time diff ≈ %d ns, got %d ns (rtt %d ns)", int64(serverLag), result.ServerTimeDiffNs, result.ServerTimeRttNs)
+	}
+}
+
+// 测试Deribit订阅推送解析
+func TestDeribitExtractWsTick(t *testing.T) {
+	probe := deribitProbe{}
+	cases := []struct {
+		msg  string
+		ok   bool
+		tick WsTick
+	}{
+		{`{"jsonrpc":"2.0","method":"subscription","params":{"channel":"book.BTC-PERPETUAL.raw","data":{"type":"change","timestamp":1700000000123,"prev_change_id":10,"change_id":11,"instrument_name":"BTC-PERPETUAL","bids":[],"asks":[]}}}`, true,
+			WsTick{Stream: "book.BTC-PERPETUAL.raw", EventTimeNs: 1700000000123000000, Seq: WsSeq{Mode: WsSeqPrevLinked, FirstId: 11, LastId: 11, PrevId: 10}}},
+		{`{"jsonrpc":"2.0","method":"subscription","params":{"channel":"book.BTC-PERPETUAL.raw","data":{"type":"snapshot","timestamp":1700000000123,"change_id":5,"bids":[],"asks":[]}}}`, true,
+			WsTick{Stream: "book.BTC-PERPETUAL.raw", EventTimeNs: 1700000000123000000, Seq: WsSeq{Mode: WsSeqPrevLinked, FirstId: 5, LastId: 5, PrevId: -1}}},
+		{`{"jsonrpc":"2.0","method":"subscription","params":{"channel":"trades.BTC-PERPETUAL.raw","data":[{"timestamp":1700000000123,"trade_seq":7},{"timestamp":1700000000124,"trade_seq":8}]}}`, true,
+			WsTick{Stream: "trades.BTC-PERPETUAL.raw", EventTimeNs: 1700000000123000000, Seq: WsSeq{Mode: WsSeqMonotonic, FirstId: 7, LastId: 8}}},
+		{`{"jsonrpc":"2.0","id":1,"result":["book.BTC-PERPETUAL.raw"]}`, false, WsTick{}},
+	}
+	for i, c := range cases {
+		tick, ok := probe.ExtractWsTick(c.msg)
+		if ok != c.ok || tick != c.tick {
+			t.Errorf("case %d: got %+v %v, expected %+v %v", i, tick, ok, c.tick, c.ok)
+		}
+	}
+}
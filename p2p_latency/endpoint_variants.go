@@ -0,0 +1,224 @@
+package p2p_latency
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Hongssd/cgolatencytest/config"
+)
+
+// 端点变体结果键的分隔符, 如 spot@api1.binance.com
+const endpointVariantSep = "@"
+
+// 同一产品的可替换主机名, 可带端口或协议前缀
+type endpointVariantGroup struct {
+	Http []string
+	Ws   []string
+}
+
+// 读取配置 endpoint_variants.<exchange>.<端点名>.http / ws
+func loadEndpointVariants(probe ExchangeProbe) map[string]endpointVariantGroup {
+	groups := make(map[string]endpointVariantGroup)
+	load := func(name string) {
+		if _, ok := groups[name]; ok {
+			return
+		}
+		prefix := "endpoint_variants." + probe.Name() + "." + name + "."
+		group := endpointVariantGroup{
+			Http: config.GetConfigSlice(prefix + "http"),
+			Ws:   config.GetConfigSlice(prefix + "ws"),
+		}
+		if len(group.Http) > 0 || len(group.Ws) > 0 {
+			groups[name] = group
+		}
+	}
+	for _, ep := range probe.HttpEndpoints() {
+		load(ep.Name)
+	}
+	for _, ep := range probe.WsEndpoints() {
+		load(ep.Name)
+	}
+	return groups
+}
+
+// 在原端点之外追加各主机名变体, 变体沿用原端点的路径、订阅及服务器时间来源
+type variantProbe struct {
+	ExchangeProbe
+	variants map[string]endpointVariantGroup
+}
+
+func withEndpointVariants(probe ExchangeProbe, variants map[string]endpointVariantGroup) ExchangeProbe {
+	if len(variants) == 0 {
+		return probe
+	}
+	return variantProbe{ExchangeProbe: probe, variants: variants}
+}
+
+func (p variantProbe) HttpEndpoints() []HttpEndpoint {
+	var endpoints []HttpEndpoint
+	for _, ep := range p.ExchangeProbe.HttpEndpoints() {
+		endpoints = append(endpoints, ep)
+		for _, host := range variantHosts(ep.Url, p.variants[ep.Name].Http) {
+			variant := ep
+			variant.Name = ep.Name + endpointVariantSep + host
+			variant.Url = replaceUrlHost(ep.Url, host)
+			if variant.ServerTimeUrl != "" {
+				variant.ServerTimeUrl = replaceUrlHost(ep.ServerTimeUrl, host)
+			}
+			endpoints = append(endpoints, variant)
+		}
+	}
+	return endpoints
+}
+
+func (p variantProbe) WsEndpoints() []WsEndpoint {
+	var endpoints []WsEndpoint
+	for _, ep := range p.ExchangeProbe.WsEndpoints() {
+		endpoints = append(endpoints, ep)
+		for _, host := range variantHosts(ep.Url, p.variants[ep.Name].Ws) {
+			variant := ep
+			variant.Name = ep.Name + endpointVariantSep + host
+			variant.Url = replaceUrlHost(ep.Url, host)
+			endpoints = append(endpoints, variant)
+		}
+	}
+	return endpoints
+}
+
+// 规范化变体主机名, 去掉与原端点相同及重复的主机
+func variantHosts(rawUrl string, variants []string) []string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{u.Host: true}
+	var hosts []string
+	for _, variant := range variants {
+		host := strings.TrimSpace(variant)
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		host = strings.TrimSuffix(host, "/")
+		//未指定端口时沿用原端点端口
+		if _, _, err := net.SplitHostPort(host); err != nil && u.Port() != "" {
+			host = net.JoinHostPort(host, u.Port())
+		}
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func replaceUrlHost(rawUrl string, host string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	u.Host = host
+	return u.String()
+}
+
+// 单个主机名或后端IP的延迟排名项
+type EndpointRank struct {
+	Host         string //主机名, 后端IP排名时为IP
+	Name         string //Http/Ws结果中的端点键
+	LatencyNs    int64
+	P50Ns        int64
+	P99Ns        int64
+	SuccessCount int64
+}
+
+// 同一交易所产品各主机名(或同一端点各后端IP)按p50延迟升序排名, 无成功样本的排在最后
+type EndpointRanking struct {
+	Product   string //产品名, 后端IP排名时为端点键
+	Transport string //http / ws
+	Ranks     []EndpointRank
+}
+
+// 为配置了变体的端点生成排名, 固定解析到后端IP的端点不参与
+func rankEndpointVariants(result *ExchangeLatencyResult, variants map[string]endpointVariantGroup) []EndpointRanking {
+	return rankEndpoints(result, func(name string, backend string) string {
+		if backend != "" {
+			return ""
+		}
+		if _, ok := variants[endpointProduct(name)]; ok {
+			return endpointProduct(name)
+		}
+		return ""
+	}, func(rawUrl string, backend string) string {
+		return urlHost(rawUrl)
+	})
+}
+
+// 按groupOf分组收集HTTP及WS端点结果并排名, groupOf返回空的端点不参与, 每组至少两项才输出
+func rankEndpoints(result *ExchangeLatencyResult, groupOf func(name string, backend string) string,
+	hostOf func(rawUrl string, backend string) string) []EndpointRanking {
+	httpGroups := make(map[string][]EndpointRank)
+	wsGroups := make(map[string][]EndpointRank)
+	for name, r := range result.Http {
+		if group := groupOf(name, r.Backend); group != "" {
+			httpGroups[group] = append(httpGroups[group], EndpointRank{Host: hostOf(r.Url, r.Backend), Name: name,
+				LatencyNs: r.LatencyNs, P50Ns: r.Stats.P50Ns, P99Ns: r.Stats.P99Ns, SuccessCount: r.SuccessCount})
+		}
+	}
+	for name, r := range result.Ws {
+		if group := groupOf(name, r.Backend); group != "" {
+			wsGroups[group] = append(wsGroups[group], EndpointRank{Host: hostOf(r.Url, r.Backend), Name: name,
+				LatencyNs: r.LatencyNs, P50Ns: r.Stats.P50Ns, P99Ns: r.Stats.P99Ns, SuccessCount: r.SuccessCount})
+		}
+	}
+
+	groups := make([]string, 0, len(httpGroups)+len(wsGroups))
+	for group := range httpGroups {
+		groups = append(groups, group)
+	}
+	for group := range wsGroups {
+		if _, ok := httpGroups[group]; !ok {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+
+	var rankings []EndpointRanking
+	collect := func(product string, transport string, ranks []EndpointRank) {
+		if len(ranks) < 2 {
+			return
+		}
+		sort.Slice(ranks, func(i, j int) bool {
+			if (ranks[i].SuccessCount > 0) != (ranks[j].SuccessCount > 0) {
+				return ranks[i].SuccessCount > 0
+			}
+			if ranks[i].P50Ns != ranks[j].P50Ns {
+				return ranks[i].P50Ns < ranks[j].P50Ns
+			}
+			return ranks[i].Host < ranks[j].Host
+		})
+		rankings = append(rankings, EndpointRanking{Product: product, Transport: transport, Ranks: ranks})
+	}
+	for _, group := range groups {
+		collect(group, "http", httpGroups[group])
+		collect(group, "ws", wsGroups[group])
+	}
+	return rankings
+}
+
+// 端点键去掉变体后缀
+func endpointProduct(name string) string {
+	if i := strings.Index(name, endpointVariantSep); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func urlHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return u.Host
+}
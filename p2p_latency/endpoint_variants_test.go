@@ -0,0 +1,97 @@
+package p2p_latency
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+	"github.com/spf13/viper"
+)
+
+func TestVariantHosts(t *testing.T) {
+	hosts := variantHosts("wss://ws.okx.com:8443/ws/v5/public", []string{
+		"ws.okx.com", "wsaws.okx.com:8443", "wss://wsaws.okx.com/", " ws2.okx.com:443 ",
+	})
+	//未写端口沿用8443, 与原端点及重复的主机被去掉
+	expected := []string{"wsaws.okx.com:8443", "ws2.okx.com:443"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("Expected %v, got %v", expected, hosts)
+	}
+	if got := replaceUrlHost("https://api4.binance.com/api/v3/ping", "api1.binance.com"); got != "https://api1.binance.com/api/v3/ping" {
+		t.Errorf("Unexpected replaced url %s", got)
+	}
+}
+
+func TestWithEndpointVariants(t *testing.T) {
+	viper.Set("endpoint_variants.local.spot.http", []string{"a1.example.com", "a2.example.com"})
+	viper.Set("endpoint_variants.local.public.ws", []string{"ws2.example.com"})
+	defer func() {
+		viper.Set("endpoint_variants.local.spot.http", nil)
+		viper.Set("endpoint_variants.local.public.ws", nil)
+	}()
+
+	probe := localTestProbe{wsUrl: "wss://ws.example.com/stream", httpEndpoints: []HttpEndpoint{
+		{Name: "spot", Url: "https://a.example.com/ping", ServerTimeUrl: "https://a.example.com/time"},
+		{Name: "future", Url: "https://f.example.com/ping"},
+	}}
+	variants := loadEndpointVariants(probe)
+	if len(variants) != 2 {
+		t.Fatalf("Expected 2 variant groups, got %+v", variants)
+	}
+	measured := withEndpointVariants(probe, variants)
+
+	var names []string
+	for _, ep := range measured.HttpEndpoints() {
+		names = append(names, ep.Name)
+		if ep.Name == "spot@a2.example.com" && (ep.Url != "https://a2.example.com/ping" || ep.ServerTimeUrl != "https://a2.example.com/time") {
+			t.Errorf("Unexpected variant endpoint %+v", ep)
+		}
+	}
+	expected := []string{"spot", "spot@a1.example.com", "spot@a2.example.com", "future"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected http endpoints %v, got %v", expected, names)
+	}
+	ws := measured.WsEndpoints()
+	if len(ws) != 2 || ws[1].Name != "public@ws2.example.com" || ws[1].Url != "wss://ws2.example.com/stream" || len(ws[1].SubscribeMsgs) != 1 {
+		t.Errorf("Unexpected ws endpoints %+v", ws)
+	}
+	//解析等交易所方法仍由原探测实现
+	if _, err := measured.ParseServerTime(`{"time":1}`); err != nil {
+		t.Errorf("ParseServerTime failed: %v", err)
+	}
+
+	if _, wrapped := withEndpointVariants(probe, nil).(variantProbe); wrapped {
+		t.Error("Expected original probe without variants")
+	}
+}
+
+func TestRankEndpointVariants(t *testing.T) {
+	httpResult := func(url string, p50 int64, success int64) HttpLatencyResult {
+		r := HttpLatencyResult{Url: url, LatencyNs: p50, SuccessCount: success}
+		r.Stats = latency_stats.LatencyStats{P50Ns: p50}
+		return r
+	}
+	result := &ExchangeLatencyResult{
+		Http: map[string]HttpLatencyResult{
+			"spot":                httpResult("https://a.example.com/ping", 3000000, 5),
+			"spot@a1.example.com": httpResult("https://a1.example.com/ping", 1000000, 5),
+			"spot@a2.example.com": httpResult("https://a2.example.com/ping", 0, 0),
+			"future":              httpResult("https://f.example.com/ping", 500000, 5),
+		},
+	}
+	variants := map[string]endpointVariantGroup{"spot": {Http: []string{"a1.example.com", "a2.example.com"}}}
+
+	rankings := rankEndpointVariants(result, variants)
+	if len(rankings) != 1 || rankings[0].Product != "spot" || rankings[0].Transport != "http" {
+		t.Fatalf("Unexpected rankings %+v", rankings)
+	}
+	var hosts []string
+	for _, rank := range rankings[0].Ranks {
+		hosts = append(hosts, rank.Host)
+	}
+	//失败的主机排在最后
+	expected := []string{"a1.example.com", "a.example.com", "a2.example.com"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("Expected ranking %v, got %v", expected, hosts)
+	}
+}
@@ -0,0 +1,96 @@
+package p2p_latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// HTTP测试端点
+type HttpEndpoint struct {
+	Name           string //结果键, 如 spot / future
+	Url            string //延迟测试地址
+	ServerTimeUrl  string //服务器时间地址, 为空则不校准时间差
+	Body           string //非空时以JSON body POST请求延迟测试地址
+	ServerTimeBody string //非空时以JSON body POST请求服务器时间地址
+	//服务器时间精度, 为0时按毫秒
+	ServerTimeResolution time.Duration
+	Backend              string //固定解析的后端IP, 为空时由系统解析
+}
+
+// WebSocket测试端点
+type WsEndpoint struct {
+	Name           string   //结果键
+	Url            string   //连接地址
+	SubscribeMsgs  []string //连接后发送的订阅消息, 重连后自动重放
+	ServerTimeFrom string   //使用哪个HTTP端点或WS JSON-RPC端点的服务器时间差修正
+	Backend        string   //固定解析的后端IP, 为空时由系统解析
+}
+
+// 从行情消息中提取的时间戳及序号
+type WsTick struct {
+	Stream      string //stream / instId, 用于分流统计连续性
+	EventTimeNs int64  //交易所事件(推送)纳秒时间戳
+	Seq         WsSeq  //序号信息, Mode为WsSeqNone时不检查连续性
+	//撮合/成交纳秒时间戳(如币安T, Bybit cts), 为0表示行情只带一个时间
+	TransactTimeNs int64
+}
+
+// 交易所延迟测试定义, 新增交易所只需实现该接口并在init中注册
+type ExchangeProbe interface {
+	// 交易所名, 作为注册键及P2P/HTTP查询参数
+	Name() string
+	// HTTP测试端点
+	HttpEndpoints() []HttpEndpoint
+	// 解析服务器时间接口应答, 返回纳秒时间戳
+	ParseServerTime(body string) (int64, error)
+	// WebSocket测试端点及订阅消息
+	WsEndpoints() []WsEndpoint
+	// 从行情消息中提取时间戳, 非行情消息返回false
+	ExtractWsTick(msg string) (WsTick, bool)
+}
+
+// 可选: 通过WebSocket JSON-RPC校准时间及测量请求往返的交易所(如Deribit)
+// 结果按Name索引, 可作为WsEndpoint.ServerTimeFrom
+type WsRpcProber interface {
+	ProbeWsRpc() []WsRpcLatencyResult
+}
+
+// 可选: 支持WS下单延迟测试的交易所
+type WsOrderProber interface {
+	ProbeWsOrder() WsOrderLatencyResult
+}
+
+var (
+	exchangeProbesMu sync.RWMutex
+	exchangeProbes   = map[string]ExchangeProbe{}
+)
+
+// 注册交易所延迟测试, 重名时覆盖
+func RegisterExchangeProbe(probe ExchangeProbe) {
+	exchangeProbesMu.Lock()
+	defer exchangeProbesMu.Unlock()
+	exchangeProbes[probe.Name()] = probe
+}
+
+// 按名称获取交易所延迟测试
+func GetExchangeProbe(name string) (ExchangeProbe, bool) {
+	exchangeProbesMu.RLock()
+	defer exchangeProbesMu.RUnlock()
+	probe, ok := exchangeProbes[name]
+	return probe, ok
+}
+
+// 获取所有已注册的交易所延迟测试, 按名称排序
+func GetExchangeProbes() []ExchangeProbe {
+	exchangeProbesMu.RLock()
+	defer exchangeProbesMu.RUnlock()
+	probes := make([]ExchangeProbe, 0, len(exchangeProbes))
+	for _, probe := range exchangeProbes {
+		probes = append(probes, probe)
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		return probes[i].Name() < probes[j].Name()
+	})
+	return probes
+}
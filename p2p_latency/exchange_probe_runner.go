@@ -0,0 +1,420 @@
+package p2p_latency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+)
+
+// 交易所延迟测试结果, 各端点按HttpEndpoint/WsEndpoint.Name索引
+type ExchangeLatencyResult struct {
+	Exchange     string
+	UpdateTimeNs int64
+	Http         map[string]HttpLatencyResult
+	Ws           map[string]WsLatencyResult
+	WsRpc        map[string]WsRpcLatencyResult `json:",omitempty"` //仅实现WsRpcProber的交易所
+	WsOrder      *WsOrderLatencyResult         `json:",omitempty"` //未配置下单测试时为空
+	Clock        *clock_health.ClockHealth     `json:",omitempty"` //本节点时钟状况, 未开启时钟检查时为空
+	Rankings     []EndpointRanking             `json:",omitempty"` //配置了主机名变体的产品按延迟排名
+	Backends     []EndpointRanking             `json:",omitempty"` //开启后端IP展开时各端点按后端IP排名
+}
+
+// HTTP端点延迟结果
+type HttpLatencyResult struct {
+	Url                   string
+	Backend               string `json:",omitempty"` //固定解析的后端IP
+	LatencyNs             int64  //过滤后平均纳秒延迟
+	SuccessCount          int64
+	ServerTimeDiffNs      int64             //本地时间 - 服务器时间, 同ServerClock.OffsetNs
+	ServerClock           ServerClockOffset //服务器时间差估计及误差
+	latency_stats.Summary                   //过滤前后延迟分布
+}
+
+// WS端点延迟结果
+type WsLatencyResult struct {
+	Url          string
+	Backend      string `json:",omitempty"` //固定解析的后端IP
+	LatencyNs    int64  //本地收到时间 - 交易所事件时间(已修正服务器时间差)过滤后的平均值
+	SuccessCount int64
+	Seq          WsSeqResult //行情连续性, 持续测试模式下为最长窗口内统计
+	//服务器时间差估计误差, 单向延迟真实值在 LatencyNs ± ServerTimeUncertaintyNs 内
+	ServerTimeUncertaintyNs int64
+	latency_stats.Summary   //过滤前后延迟分布
+	//交易所内部发布耗时(事件时间E - 撮合时间T), 仅行情带T时有值, 与时钟差无关
+	//LatencyNs为 本地收到 - E, 即网络及本地协议栈耗时
+	PublishDelayNs int64                  `json:",omitempty"`
+	PublishDelay   *latency_stats.Summary `json:",omitempty"`
+	//按stream/instId拆分的延迟, 同一连接内对比不同交易对或频道
+	Streams map[string]WsStreamLatencyResult `json:",omitempty"`
+	//持续测试模式下主字段统计的窗口长度, 及各滚动窗口(如10s/1m/5m)的延迟
+	WindowNs int64                            `json:",omitempty"`
+	Windows  map[string]WsStreamLatencyResult `json:",omitempty"`
+}
+
+// 单个stream/instId或滚动窗口的WS延迟
+type WsStreamLatencyResult struct {
+	LatencyNs             int64 //过滤后的平均值
+	SuccessCount          int64
+	PublishDelayNs        int64 `json:",omitempty"` //过滤后的E - T平均值
+	latency_stats.Summary       //过滤前后延迟分布
+}
+
+// 按stream分别收集 本地收到 - E 及 E - T 样本
+type wsStreamSamplers struct {
+	latency *latency_stats.Sampler
+	publish *latency_stats.Sampler
+}
+
+// WS JSON-RPC端点结果
+type WsRpcLatencyResult struct {
+	Name                  string
+	Url                   string
+	RttNs                 int64 //过滤后请求往返平均耗时
+	SuccessCount          int64
+	ServerTimeDiffNs      int64             //本地时间 - 服务器时间, 同ServerClock.OffsetNs
+	ServerTimeRttNs       int64             //参与时间差估计样本的最大往返耗时
+	ServerClock           ServerClockOffset //服务器时间差估计及误差
+	latency_stats.Summary                   //过滤前后请求往返耗时分布
+}
+
+// 执行一次交易所HTTP及WebSocket延迟测试
+// 需由调用方先初始化libcurl全局环境(InitLibcurl及InitWebSocketLibcurl), 多个交易所可共用并发测试
+func RunExchangeProbe(probe ExchangeProbe) (*ExchangeLatencyResult, error) {
+	log.Debugf("开始测试%s HTTP和WebSocket延迟...", probe.Name())
+
+	settings := loadProbeSettings(probe.Name())
+	endpointProbe, variants := expandEndpoints(probe, settings)
+	result := &ExchangeLatencyResult{Exchange: probe.Name()}
+	serverClocks := runRequestProbes(probe, endpointProbe, settings, result)
+	result.Ws = runWsProbe(endpointProbe, serverClocks, settings)
+	finishExchangeResult(probe, result, variants)
+	return result, nil
+}
+
+// 按配置追加主机名变体及后端IP端点, 返回实际测试的端点集合
+func expandEndpoints(probe ExchangeProbe, settings ProbeSettings) (ExchangeProbe, map[string]endpointVariantGroup) {
+	//配置了主机名变体时, 各变体与原端点一同测试
+	variants := loadEndpointVariants(probe)
+	endpointProbe := withEndpointVariants(probe, variants)
+	//开启后端IP展开时, 每个端点的各A/AAAA记录分别固定解析测试
+	if settings.BackendFanout {
+		endpointProbe = withBackendFanout(endpointProbe, time.Duration(settings.HttpTimeoutMs)*time.Millisecond)
+	}
+	return endpointProbe, variants
+}
+
+// 执行HTTP、WS JSON-RPC及下单等请求应答类测试, 结果写入result
+// 返回各端点服务器时间差, 供WS行情延迟修正; probe为原交易所实现, 用于判断可选测试
+func runRequestProbes(probe ExchangeProbe, endpointProbe ExchangeProbe, settings ProbeSettings, result *ExchangeLatencyResult) map[string]ServerClockOffset {
+	result.Http = runHttpProbe(endpointProbe, settings)
+
+	serverClocks := make(map[string]ServerClockOffset)
+	for name, httpResult := range result.Http {
+		serverClocks[name] = httpResult.ServerClock
+	}
+	if rpcProber, ok := probe.(WsRpcProber); ok {
+		result.WsRpc = make(map[string]WsRpcLatencyResult)
+		for _, rpcResult := range rpcProber.ProbeWsRpc() {
+			trackServerClockDrift(probe.Name()+" "+rpcResult.Name, &rpcResult.ServerClock, time.Now().UnixNano())
+			result.WsRpc[rpcResult.Name] = rpcResult
+			serverClocks[rpcResult.Name] = rpcResult.ServerClock
+		}
+	}
+	if orderProber, ok := probe.(WsOrderProber); ok {
+		if orderResult := orderProber.ProbeWsOrder(); orderResult.ConnectLatencyNs > 0 {
+			result.WsOrder = &orderResult
+		}
+	}
+	return serverClocks
+}
+
+// 生成排名并输出测试结果
+func finishExchangeResult(probe ExchangeProbe, result *ExchangeLatencyResult, variants map[string]endpointVariantGroup) {
+	result.Rankings = rankEndpointVariants(result, variants)
+	result.Backends = rankBackends(result)
+	result.UpdateTimeNs = time.Now().UnixNano()
+
+	log.Debugf("==========%s测试结果========", probe.Name())
+	for _, ep := range probe.HttpEndpoints() {
+		http := result.Http[ep.Name]
+		log.Debugf("HTTP      %s %-10s: %.6f ms 分布: %+v 剔除: %d", probe.Name(), ep.Name, float64(http.LatencyNs)/1000000, http.Stats, http.Filter.Removed)
+	}
+	for name, rpc := range result.WsRpc {
+		log.Debugf("WS RPC    %s %-10s: %.6f ms 时间差: %.6f ± %.6f ms", probe.Name(), name, float64(rpc.RttNs)/1000000,
+			float64(rpc.ServerClock.OffsetNs)/1000000, float64(rpc.ServerClock.UncertaintyNs)/1000000)
+	}
+	for _, ep := range probe.WsEndpoints() {
+		ws := result.Ws[ep.Name]
+		log.Debugf("WebSocket %s %-10s: %.6f ± %.6f ms 分布: %+v 剔除: %d 连续性: %+v", probe.Name(), ep.Name, float64(ws.LatencyNs)/1000000,
+			float64(ws.ServerTimeUncertaintyNs)/1000000, ws.Stats, ws.Filter.Removed, ws.Seq)
+		if ws.PublishDelay != nil {
+			log.Debugf("          %s %-10s 交易所发布耗时(E-T): %.6f ms p99 %.6f ms", probe.Name(), ep.Name,
+				float64(ws.PublishDelayNs)/1000000, float64(ws.PublishDelay.Stats.P99Ns)/1000000)
+		}
+		for stream, streamResult := range ws.Streams {
+			log.Debugf("          %s %-10s %s: %.6f ms p99 %.6f ms (%d)", probe.Name(), ep.Name, stream,
+				float64(streamResult.LatencyNs)/1000000, float64(streamResult.Stats.P99Ns)/1000000, streamResult.SuccessCount)
+		}
+		for window, windowResult := range ws.Windows {
+			log.Debugf("          %s %-10s 窗口%s: %.6f ms p99 %.6f ms (%d)", probe.Name(), ep.Name, window,
+				float64(windowResult.LatencyNs)/1000000, float64(windowResult.Stats.P99Ns)/1000000, windowResult.SuccessCount)
+		}
+	}
+	for _, ranking := range append(result.Rankings, result.Backends...) {
+		for i, rank := range ranking.Ranks {
+			log.Debugf("排名 %s %s %-5s #%d %-28s p50 %.6f ms (%d)", probe.Name(), ranking.Product, ranking.Transport, i+1,
+				rank.Host, float64(rank.P50Ns)/1000000, rank.SuccessCount)
+		}
+	}
+	if result.WsOrder != nil {
+		log.Debugf("WebSocket %s ORDER     : %.6f ms", probe.Name(), float64(result.WsOrder.AckRttNs)/1000000)
+	}
+	log.Debug("=========================")
+}
+
+// 测试各HTTP端点延迟, 有服务器时间地址时先校准时间差
+func runHttpProbe(probe ExchangeProbe, settings ProbeSettings) map[string]HttpLatencyResult {
+	endpoints := probe.HttpEndpoints()
+	results := make([]HttpLatencyResult, len(endpoints))
+
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func(i int, ep HttpEndpoint) {
+			defer wg.Done()
+			name := probe.Name() + " " + ep.Name
+			result := &results[i]
+			result.Url = ep.Url
+			result.Backend = ep.Backend
+
+			client, err := http_client.NewClientLibcurl()
+			if err != nil {
+				log.Errorf("[%s] 创建HTTP客户端失败: %v", name, err)
+				return
+			}
+			defer client.Close()
+			if ep.Backend != "" {
+				if err := client.SetResolve(backendResolve(ep.Url, ep.Backend)); err != nil {
+					log.Errorf("[%s] 设置固定解析失败: %v", name, err)
+					return
+				}
+			}
+
+			if ep.ServerTimeUrl != "" {
+				result.ServerClock = measureServerClockOffset(client, probe, name, ep, settings)
+				trackServerClockDrift(name, &result.ServerClock, time.Now().UnixNano())
+				result.ServerTimeDiffNs = result.ServerClock.OffsetNs
+			}
+
+			time.Sleep(settings.HttpWarmup)
+			sampler := latency_stats.NewSampler()
+			stop := newSampleStop(settings.HttpSamples, settings.HttpDuration)
+			for attempts := int64(0); !stop.Done(attempts); attempts++ {
+				if attempts > 0 {
+					time.Sleep(settings.HttpInterval)
+				}
+				res := doHttpRequest(client, ep.Url, ep.Body, settings.HttpTimeoutMs)
+				if res.Error != "" {
+					observeProbeFailure(probe.Name(), transportHttp, ep.Name, classifyProbeError(res.Error))
+					continue
+				}
+				if res.StatusCode < 100 || res.StatusCode > 599 {
+					observeProbeFailure(probe.Name(), transportHttp, ep.Name, errorClassInvalidStatus)
+					continue
+				}
+				sampler.Record(res.LatencyNs)
+				observeProbeSample(probe.Name(), transportHttp, ep.Name, res.LatencyNs)
+				result.SuccessCount++
+			}
+			result.Summary = sampler.Summarize(settings.Filter)
+			result.LatencyNs = result.Stats.MeanNs
+		}(i, ep)
+	}
+	log.Info("开始等待HTTP测试完成")
+	start := time.Now()
+	wg.Wait()
+	log.Infof("HTTP测试完成，耗时:%v", time.Since(start))
+
+	resultMap := make(map[string]HttpLatencyResult, len(endpoints))
+	for i, ep := range endpoints {
+		resultMap[ep.Name] = results[i]
+	}
+	return resultMap
+}
+
+// body为空时GET, 否则以JSON body POST
+func doHttpRequest(client *http_client.ClientLibcurl, url string, body string, timeoutMs int) http_client.ResultLibcurl {
+	if body == "" {
+		return client.Get(url, timeoutMs, 0)
+	}
+	return client.Post(url, timeoutMs, 0, body, []string{"Content-Type: application/json"})
+}
+
+// 请求多次服务器时间, 按往返耗时最小的样本估计时间差
+func measureServerClockOffset(client *http_client.ClientLibcurl, probe ExchangeProbe, name string, ep HttpEndpoint, settings ProbeSettings) ServerClockOffset {
+	estimator := newServerClockEstimator(ep.ServerTimeResolution)
+	for i := 0; i < settings.ServerTimeSamples; i++ {
+		serverTimeRes := doHttpRequest(client, ep.ServerTimeUrl, ep.ServerTimeBody, settings.HttpTimeoutMs)
+		if serverTimeRes.Error != "" {
+			log.Errorf("[%s] 获取服务器时间差失败: %s", name, serverTimeRes.Error)
+			continue
+		}
+		if serverTimeRes.StatusCode != 200 {
+			continue
+		}
+		serverTimeNs, err := probe.ParseServerTime(serverTimeRes.ResponseBody)
+		if err != nil {
+			log.Errorf("[%s] 解析服务器时间差失败: [res:%s]%v", name, serverTimeRes.ResponseBody, err)
+			continue
+		}
+		estimator.Add(serverTimeRes.RequestTimeNs, serverTimeRes.ResponseTimeNs, serverTimeNs)
+	}
+
+	offset := estimator.Estimate()
+	log.Infof("[%s] 服务器%d次请求(取%d次最小往返)时间差: %d ns ≈ %.6f ± %.6f ms",
+		name, offset.SampleCount, offset.UsedCount, offset.OffsetNs, float64(offset.OffsetNs)/1000000, float64(offset.UncertaintyNs)/1000000)
+	return offset
+}
+
+// 测试各WebSocket端点行情延迟, 每个端点接收到配置的行情数或采集时长到期为止
+func runWsProbe(probe ExchangeProbe, serverClocks map[string]ServerClockOffset, settings ProbeSettings) map[string]WsLatencyResult {
+	endpoints := probe.WsEndpoints()
+	results := make([]WsLatencyResult, len(endpoints))
+	time.Sleep(settings.WsWarmup)
+
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func(i int, ep WsEndpoint) {
+			defer wg.Done()
+			result := &results[i]
+			result.Url = ep.Url
+			result.Backend = ep.Backend
+			serverClock := serverClocks[ep.ServerTimeFrom]
+			result.ServerTimeUncertaintyNs = serverClock.UncertaintyNs
+
+			// 独立读协程接收消息，收满后取消
+			streamCtx, streamCancel := context.WithCancel(context.Background())
+			defer streamCancel()
+			session, stream, ok := openWsStream(streamCtx, probe.Name(), ep, settings.WsTimeoutMs)
+			if !ok {
+				return
+			}
+			defer session.Close()
+
+			seqTracker := newWsSeqTracker()
+			sampler := latency_stats.NewSampler()
+			publishSampler := latency_stats.NewSampler()
+			streamSamplers := make(map[string]*wsStreamSamplers)
+			//接收到配置的行情数或采集时长到期
+			stop := newSampleStop(settings.WsMessages, settings.WsDuration)
+			expired := stop.Expired()
+		recvLoop:
+			for !stop.Done(result.SuccessCount) {
+				var frame http_client.WebSocketFrame
+				select {
+				case f, ok := <-stream.Frames():
+					if !ok {
+						break recvLoop
+					}
+					frame = f
+				case <-expired:
+					break recvLoop
+				}
+				if !frame.IsText {
+					continue
+				}
+				tick, ok := probe.ExtractWsTick(frame.Data)
+				if !ok {
+					continue // 跳过非行情消息
+				}
+				seqTracker.Observe(tick.Stream, tick.Seq, frame.RecvTimeNs)
+
+				targetLatency := wsTickLatency(frame, tick, serverClock)
+				sampler.Record(targetLatency)
+				observeProbeSample(probe.Name(), transportWs, ep.Name, targetLatency)
+				streamSampler, ok := streamSamplers[tick.Stream]
+				if !ok {
+					streamSampler = &wsStreamSamplers{latency: latency_stats.NewSampler(), publish: latency_stats.NewSampler()}
+					streamSamplers[tick.Stream] = streamSampler
+				}
+				streamSampler.latency.Record(targetLatency)
+				if tick.TransactTimeNs > 0 {
+					publishSampler.Record(tick.EventTimeNs - tick.TransactTimeNs)
+					streamSampler.publish.Record(tick.EventTimeNs - tick.TransactTimeNs)
+				}
+				result.SuccessCount++
+			}
+			result.Seq = seqTracker.Result()
+			result.Summary = sampler.Summarize(settings.Filter)
+			result.LatencyNs = result.Stats.MeanNs
+			if publishSampler.Count() > 0 {
+				publishDelay := publishSampler.Summarize(settings.Filter)
+				result.PublishDelay = &publishDelay
+				result.PublishDelayNs = publishDelay.Stats.MeanNs
+			}
+			result.Streams = make(map[string]WsStreamLatencyResult, len(streamSamplers))
+			for stream, streamSampler := range streamSamplers {
+				streamResult := WsStreamLatencyResult{
+					SuccessCount: streamSampler.latency.Count(),
+					Summary:      streamSampler.latency.Summarize(settings.Filter),
+				}
+				streamResult.LatencyNs = streamResult.Stats.MeanNs
+				if streamSampler.publish.Count() > 0 {
+					streamResult.PublishDelayNs = streamSampler.publish.Summarize(settings.Filter).Stats.MeanNs
+				}
+				result.Streams[stream] = streamResult
+			}
+		}(i, ep)
+	}
+
+	log.Info("开始等待WS测试完成")
+	start := time.Now()
+	wg.Wait()
+	log.Infof("WS测试完成，耗时:%v", time.Since(start))
+
+	resultMap := make(map[string]WsLatencyResult, len(endpoints))
+	for i, ep := range endpoints {
+		resultMap[ep.Name] = results[i]
+	}
+	return resultMap
+}
+
+// 创建自动重连的WebSocket会话, 建立连接并发送订阅消息后开始读取
+// 失败时会话已关闭, 返回false
+func openWsStream(ctx context.Context, exchange string, ep WsEndpoint, timeoutMs int) (*http_client.WebSocketSessionLibcurl, *http_client.WebSocketStream, bool) {
+	name := exchange + " " + ep.Name
+	session := newWsSession(name, ep.Url, timeoutMs, backendResolve(ep.Url, ep.Backend))
+
+	// 建立连接
+	res := session.Connect()
+	if res.Error != "" {
+		log.Errorf("[%s] 连接失败: %s", name, res.Error)
+		observeProbeFailure(exchange, transportWs, ep.Name, classifyProbeError(res.Error))
+		session.Close()
+		return nil, nil, false
+	}
+	log.Debugf("[%s] 握手耗时: DNS %dns TCP %dns TLS %dns Upgrade %dns 总计 %dns", name,
+		res.DNSTimeNs, res.TCPTimeNs, res.TLSTimeNs, res.UpgradeTimeNs, res.LatencyNs)
+
+	//连接成功后发送订阅消息
+	for _, msg := range ep.SubscribeMsgs {
+		if err := session.Subscribe(msg); err != nil {
+			log.Errorf("[%s] 发送订阅消息失败: %v", name, err)
+			observeProbeFailure(exchange, transportWs, ep.Name, errorClassSubscribe)
+			session.Close()
+			return nil, nil, false
+		}
+		log.Infof("[%s] 发送订阅消息成功", name)
+	}
+	return session, session.Stream(ctx, http_client.WebSocketStreamOptions{}), true
+}
+
+// 本地收到时间 - 交易所事件时间, 时间差为本地 - 服务器, 先将本地收到时间换算为服务器时间
+func wsTickLatency(frame http_client.WebSocketFrame, tick WsTick, serverClock ServerClockOffset) int64 {
+	return frame.RecvTimeNs - serverClock.OffsetNs - tick.EventTimeNs
+}
@@ -0,0 +1,314 @@
+package p2p_latency
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/gorilla/websocket"
+)
+
+// 测试各交易所通过init注册
+func TestExchangeProbeRegistry(t *testing.T) {
+	for _, name := range []string{"binance", "bybit", "deribit", "hyperliquid", "okx"} {
+		probe, ok := GetExchangeProbe(name)
+		if !ok || probe.Name() != name {
+			t.Errorf("Expected %s probe registered", name)
+		}
+	}
+	probes := GetExchangeProbes()
+	for i := 1; i < len(probes); i++ {
+		if probes[i-1].Name() >= probes[i].Name() {
+			t.Errorf("Probes not sorted: %s >= %s", probes[i-1].Name(), probes[i].Name())
+		}
+	}
+}
+
+// 测试服务器时间解析
+func TestExchangeProbeParseServerTime(t *testing.T) {
+	cases := []struct {
+		probe ExchangeProbe
+		body  string
+	}{
+		{binanceProbe{}, `{"serverTime":1700000000123}`},
+		{okxProbe{}, `{"code":"0","data":[{"ts":"1700000000123"}],"msg":""}`},
+		{hyperliquidProbe{}, `{"coin":"BTC","time":1700000000123,"levels":[[{"px":"30000","sz":"1","n":1}],[{"px":"30001","sz":"1","n":1}]]}`},
+		{bybitProbe{}, `{"retCode":0,"retMsg":"OK","result":{"timeSecond":"1700000000","timeNano":"1700000000123000000"},"time":1700000000123}`},
+	}
+	for _, c := range cases {
+		serverTimeNs, err := c.probe.ParseServerTime(c.body)
+		if err != nil || serverTimeNs != 1700000000123*1000000 {
+			t.Errorf("[%s] unexpected server time %d, err %v", c.probe.Name(), serverTimeNs, err)
+		}
+		if _, err := c.probe.ParseServerTime(`{}`); err == nil {
+			t.Errorf("[%s] expected error on empty body", c.probe.Name())
+		}
+	}
+}
+
+// 测试行情时间戳及序号提取
+func TestExchangeProbeExtractWsTick(t *testing.T) {
+	cases := []struct {
+		probe ExchangeProbe
+		msg   string
+		ok    bool
+		tick  WsTick
+	}{
+		{binanceProbe{}, `{"stream":"btcusdt@depth@100ms","data":{"e":"depthUpdate","E":1700000000123,"U":100,"u":105}}`, true,
+			WsTick{Stream: "btcusdt@depth@100ms", EventTimeNs: 1700000000123000000, Seq: WsSeq{Mode: WsSeqRange, FirstId: 100, LastId: 105}}},
+		{binanceProbe{}, `{"stream":"btcusdt@depth@0ms","data":{"e":"depthUpdate","E":1700000000123,"U":100,"u":105,"pu":99}}`, true,
+			WsTick{Stream: "btcusdt@depth@0ms", EventTimeNs: 1700000000123000000, Seq: WsSeq{Mode: WsSeqPrevLinked, FirstId: 100, LastId: 105, PrevId: 99}}},
+		{binanceProbe{}, `{"stream":"btcusdt@depth@0ms","data":{"e":"depthUpdate","E":1700000000125,"T":1700000000123,"U":100,"u":105,"pu":99}}`, true,
+			WsTick{Stream: "btcusdt@depth@0ms", EventTimeNs: 1700000000125000000, Seq: WsSeq{Mode: WsSeqPrevLinked, FirstId: 100, LastId: 105, PrevId: 99}, TransactTimeNs: 1700000000123000000}},
+		{binanceProbe{}, `{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","E":1700000000125,"a":5933014,"p":"30000","q":"1","f":100,"l":105,"T":1700000000124,"m":true}}`, true,
+			WsTick{Stream: "btcusdt@aggTrade", EventTimeNs: 1700000000125000000, TransactTimeNs: 1700000000124000000}},
+		{binanceProbe{}, `{"result":null,"id":1}`, false, WsTick{}},
+		{okxProbe{}, `{"arg":{"channel":"bbo-tbt","instId":"BTC-USDT"},"data":[{"asks":[],"bids":[],"ts":"1700000000123","seqId":42}]}`, true,
+			WsTick{Stream: "BTC-USDT", EventTimeNs: 1700000000123000000, Seq: WsSeq{Mode: WsSeqMonotonic, FirstId: 42, LastId: 42}}},
+		{okxProbe{}, `{"arg":{"channel":"books","instId":"BTC-USDT"},"data":[{"ts":"1700000000123","seqId":42,"prevSeqId":40}]}`, true,
+			WsTick{Stream: "BTC-USDT", EventTimeNs: 1700000000123000000, Seq: WsSeq{Mode: WsSeqPrevLinked, FirstId: 42, LastId: 42, PrevId: 40}}},
+		{okxProbe{}, `{"event":"subscribe","arg":{"channel":"bbo-tbt","instId":"BTC-USDT"}}`, false, WsTick{}},
+		{bybitProbe{}, `{"topic":"orderbook.1.BTCUSDT","type":"snapshot","ts":1700000000125,"data":{"s":"BTCUSDT","b":[["30000","1"]],"a":[["30001","1"]],"u":1234,"seq":99},"cts":1700000000123}`, true,
+			WsTick{Stream: "orderbook.1.BTCUSDT", EventTimeNs: 1700000000125000000, Seq: WsSeq{Mode: WsSeqMonotonic, FirstId: 1234, LastId: 1234}, TransactTimeNs: 1700000000123000000}},
+		{bybitProbe{}, `{"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":1700000000123,"data":[{"T":1700000000122,"s":"BTCUSDT","S":"Buy","v":"0.001","p":"30000"}]}`, true,
+			WsTick{Stream: "publicTrade.BTCUSDT", EventTimeNs: 1700000000123000000, TransactTimeNs: 1700000000122000000}},
+		{hyperliquidProbe{}, `{"channel":"l2Book","data":{"coin":"BTC","time":1700000000123,"levels":[[],[]]}}`, true,
+			WsTick{Stream: "l2Book.BTC", EventTimeNs: 1700000000123000000}},
+		{hyperliquidProbe{}, `{"channel":"trades","data":[{"coin":"ETH","side":"B","px":"2000","sz":"1","hash":"0x0","time":1700000000123,"tid":1}]}`, true,
+			WsTick{Stream: "trades.ETH", EventTimeNs: 1700000000123000000}},
+		{hyperliquidProbe{}, `{"channel":"subscriptionResponse","data":{"method":"subscribe","subscription":{"type":"l2Book","coin":"BTC"}}}`, false, WsTick{}},
+		{bybitProbe{}, `{"success":true,"ret_msg":"subscribe","conn_id":"x","op":"subscribe"}`, false, WsTick{}},
+	}
+	for i, c := range cases {
+		tick, ok := c.probe.ExtractWsTick(c.msg)
+		if ok != c.ok || tick != c.tick {
+			t.Errorf("case %d [%s]: got %+v %v, expected %+v %v", i, c.probe.Name(), tick, ok, c.tick, c.ok)
+		}
+	}
+}
+
+// 本地模拟交易所, 仅用于测试通用WS测试流程
+type localTestProbe struct {
+	wsUrl          string
+	serverTimeFrom string
+	httpEndpoints  []HttpEndpoint
+}
+
+func (p localTestProbe) Name() string                  { return "local" }
+func (p localTestProbe) HttpEndpoints() []HttpEndpoint { return p.httpEndpoints }
+func (p localTestProbe) ParseServerTime(body string) (int64, error) {
+	var serverTime struct {
+		Time int64 `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(body), &serverTime); err != nil || serverTime.Time == 0 {
+		return 0, fmt.Errorf("invalid body: %s", body)
+	}
+	return serverTime.Time * 1000000, nil
+}
+func (p localTestProbe) WsEndpoints() []WsEndpoint {
+	return []WsEndpoint{{Name: "public", Url: p.wsUrl, SubscribeMsgs: []string{`{"op":"subscribe"}`}, ServerTimeFrom: p.serverTimeFrom}}
+}
+func (p localTestProbe) ExtractWsTick(msg string) (WsTick, bool) {
+	var tick struct {
+		Stream string `json:"stream"`
+		Ts     int64  `json:"ts"`
+		T      int64  `json:"T"`
+		Seq    int64  `json:"seq"`
+	}
+	if err := json.Unmarshal([]byte(msg), &tick); err != nil || tick.Ts == 0 {
+		return WsTick{}, false
+	}
+	if tick.Stream == "" {
+		tick.Stream = "test"
+	}
+	return WsTick{Stream: tick.Stream, EventTimeNs: tick.Ts, TransactTimeNs: tick.T, Seq: WsSeq{Mode: WsSeqRange, FirstId: tick.Seq, LastId: tick.Seq}}, true
+}
+
+// 测试通用HTTP测试流程: 带body的端点以POST请求并据此校准时间差
+func TestRunHttpProbePost(t *testing.T) {
+	if err := http_client.InitLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupLibcurl()
+
+	//模拟服务端时钟比本地慢300ms
+	const serverLag = 300 * time.Millisecond
+	var postCount int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || string(body) != `{"type":"l2Book","coin":"BTC"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt64(&postCount, 1)
+		fmt.Fprintf(w, `{"coin":"BTC","time":%d,"levels":[[],[]]}`, time.Now().Add(-serverLag).UnixMilli())
+	}))
+	defer server.Close()
+
+	probe := localTestProbe{httpEndpoints: []HttpEndpoint{{
+		Name:           "info",
+		Url:            server.URL,
+		Body:           `{"type":"l2Book","coin":"BTC"}`,
+		ServerTimeUrl:  server.URL,
+		ServerTimeBody: `{"type":"l2Book","coin":"BTC"}`,
+	}}}
+	result := runHttpProbe(probe, testProbeSettings())["info"]
+	if result.SuccessCount != 5 || atomic.LoadInt64(&postCount) != 10 {
+		t.Errorf("Expected 5 latency and 10 total POSTs, got %d / %d", result.SuccessCount, postCount)
+	}
+	if result.LatencyNs <= 0 {
+		t.Errorf("Expected positive latency, got %d", result.LatencyNs)
+	}
+	if result.Stats.Count != 5 || result.Stats.MinNs <= 0 {
+		t.Errorf("Unexpected latency distribution %+v", result.Stats)
+	}
+	//服务器时间为毫秒精度
+	if diff := result.ServerTimeDiffNs - int64(serverLag); diff < -int64(5*time.Millisecond) || diff > int64(5*time.Millisecond) {
+		t.Errorf("Expected server time diff ≈ %d ns, got %d ns", int64(serverLag), result.ServerTimeDiffNs)
+	}
+	if result.ServerClock.UsedCount == 0 || result.ServerClock.UncertaintyNs < int64(time.Millisecond) {
+		t.Errorf("Expected millisecond-resolution uncertainty, got %+v", result.ServerClock)
+	}
+}
+
+// 测试通用WS测试流程: 订阅后统计延迟及序号缺口
+func TestRunWsProbe(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"subscribe"}`))
+		for seq := 1; seq <= 600; seq++ {
+			if seq == 100 {
+				continue //制造一次缺口
+			}
+			msg := `{"ts":` + strconv.FormatInt(time.Now().UnixNano()-int64(time.Millisecond), 10) + `,"seq":` + strconv.Itoa(seq) + `}`
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+		conn.ReadMessage()
+	})
+	defer closeServer()
+
+	results := runWsProbe(localTestProbe{wsUrl: url}, nil, testProbeSettings())
+	result := results["public"]
+	if result.SuccessCount != 500 {
+		t.Errorf("Expected 500 ticks, got %d", result.SuccessCount)
+	}
+	if result.LatencyNs < int64(time.Millisecond) || result.LatencyNs > int64(time.Second) {
+		t.Errorf("Unexpected latency %d ns", result.LatencyNs)
+	}
+	if result.Seq.GapCount != 1 || result.Seq.MissedUpdates != 1 {
+		t.Errorf("Expected 1 gap with 1 missed update, got %+v", result.Seq)
+	}
+	stats := result.Stats
+	if stats.Count != 500 || stats.MinNs > stats.P50Ns || stats.P50Ns > stats.P99Ns || stats.P99Ns > stats.MaxNs {
+		t.Errorf("Unexpected latency distribution %+v", stats)
+	}
+}
+
+// 测试按服务器时间差修正WS延迟: 本地时钟比服务器快300ms时, 结果不应包含该偏差
+func TestRunWsProbeServerClock(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	//服务器时间 = 本地时间 - 300ms, 行情在本地发出前1ms产生
+	const serverLag = 300 * time.Millisecond
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for seq := 1; seq <= 100; seq++ {
+			eventTime := time.Now().Add(-serverLag - time.Millisecond).UnixNano()
+			msg := `{"ts":` + strconv.FormatInt(eventTime, 10) + `,"seq":` + strconv.Itoa(seq) + `}`
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+		conn.ReadMessage()
+	})
+	defer closeServer()
+
+	settings := testProbeSettings()
+	settings.WsMessages = 50
+	serverClocks := map[string]ServerClockOffset{"time": {OffsetNs: int64(serverLag), UncertaintyNs: int64(time.Millisecond)}}
+	result := runWsProbe(localTestProbe{wsUrl: url, serverTimeFrom: "time"}, serverClocks, settings)["public"]
+	if result.SuccessCount != 50 {
+		t.Fatalf("Expected 50 ticks, got %d", result.SuccessCount)
+	}
+	if result.LatencyNs < int64(time.Millisecond) || result.LatencyNs > int64(100*time.Millisecond) {
+		t.Errorf("Expected latency ≈ 1ms after offset correction, got %.3f ms", float64(result.LatencyNs)/1e6)
+	}
+	if result.ServerTimeUncertaintyNs != int64(time.Millisecond) {
+		t.Errorf("Expected uncertainty from server clock, got %d", result.ServerTimeUncertaintyNs)
+	}
+}
+
+// 测试同一连接内按stream拆分延迟统计
+func TestRunWsProbeStreams(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	//btcusdt事件时间早1ms, dogeusdt早20ms
+	delays := map[string]time.Duration{"btcusdt@depth": time.Millisecond, "dogeusdt@depth": 20 * time.Millisecond}
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for seq := 1; seq <= 100; seq++ {
+			for stream, delay := range delays {
+				eventTime := time.Now().Add(-delay).UnixNano()
+				msg := `{"stream":"` + stream + `","ts":` + strconv.FormatInt(eventTime, 10) + `,"seq":` + strconv.Itoa(seq) + `}`
+				if stream == "btcusdt@depth" {
+					//撮合到推送耗时3ms
+					msg = `{"stream":"` + stream + `","ts":` + strconv.FormatInt(eventTime, 10) + `,"T":` + strconv.FormatInt(eventTime-int64(3*time.Millisecond), 10) + `,"seq":` + strconv.Itoa(seq) + `}`
+				}
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+					return
+				}
+			}
+		}
+		conn.ReadMessage()
+	})
+	defer closeServer()
+
+	settings := testProbeSettings()
+	settings.WsMessages = 200
+	result := runWsProbe(localTestProbe{wsUrl: url}, nil, settings)["public"]
+	if len(result.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %+v", result.Streams)
+	}
+	btc, doge := result.Streams["btcusdt@depth"], result.Streams["dogeusdt@depth"]
+	if btc.SuccessCount != 100 || doge.SuccessCount != 100 || btc.Stats.Count != 100 {
+		t.Errorf("Expected 100 ticks per stream, got %d / %d", btc.SuccessCount, doge.SuccessCount)
+	}
+	if doge.LatencyNs-btc.LatencyNs < int64(15*time.Millisecond) {
+		t.Errorf("Expected dogeusdt ~19ms slower than btcusdt, got %d / %d ns", doge.LatencyNs, btc.LatencyNs)
+	}
+	if result.Seq.GapCount != 0 {
+		t.Errorf("Expected no gaps with per-stream sequences, got %+v", result.Seq)
+	}
+	//E - T仅统计带T的stream
+	if result.PublishDelay == nil || result.PublishDelay.Stats.Count != 100 || result.PublishDelayNs != int64(3*time.Millisecond) {
+		t.Errorf("Expected 3ms publish delay from 100 ticks, got %d / %+v", result.PublishDelayNs, result.PublishDelay)
+	}
+	if btc.PublishDelayNs != int64(3*time.Millisecond) || doge.PublishDelayNs != 0 {
+		t.Errorf("Unexpected per-stream publish delay %d / %d", btc.PublishDelayNs, doge.PublishDelayNs)
+	}
+}
@@ -0,0 +1,304 @@
+package p2p_latency
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/config"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+)
+
+// 持续测试模式设置
+type StreamingSettings struct {
+	Enabled         bool            //false时回退到定时快照测试
+	Windows         []time.Duration //滚动窗口, 升序, 主字段按最长窗口统计
+	PublishInterval time.Duration   //发布滚动窗口统计的间隔
+}
+
+// 读取配置 streaming.*, 默认开启, 窗口10s/1m/5m, 每10s发布一次
+func loadStreamingSettings() StreamingSettings {
+	s := StreamingSettings{
+		Enabled:         true,
+		Windows:         []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute},
+		PublishInterval: 10 * time.Second,
+	}
+	if config.GetConfig("streaming.enabled") != "" {
+		s.Enabled = config.GetConfigBool("streaming.enabled")
+	}
+	if windowsMs := config.GetConfigSlice("streaming.windows_ms"); len(windowsMs) > 0 {
+		var windows []time.Duration
+		for _, v := range windowsMs {
+			ms, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || ms <= 0 {
+				log.Warnf("忽略无效的滚动窗口配置: %s", v)
+				continue
+			}
+			windows = append(windows, time.Duration(ms)*time.Millisecond)
+		}
+		if len(windows) > 0 {
+			sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+			s.Windows = windows
+		}
+	}
+	if ms := config.GetConfigInt("streaming.publish_interval_ms"); ms > 0 {
+		s.PublishInterval = time.Duration(ms) * time.Millisecond
+	}
+	return s
+}
+
+// 窗口名, 如 10s / 1m / 5m / 1h
+func windowName(d time.Duration) string {
+	name := d.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = strings.TrimSuffix(name, "0s")
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = strings.TrimSuffix(name, "0m")
+	}
+	return name
+}
+
+// 单个交易所的持续测试: WS保持长连接按滚动窗口统计, HTTP等请求类测试按刷新间隔执行
+type exchangeStream struct {
+	probe         ExchangeProbe //原交易所实现, 用于判断可选测试及输出
+	endpointProbe ExchangeProbe //含变体及后端IP的实际测试端点
+	variants      map[string]endpointVariantGroup
+	settings      ProbeSettings
+	streaming     StreamingSettings
+
+	mu           sync.RWMutex
+	requests     ExchangeLatencyResult //最近一次请求类测试结果(Http/WsRpc/WsOrder)
+	serverClocks map[string]ServerClockOffset
+
+	endpoints []*wsEndpointStream
+}
+
+// 单个WS端点的滚动统计
+type wsEndpointStream struct {
+	ep        WsEndpoint
+	maxWindow time.Duration
+
+	mu      sync.Mutex
+	latency *latency_stats.RollingSampler
+	publish *latency_stats.RollingSampler
+	streams map[string]*wsStreamRolling
+	seq     *wsSeqTracker
+	//每次汇总时的连续性累计值, 按窗口起点前最近一次相减得到窗口内统计
+	seqSnapshots []wsSeqSnapshot
+}
+
+type wsSeqSnapshot struct {
+	timeNs     int64
+	total      WsSeqResult
+	maxStallNs int64 //与上一次汇总之间的最长消息间隔
+}
+
+// 单个stream/instId的滚动统计
+type wsStreamRolling struct {
+	latency *latency_stats.RollingSampler
+	publish *latency_stats.RollingSampler
+}
+
+func newExchangeStream(probe ExchangeProbe, settings ProbeSettings, streaming StreamingSettings) *exchangeStream {
+	endpointProbe, variants := expandEndpoints(probe, settings)
+	s := &exchangeStream{
+		probe:         probe,
+		endpointProbe: endpointProbe,
+		variants:      variants,
+		settings:      settings,
+		streaming:     streaming,
+		serverClocks:  make(map[string]ServerClockOffset),
+	}
+	maxWindow := streaming.Windows[len(streaming.Windows)-1]
+	for _, ep := range endpointProbe.WsEndpoints() {
+		s.endpoints = append(s.endpoints, &wsEndpointStream{
+			ep:        ep,
+			maxWindow: maxWindow,
+			latency:   latency_stats.NewRollingSampler(maxWindow),
+			publish:   latency_stats.NewRollingSampler(maxWindow),
+			streams:   make(map[string]*wsStreamRolling),
+			seq:       newWsSeqTracker(),
+		})
+	}
+	return s
+}
+
+// 执行一次请求类测试, 更新HTTP等结果及WS修正所用的服务器时间差
+func (s *exchangeStream) refresh() {
+	var requests ExchangeLatencyResult
+	serverClocks := runRequestProbes(s.probe, s.endpointProbe, s.settings, &requests)
+	s.mu.Lock()
+	s.requests = requests
+	s.serverClocks = serverClocks
+	s.mu.Unlock()
+}
+
+func (s *exchangeStream) serverClock(from string) ServerClockOffset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.serverClocks[from]
+}
+
+// 保持各WS端点长连接直到ctx结束, 会话异常结束时重新建立
+func (s *exchangeStream) runWs(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, es := range s.endpoints {
+		wg.Add(1)
+		go func(es *wsEndpointStream) {
+			defer wg.Done()
+			name := s.probe.Name() + " " + es.ep.Name
+			backoff := time.Second
+			for ctx.Err() == nil {
+				if s.consumeWs(ctx, name, es) {
+					backoff = time.Second
+				} else if backoff < time.Minute {
+					backoff *= 2
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(backoff):
+					log.Warnf("[%s] 重新建立WS会话", name)
+				}
+			}
+		}(es)
+	}
+	wg.Wait()
+}
+
+// 持续接收单个端点行情直到会话结束, 返回是否曾成功建立连接
+func (s *exchangeStream) consumeWs(ctx context.Context, name string, es *wsEndpointStream) bool {
+	session, stream, ok := openWsStream(ctx, s.probe.Name(), es.ep, s.settings.WsTimeoutMs)
+	if !ok {
+		return false
+	}
+	defer session.Close()
+	for frame := range stream.Frames() {
+		if !frame.IsText {
+			continue
+		}
+		tick, ok := s.endpointProbe.ExtractWsTick(frame.Data)
+		if !ok {
+			continue // 跳过非行情消息
+		}
+		latency := wsTickLatency(frame, tick, s.serverClock(es.ep.ServerTimeFrom))
+		es.record(frame.RecvTimeNs, tick, latency)
+		observeProbeSample(s.probe.Name(), transportWs, es.ep.Name, latency)
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		log.Warnf("[%s] WS会话结束: %v", name, err)
+	}
+	return true
+}
+
+func (es *wsEndpointStream) record(recvNs int64, tick WsTick, latency int64) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.seq.Observe(tick.Stream, tick.Seq, recvNs)
+	es.latency.Record(recvNs, latency)
+	stream, ok := es.streams[tick.Stream]
+	if !ok {
+		stream = &wsStreamRolling{
+			latency: latency_stats.NewRollingSampler(es.maxWindow),
+			publish: latency_stats.NewRollingSampler(es.maxWindow),
+		}
+		es.streams[tick.Stream] = stream
+	}
+	stream.latency.Record(recvNs, latency)
+	if tick.TransactTimeNs > 0 {
+		es.publish.Record(recvNs, tick.EventTimeNs-tick.TransactTimeNs)
+		stream.publish.Record(recvNs, tick.EventTimeNs-tick.TransactTimeNs)
+	}
+}
+
+// 按各滚动窗口汇总, 主字段及按stream拆分的统计使用最长窗口
+func (es *wsEndpointStream) result(nowNs int64, windows []time.Duration, filter latency_stats.Filter) WsLatencyResult {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	longest := windows[len(windows)-1]
+	result := WsLatencyResult{
+		Url:      es.ep.Url,
+		Backend:  es.ep.Backend,
+		Seq:      es.windowSeq(nowNs, longest),
+		WindowNs: int64(longest),
+		Summary:  es.latency.Summarize(nowNs, longest, filter),
+	}
+	result.SuccessCount = result.RawStats.Count
+	result.LatencyNs = result.Stats.MeanNs
+	if publishDelay := es.publish.Summarize(nowNs, longest, filter); publishDelay.RawStats.Count > 0 {
+		result.PublishDelay = &publishDelay
+		result.PublishDelayNs = publishDelay.Stats.MeanNs
+	}
+
+	result.Windows = make(map[string]WsStreamLatencyResult, len(windows))
+	for _, window := range windows {
+		windowResult := WsStreamLatencyResult{Summary: es.latency.Summarize(nowNs, window, filter)}
+		windowResult.SuccessCount = windowResult.RawStats.Count
+		windowResult.LatencyNs = windowResult.Stats.MeanNs
+		if publishDelay := es.publish.Summarize(nowNs, window, filter); publishDelay.RawStats.Count > 0 {
+			windowResult.PublishDelayNs = publishDelay.Stats.MeanNs
+		}
+		result.Windows[windowName(window)] = windowResult
+	}
+
+	result.Streams = make(map[string]WsStreamLatencyResult, len(es.streams))
+	for name, stream := range es.streams {
+		streamResult := WsStreamLatencyResult{Summary: stream.latency.Summarize(nowNs, longest, filter)}
+		if streamResult.RawStats.Count == 0 {
+			continue
+		}
+		streamResult.SuccessCount = streamResult.RawStats.Count
+		streamResult.LatencyNs = streamResult.Stats.MeanNs
+		if publishDelay := stream.publish.Summarize(nowNs, longest, filter); publishDelay.RawStats.Count > 0 {
+			streamResult.PublishDelayNs = publishDelay.Stats.MeanNs
+		}
+		result.Streams[name] = streamResult
+	}
+	return result
+}
+
+// 窗口内的行情连续性, 以发布间隔为粒度: 累计值减去窗口起点前最近一次汇总的累计值
+func (es *wsEndpointStream) windowSeq(nowNs int64, window time.Duration) WsSeqResult {
+	current := wsSeqSnapshot{timeNs: nowNs, total: es.seq.Result(), maxStallNs: es.seq.TakeMaxStall()}
+	es.seqSnapshots = append(es.seqSnapshots, current)
+	startNs := nowNs - int64(window)
+	//窗口起点前只保留最近一次作为基准
+	for len(es.seqSnapshots) > 1 && es.seqSnapshots[1].timeNs <= startNs {
+		es.seqSnapshots = es.seqSnapshots[1:]
+	}
+
+	inWindow := es.seqSnapshots
+	var base WsSeqResult
+	if es.seqSnapshots[0].timeNs <= startNs {
+		base = es.seqSnapshots[0].total
+		inWindow = es.seqSnapshots[1:]
+	}
+	result := current.total.sub(base)
+	for _, snapshot := range inWindow {
+		if snapshot.maxStallNs > result.MaxStallNs {
+			result.MaxStallNs = snapshot.maxStallNs
+		}
+	}
+	return result
+}
+
+// 合并最近一次请求类测试结果及WS滚动窗口统计
+func (s *exchangeStream) snapshot(nowNs int64) *ExchangeLatencyResult {
+	s.mu.RLock()
+	result := s.requests
+	serverClocks := s.serverClocks
+	s.mu.RUnlock()
+
+	result.Exchange = s.probe.Name()
+	result.Ws = make(map[string]WsLatencyResult, len(s.endpoints))
+	for _, es := range s.endpoints {
+		wsResult := es.result(nowNs, s.streaming.Windows, s.settings.Filter)
+		wsResult.ServerTimeUncertaintyNs = serverClocks[es.ep.ServerTimeFrom].UncertaintyNs
+		result.Ws[es.ep.Name] = wsResult
+	}
+	finishExchangeResult(s.probe, &result, s.variants)
+	return &result
+}
@@ -0,0 +1,169 @@
+package p2p_latency
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+func TestWindowName(t *testing.T) {
+	cases := map[time.Duration]string{
+		10 * time.Second:       "10s",
+		time.Minute:            "1m",
+		5 * time.Minute:        "5m",
+		90 * time.Second:       "1m30s",
+		time.Hour:              "1h",
+		200 * time.Millisecond: "200ms",
+	}
+	for d, expected := range cases {
+		if got := windowName(d); got != expected {
+			t.Errorf("windowName(%v) = %s, expected %s", d, got, expected)
+		}
+	}
+}
+
+func TestLoadStreamingSettings(t *testing.T) {
+	defaults := loadStreamingSettings()
+	if !defaults.Enabled || len(defaults.Windows) != 3 || defaults.PublishInterval != 10*time.Second {
+		t.Errorf("Unexpected default streaming settings %+v", defaults)
+	}
+
+	values := map[string]interface{}{
+		"streaming.enabled":             false,
+		"streaming.windows_ms":          []string{"60000", "x", "5000"},
+		"streaming.publish_interval_ms": 2000,
+	}
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	defer func() {
+		for key := range values {
+			viper.Set(key, nil)
+		}
+	}()
+	s := loadStreamingSettings()
+	if s.Enabled || s.PublishInterval != 2*time.Second {
+		t.Errorf("Unexpected streaming settings %+v", s)
+	}
+	//无效项被忽略, 窗口升序
+	if expected := []time.Duration{5 * time.Second, time.Minute}; !reflect.DeepEqual(s.Windows, expected) {
+		t.Errorf("Expected windows %v, got %v", expected, s.Windows)
+	}
+}
+
+// 长连接持续接收, 短窗口只统计最近的行情
+func TestExchangeStreamWindows(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	send := func(conn *websocket.Conn, from int, count int, delay time.Duration) bool {
+		for seq := from; seq < from+count; seq++ {
+			eventTime := time.Now().Add(-delay).UnixNano()
+			msg := `{"ts":` + strconv.FormatInt(eventTime, 10) + `,"T":` + strconv.FormatInt(eventTime-int64(2*time.Millisecond), 10) + `,"seq":` + strconv.Itoa(seq) + `}`
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		//先发送50条延迟20ms的行情, 间隔后再发送50条延迟1ms的行情
+		if !send(conn, 1, 50, 20*time.Millisecond) {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+		if !send(conn, 51, 50, time.Millisecond) {
+			return
+		}
+		conn.ReadMessage()
+	})
+	defer closeServer()
+
+	streaming := StreamingSettings{Enabled: true, Windows: []time.Duration{300 * time.Millisecond, 5 * time.Second}, PublishInterval: time.Second}
+	stream := newExchangeStream(localTestProbe{wsUrl: url}, testProbeSettings(), streaming)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		stream.runWs(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stream.endpoints[0].latency.Total() < 100 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	result := stream.snapshot(time.Now().UnixNano()).Ws["public"]
+	if result.WindowNs != int64(5*time.Second) || result.SuccessCount != 100 {
+		t.Fatalf("Expected 100 ticks in longest window, got %d (window %d)", result.SuccessCount, result.WindowNs)
+	}
+	short, long := result.Windows["300ms"], result.Windows["5s"]
+	if short.SuccessCount != 50 || long.SuccessCount != 100 {
+		t.Errorf("Expected 50 / 100 ticks in 300ms / 5s windows, got %d / %d", short.SuccessCount, long.SuccessCount)
+	}
+	if short.LatencyNs >= long.LatencyNs || short.LatencyNs > int64(10*time.Millisecond) {
+		t.Errorf("Expected recent window to exclude slow ticks, got %d / %d ns", short.LatencyNs, long.LatencyNs)
+	}
+	if result.PublishDelayNs != int64(2*time.Millisecond) || result.Streams["test"].SuccessCount != 100 {
+		t.Errorf("Unexpected publish delay / streams %d / %+v", result.PublishDelayNs, result.Streams)
+	}
+	if result.Seq.GapCount != 0 {
+		t.Errorf("Expected no gaps, got %+v", result.Seq)
+	}
+}
+
+// 行情连续性与延迟一样按最长窗口统计, 窗口外的断档不再计入
+func TestWsEndpointStreamWindowSeq(t *testing.T) {
+	window := time.Second
+	es := &wsEndpointStream{
+		maxWindow: window,
+		latency:   latency_stats.NewRollingSampler(window),
+		publish:   latency_stats.NewRollingSampler(window),
+		streams:   make(map[string]*wsStreamRolling),
+		seq:       newWsSeqTrackerWithGap(100 * time.Millisecond),
+	}
+	record := func(atNs int64, firstId int64, lastId int64) {
+		es.record(atNs, WsTick{Stream: "s", Seq: WsSeq{Mode: WsSeqRange, FirstId: firstId, LastId: lastId}}, 1)
+	}
+	ms := int64(time.Millisecond)
+	windows := []time.Duration{window}
+
+	//0-500ms: 2-4缺失, 间隔300ms计为断流
+	record(0, 1, 1)
+	record(300*ms, 5, 5)
+	record(400*ms, 6, 6)
+	seq := es.result(500*ms, windows, latency_stats.Filter{}).Seq
+	if seq.MessageCount != 3 || seq.GapCount != 1 || seq.MissedUpdates != 3 || seq.StallCount != 1 || seq.MaxStallNs != 300*ms {
+		t.Errorf("Unexpected seq in first window %+v", seq)
+	}
+
+	//1500ms起的窗口只包含500ms之后的行情
+	record(1600*ms, 7, 7)
+	record(1650*ms, 8, 8)
+	seq = es.result(1700*ms, windows, latency_stats.Filter{}).Seq
+	if seq.MessageCount != 2 || seq.GapCount != 0 || seq.MissedUpdates != 0 || seq.StallCount != 1 || seq.MaxStallNs != 1200*ms {
+		t.Errorf("Unexpected seq in second window %+v", seq)
+	}
+	seq = es.result(2700*ms, windows, latency_stats.Filter{}).Seq
+	if seq != (WsSeqResult{}) {
+		t.Errorf("Expected empty seq after window passed, got %+v", seq)
+	}
+	if total := es.seq.Result(); total.MessageCount != 5 || total.GapCount != 1 {
+		t.Errorf("Expected lifetime totals kept in tracker, got %+v", total)
+	}
+}
@@ -0,0 +1,101 @@
+package p2p_latency
+
+import (
+	"errors"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const hyperliquidInfoUrl = "https://api.hyperliquid.xyz/info"
+
+func init() {
+	RegisterExchangeProbe(hyperliquidProbe{})
+}
+
+// Hyperliquid延迟测试, REST仅有POST /info一个接口
+type hyperliquidProbe struct{}
+
+func (hyperliquidProbe) Name() string {
+	return "hyperliquid"
+}
+
+// 无独立时间接口, 以l2Book快照中的time作为服务器时间
+func (hyperliquidProbe) HttpEndpoints() []HttpEndpoint {
+	return []HttpEndpoint{
+		{
+			Name:           "info",
+			Url:            hyperliquidInfoUrl,
+			Body:           `{"type":"l2Book","coin":"BTC"}`,
+			ServerTimeUrl:  hyperliquidInfoUrl,
+			ServerTimeBody: `{"type":"l2Book","coin":"BTC"}`,
+		},
+	}
+}
+
+// {"coin":"BTC","time":1700000000123,"levels":[[...],[...]]}
+func (hyperliquidProbe) ParseServerTime(body string) (int64, error) {
+	var book struct {
+		Time int64 `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(body), &book); err != nil {
+		return 0, err
+	}
+	if book.Time == 0 {
+		return 0, errors.New("time字段缺失")
+	}
+	//毫秒转纳秒
+	return book.Time * 1000000, nil
+}
+
+func (hyperliquidProbe) WsEndpoints() []WsEndpoint {
+	return []WsEndpoint{
+		{Name: "public", Url: "wss://api.hyperliquid.xyz/ws", ServerTimeFrom: "info", SubscribeMsgs: []string{
+			`{"method":"subscribe","subscription":{"type":"l2Book","coin":"BTC"}}`,
+			`{"method":"subscribe","subscription":{"type":"l2Book","coin":"ETH"}}`,
+			`{"method":"subscribe","subscription":{"type":"trades","coin":"BTC"}}`,
+			`{"method":"subscribe","subscription":{"type":"trades","coin":"ETH"}}`,
+		}},
+	}
+}
+
+// l2Book: {"channel":"l2Book","data":{"coin":"BTC","time":..,"levels":[..]}}
+// trades: {"channel":"trades","data":[{"coin":"BTC","time":..,"tid":..}]}
+// subscriptionResponse及pong忽略; 两个频道均无连续序号, 仅统计断流
+func (hyperliquidProbe) ExtractWsTick(msg string) (WsTick, bool) {
+	var wsRecv struct {
+		Channel string              `json:"channel"`
+		Data    jsoniter.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(msg), &wsRecv); err != nil {
+		return WsTick{}, false
+	}
+
+	var coin string
+	var eventTimeMs int64
+	switch wsRecv.Channel {
+	case "l2Book":
+		var book struct {
+			Coin string `json:"coin"`
+			Time int64  `json:"time"`
+		}
+		if err := json.Unmarshal(wsRecv.Data, &book); err != nil {
+			return WsTick{}, false
+		}
+		coin, eventTimeMs = book.Coin, book.Time
+	case "trades":
+		var trades []struct {
+			Coin string `json:"coin"`
+			Time int64  `json:"time"`
+		}
+		if err := json.Unmarshal(wsRecv.Data, &trades); err != nil || len(trades) == 0 {
+			return WsTick{}, false
+		}
+		coin, eventTimeMs = trades[0].Coin, trades[0].Time
+	default:
+		return WsTick{}, false
+	}
+	if eventTimeMs == 0 {
+		return WsTick{}, false
+	}
+	return WsTick{Stream: wsRecv.Channel + "." + coin, EventTimeNs: eventTimeMs * 1000000}, true
+}
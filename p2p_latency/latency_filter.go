@@ -0,0 +1,25 @@
+package p2p_latency
+
+import (
+	"github.com/Hongssd/cgolatencytest/config"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+)
+
+// 读取配置 latency_filter.*, 未配置或方式无效时不过滤
+func loadLatencyFilter() latency_stats.Filter {
+	filter := latency_stats.Filter{
+		Mode:         latency_stats.FilterMode(config.GetConfig("latency_filter.mode")),
+		TrimRatio:    config.GetConfigFloat64("latency_filter.trim_ratio"),
+		MadThreshold: config.GetConfigFloat64("latency_filter.mad_threshold"),
+		MinOfN:       config.GetConfigInt("latency_filter.min_of_n"),
+	}
+	switch filter.Mode {
+	case latency_stats.FilterNone, latency_stats.FilterTrimmedMean, latency_stats.FilterMAD, latency_stats.FilterMinOfN:
+	case "":
+		filter.Mode = latency_stats.FilterNone
+	default:
+		log.Warnf("未知的延迟过滤方式: %s, 不做过滤", filter.Mode)
+		filter.Mode = latency_stats.FilterNone
+	}
+	return filter
+}
@@ -0,0 +1,283 @@
+package p2p_latency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "cgolatency"
+
+// 传输方式标签, 与历史指标名一致
+const (
+	transportHttp    = "http"
+	transportWs      = "ws"
+	transportWsRpc   = "ws_rpc"
+	transportWsOrder = "ws_order"
+)
+
+// 失败原因分类
+const (
+	errorClassTimeout       = "timeout"
+	errorClassDns           = "dns"
+	errorClassConnect       = "connect"
+	errorClassTls           = "tls"
+	errorClassInvalidStatus = "invalid_status"
+	errorClassSubscribe     = "subscribe"
+	errorClassAuth          = "auth"
+	errorClassOther         = "other"
+)
+
+// endpoint不含后端IP, 开启后端IP展开时IP单独放在backend标签, 随解析结果变化的后端在结果中消失后删除
+var probeLabels = []string{"node", "exchange", "product", "transport", "endpoint", "backend"}
+
+var (
+	//独立注册表, 不混入libp2p注册到默认注册表的指标
+	metricsRegistry = prometheus.NewRegistry()
+	//本节点名, 本节点测试样本的node标签, 节点创建时设置
+	metricsNodeName string
+
+	//各节点各交易所最近一次结果中带后端IP的端点, 用于删除已消失后端的序列
+	metricsBackendsMu sync.Mutex
+	metricsBackends   = make(map[nodeExchangeKey]map[metricsBackendSeries]bool)
+
+	probeLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "probe_latency_seconds",
+		Help:      "本节点交易所延迟测试单个样本耗时(HTTP请求耗时 / WS本地收到 - 事件时间)",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16), //0.1ms ~ 3.3s
+	}, probeLabels)
+	probeRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "probe_requests_total",
+		Help:      "本节点交易所延迟测试请求及WS连接次数, 按结果及失败原因分类",
+	}, append(append([]string{}, probeLabels...), "result", "error_class"))
+	exchangeLatencySeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "exchange_latency_seconds",
+		Help:      "各节点(含远程节点)最近一次发布的过滤后平均延迟",
+	}, probeLabels)
+	serverClockOffsetSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "server_clock_offset_seconds",
+		Help:      "各节点估计的本地时间 - 交易所服务器时间",
+	}, []string{"node", "exchange", "endpoint", "backend"})
+	peerLatencySeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "peer_latency_seconds",
+		Help:      "本节点到目标节点的平均网络延迟(对端发送时间戳到本节点收到)",
+	}, []string{"node", "peer"})
+	clockOffsetSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "clock_offset_seconds",
+		Help:      "各节点最近一次时钟检查的本地时间 - 参考时间",
+	}, []string{"node"})
+	clockInTolerance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "clock_in_tolerance",
+		Help:      "各节点时钟是否在容忍范围内(1/0)",
+	}, []string{"node"})
+	p2pMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "p2p_messages_total",
+		Help:      "本节点P2P消息数, direction为sent/received, result为ok/error",
+	}, []string{"node", "direction", "type", "result"})
+	p2pMessageDelaySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "p2p_message_delay_seconds",
+		Help:      "本节点收到P2P消息的延迟(对端发送时间戳到本节点收到)",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"node", "peer"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		probeLatencySeconds,
+		probeRequestsTotal,
+		exchangeLatencySeconds,
+		serverClockOffsetSeconds,
+		peerLatencySeconds,
+		clockOffsetSeconds,
+		clockInTolerance,
+		p2pMessagesTotal,
+		p2pMessageDelaySeconds,
+	)
+}
+
+// /metrics 处理器
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// 端点名去掉主机名变体及后端IP后缀即为产品, 如 spot@api1.binance.com#1.2.3.4 -> spot
+func metricsProduct(endpoint string) string {
+	if i := strings.IndexAny(endpoint, endpointVariantSep+endpointBackendSep); i >= 0 {
+		return endpoint[:i]
+	}
+	return endpoint
+}
+
+// 端点名拆分为endpoint及backend标签, 如 spot@api1.binance.com#1.2.3.4 -> spot@api1.binance.com, 1.2.3.4
+func probeLabelValues(node string, exchange string, transport string, endpoint string) []string {
+	name, backend := endpoint, ""
+	if i := strings.Index(endpoint, endpointBackendSep); i >= 0 {
+		name, backend = endpoint[:i], endpoint[i+len(endpointBackendSep):]
+	}
+	return []string{node, exchange, metricsProduct(endpoint), transport, name, backend}
+}
+
+// 按libcurl错误信息归类失败原因
+func classifyProbeError(errMsg string) string {
+	msg := strings.ToLower(errMsg)
+	switch {
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out"):
+		return errorClassTimeout
+	case strings.Contains(msg, "resolve"):
+		return errorClassDns
+	case strings.Contains(msg, "ssl") || strings.Contains(msg, "tls") || strings.Contains(msg, "certificate"):
+		return errorClassTls
+	case strings.Contains(msg, "connect"):
+		return errorClassConnect
+	default:
+		return errorClassOther
+	}
+}
+
+// 按请求应答类调用(WS JSON-RPC、下单)的错误归类失败原因
+func classifyCallError(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorClassTimeout
+	case errors.Is(err, http_client.ErrWebSocketRequesterClosed):
+		return errorClassConnect
+	default:
+		return classifyProbeError(err.Error())
+	}
+}
+
+// 记录本节点一个成功样本
+func observeProbeSample(exchange string, transport string, endpoint string, latencyNs int64) {
+	labels := probeLabelValues(metricsNodeName, exchange, transport, endpoint)
+	probeLatencySeconds.WithLabelValues(labels...).Observe(time.Duration(latencyNs).Seconds())
+	probeRequestsTotal.WithLabelValues(append(labels, "success", "")...).Inc()
+}
+
+// 记录本节点一次失败
+func observeProbeFailure(exchange string, transport string, endpoint string, errorClass string) {
+	labels := probeLabelValues(metricsNodeName, exchange, transport, endpoint)
+	probeRequestsTotal.WithLabelValues(append(labels, "failure", errorClass)...).Inc()
+}
+
+// 更新节点最近一次发布的交易所延迟, 无成功样本的端点不更新
+func observeExchangeResult(node string, result ExchangeLatencyResult) {
+	set := func(transport string, endpoint string, latencyNs int64) {
+		exchangeLatencySeconds.WithLabelValues(probeLabelValues(node, result.Exchange, transport, endpoint)...).
+			Set(time.Duration(latencyNs).Seconds())
+	}
+	backends := make(map[metricsBackendSeries]bool)
+	for name := range result.Http {
+		if strings.Contains(name, endpointBackendSep) {
+			backends[metricsBackendSeries{transportHttp, name}] = true
+		}
+	}
+	for name := range result.Ws {
+		if strings.Contains(name, endpointBackendSep) {
+			backends[metricsBackendSeries{transportWs, name}] = true
+		}
+	}
+	forgetStaleBackends(node, result.Exchange, backends)
+
+	for name, http := range result.Http {
+		if http.SuccessCount > 0 {
+			set(transportHttp, name, http.LatencyNs)
+		}
+		if http.ServerClock.UsedCount > 0 {
+			labels := probeLabelValues(node, result.Exchange, transportHttp, name)
+			serverClockOffsetSeconds.WithLabelValues(node, result.Exchange, labels[4], labels[5]).Set(time.Duration(http.ServerClock.OffsetNs).Seconds())
+		}
+	}
+	for name, ws := range result.Ws {
+		if ws.SuccessCount > 0 {
+			set(transportWs, name, ws.LatencyNs)
+		}
+	}
+	for name, rpc := range result.WsRpc {
+		if rpc.SuccessCount > 0 {
+			set(transportWsRpc, name, rpc.RttNs)
+		}
+	}
+	if result.WsOrder != nil && result.WsOrder.AckRttNs > 0 {
+		set(transportWsOrder, transportWsOrder, result.WsOrder.AckRttNs)
+	}
+}
+
+type metricsBackendSeries struct {
+	Transport string
+	Endpoint  string
+}
+
+// 删除上次结果中有、本次结果中已消失的后端IP序列, 本节点同时删除样本直方图及请求计数
+func forgetStaleBackends(node string, exchange string, current map[metricsBackendSeries]bool) {
+	key := nodeExchangeKey{node, exchange}
+	metricsBackendsMu.Lock()
+	previous := metricsBackends[key]
+	metricsBackends[key] = current
+	metricsBackendsMu.Unlock()
+
+	for series := range previous {
+		if current[series] {
+			continue
+		}
+		values := probeLabelValues(node, exchange, series.Transport, series.Endpoint)
+		exchangeLatencySeconds.DeleteLabelValues(values...)
+		serverClockOffsetSeconds.DeleteLabelValues(node, exchange, values[4], values[5])
+		if node == metricsNodeName {
+			labels := prometheus.Labels{}
+			for i, name := range probeLabels {
+				labels[name] = values[i]
+			}
+			probeLatencySeconds.DeletePartialMatch(labels)
+			probeRequestsTotal.DeletePartialMatch(labels)
+		}
+	}
+}
+
+func observeClockHealth(node string, health clock_health.ClockHealth) {
+	clockOffsetSeconds.WithLabelValues(node).Set(time.Duration(health.OffsetNs).Seconds())
+	inTolerance := 0.0
+	if health.InTolerance {
+		inTolerance = 1
+	}
+	clockInTolerance.WithLabelValues(node).Set(inTolerance)
+}
+
+func observePeerLatency(peer string, latencyNs int64) {
+	peerLatencySeconds.WithLabelValues(metricsNodeName, peer).Set(time.Duration(latencyNs).Seconds())
+}
+
+func observeP2PMessageReceived(peer string, msgType P2PReqType, delayNs int64, err error) {
+	p2pMessagesTotal.WithLabelValues(metricsNodeName, "received", string(msgType), metricsResult(err)).Inc()
+	p2pMessageDelaySeconds.WithLabelValues(metricsNodeName, peer).Observe(time.Duration(delayNs).Seconds())
+}
+
+func observeP2PMessageSent(msgType P2PReqType, err error) {
+	p2pMessagesTotal.WithLabelValues(metricsNodeName, "sent", string(msgType), metricsResult(err)).Inc()
+}
+
+func metricsResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
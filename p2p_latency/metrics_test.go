@@ -0,0 +1,132 @@
+package p2p_latency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/http_client"
+)
+
+func TestClassifyProbeError(t *testing.T) {
+	cases := map[string]string{
+		"Timeout was reached":               errorClassTimeout,
+		"Couldn't resolve host name":        errorClassDns,
+		"Couldn't connect to server":        errorClassConnect,
+		"SSL connect error":                 errorClassTls,
+		"SSL peer certificate was not OK":   errorClassTls,
+		"Failure when receiving data":       errorClassOther,
+		"Operation timed out after 3000 ms": errorClassTimeout,
+	}
+	for msg, expected := range cases {
+		if got := classifyProbeError(msg); got != expected {
+			t.Errorf("classifyProbeError(%q) = %s, expected %s", msg, got, expected)
+		}
+	}
+	if product := metricsProduct("spot@api1.binance.com#1.2.3.4"); product != "spot" {
+		t.Errorf("Expected product spot, got %s", product)
+	}
+	labels := probeLabelValues("n", "binance", transportHttp, "spot@api1.binance.com#1.2.3.4")
+	if labels[4] != "spot@api1.binance.com" || labels[5] != "1.2.3.4" {
+		t.Errorf("Expected backend IP split from endpoint, got %v", labels)
+	}
+
+	callCases := map[error]string{
+		context.DeadlineExceeded: errorClassTimeout,
+		fmt.Errorf("wrapped: %w", http_client.ErrWebSocketRequesterClosed): errorClassConnect,
+		errors.New("Couldn't resolve host name"):                           errorClassDns,
+	}
+	for err, expected := range callCases {
+		if got := classifyCallError(err); got != expected {
+			t.Errorf("classifyCallError(%v) = %s, expected %s", err, got, expected)
+		}
+	}
+}
+
+// 后端IP单独作为标签, 从结果中消失的后端序列被删除
+func TestMetricsStaleBackends(t *testing.T) {
+	metricsNodeName = "backend-local"
+	defer func() { metricsNodeName = "" }()
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		metricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := io.ReadAll(rec.Body)
+		return string(body)
+	}
+	result := func(backends ...string) ExchangeLatencyResult {
+		r := ExchangeLatencyResult{Exchange: "binance", Http: map[string]HttpLatencyResult{"spot": {LatencyNs: 1, SuccessCount: 1}}}
+		for _, backend := range backends {
+			r.Http["spot#"+backend] = HttpLatencyResult{LatencyNs: 1, SuccessCount: 1}
+		}
+		return r
+	}
+	observeProbeSample("binance", transportHttp, "spot#10.0.0.1", 1)
+	observeProbeFailure("binance", transportHttp, "spot#10.0.0.1", errorClassTimeout)
+	observeExchangeResult("backend-local", result("10.0.0.1", "10.0.0.2"))
+	observeExchangeResult("backend-remote", result("10.0.0.1"))
+
+	body := scrape()
+	for _, line := range []string{
+		`cgolatency_exchange_latency_seconds{backend="10.0.0.1",endpoint="spot",exchange="binance",node="backend-local",product="spot",transport="http"}`,
+		`cgolatency_probe_requests_total{backend="10.0.0.1",endpoint="spot",error_class="timeout",exchange="binance",node="backend-local",product="spot",result="failure",transport="http"} 1`,
+		`cgolatency_exchange_latency_seconds{backend="10.0.0.1",endpoint="spot",exchange="binance",node="backend-remote",product="spot",transport="http"}`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %s", line)
+		}
+	}
+
+	//本节点10.0.0.1不再出现, 远程节点不受影响
+	observeExchangeResult("backend-local", result("10.0.0.2"))
+	body = scrape()
+	if strings.Contains(body, `backend="10.0.0.1",endpoint="spot",error_class="timeout",exchange="binance",node="backend-local"`) ||
+		strings.Contains(body, `cgolatency_exchange_latency_seconds{backend="10.0.0.1",endpoint="spot",exchange="binance",node="backend-local"`) ||
+		strings.Contains(body, `cgolatency_probe_latency_seconds_count{backend="10.0.0.1",endpoint="spot",exchange="binance",node="backend-local"`) {
+		t.Errorf("Expected stale local backend removed, got %s", body)
+	}
+	if !strings.Contains(body, `backend="10.0.0.2",endpoint="spot",exchange="binance",node="backend-local"`) ||
+		!strings.Contains(body, `backend="10.0.0.1",endpoint="spot",exchange="binance",node="backend-remote"`) {
+		t.Errorf("Expected current and remote backends kept, got %s", body)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	metricsNodeName = "metrics-local"
+	defer func() { metricsNodeName = "" }()
+
+	observeProbeSample("binance", transportHttp, "spot@api1.binance.com", int64(3*time.Millisecond))
+	observeProbeFailure("binance", transportHttp, "spot@api1.binance.com", errorClassTimeout)
+	observeExchangeResult("metrics-remote", ExchangeLatencyResult{
+		Exchange: "okx",
+		Ws:       map[string]WsLatencyResult{"public": {LatencyNs: int64(2 * time.Millisecond), SuccessCount: 1}},
+	})
+	observeClockHealth("metrics-remote", clock_health.ClockHealth{OffsetNs: int64(time.Millisecond), InTolerance: true})
+	observePeerLatency("metrics-remote", int64(5*time.Millisecond))
+	observeP2PMessageSent(P2PReqTypeLatency, nil)
+
+	rec := httptest.NewRecorder()
+	metricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	expected := []string{
+		`cgolatency_probe_latency_seconds_count{backend="",endpoint="spot@api1.binance.com",exchange="binance",node="metrics-local",product="spot",transport="http"} 1`,
+		`cgolatency_probe_requests_total{backend="",endpoint="spot@api1.binance.com",error_class="timeout",exchange="binance",node="metrics-local",product="spot",result="failure",transport="http"} 1`,
+		`cgolatency_exchange_latency_seconds{backend="",endpoint="public",exchange="okx",node="metrics-remote",product="public",transport="ws"} 0.002`,
+		`cgolatency_clock_offset_seconds{node="metrics-remote"} 0.001`,
+		`cgolatency_clock_in_tolerance{node="metrics-remote"} 1`,
+		`cgolatency_peer_latency_seconds{node="metrics-local",peer="metrics-remote"} 0.005`,
+		`cgolatency_p2p_messages_total{direction="sent",node="metrics-local",result="ok",type="latency"} 1`,
+		`go_goroutines`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("Expected metrics to contain %s", line)
+		}
+	}
+}
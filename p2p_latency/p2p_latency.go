@@ -9,6 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/latency_alert"
+	"github.com/Hongssd/cgolatencytest/latency_export"
+	"github.com/Hongssd/cgolatencytest/latency_history"
 	"github.com/Hongssd/cgolatencytest/myutils"
 	"github.com/Hongssd/cgolatencytest/p2p_base"
 )
@@ -19,17 +23,29 @@ type P2PLatencyNode struct {
 	NodeCtx    context.Context
 	NodeCancel context.CancelFunc
 
-	BnLatency  *BnLatencyResult
-	OkxLatency *OkxLatencyResult
+	//本节点交易所延迟信息
+	ExchangeLatency *myutils.MySyncMap[string, ExchangeLatencyResult] // exchange -> latency
 
 	//目标节点平均网络延迟
 	NodeAvgLatencyMap *myutils.MySyncMap[string, int64] // nodeName -> avgLatency
 
-	//目标节点币安延迟信息
-	NodeBnLatencyMap *myutils.MySyncMap[string, BnLatencyResult] // nodeName -> bnLatency
+	//目标节点交易所延迟信息
+	NodeExchangeLatencyMap *myutils.MySyncMap[nodeExchangeKey, ExchangeLatencyResult] // (nodeName, exchange) -> latency
 
-	//目标节点OKX延迟信息
-	NodeOkxLatencyMap *myutils.MySyncMap[string, OkxLatencyResult] // nodeName -> okxLatency
+	//各节点(含本节点)最近一次时钟检查结果
+	NodeClockHealthMap *myutils.MySyncMap[string, clock_health.ClockHealth] // nodeName -> clock
+
+	//本地时钟超出容忍范围时的处理方式
+	clockHealthAction string
+
+	//各节点延迟指标的有界历史, 供/api/history查询
+	History *latency_history.Store
+	//磁盘历史, 未开启持久化或打开失败时为空
+	HistoryDisk *latency_history.DiskStore
+	//测量值推送, 未开启时为空
+	Exporter *latency_export.Exporter
+	//告警评估, 未配置告警规则时为空
+	Alerts *latency_alert.Evaluator
 }
 
 func NewP2PLatencyNode(nodeIP string, nodePort int, allNodeList []string) (*P2PLatencyNode, error) {
@@ -68,14 +84,23 @@ func NewP2PLatencyNode(nodeIP string, nodePort int, allNodeList []string) (*P2PL
 		log.Errorf("创建p2p节点失败：%v\n", err)
 		return nil, err
 	}
+	metricsNodeName = nodeName
 	thisP2PLatencyNode := &P2PLatencyNode{
-		Node:              thisNode,
-		BnLatency:         &BnLatencyResult{},
-		NodeAvgLatencyMap: myutils.GetPointer(myutils.NewMySyncMap[string, int64]()),
-		NodeBnLatencyMap:  myutils.GetPointer(myutils.NewMySyncMap[string, BnLatencyResult]()),
-		NodeOkxLatencyMap: myutils.GetPointer(myutils.NewMySyncMap[string, OkxLatencyResult]()),
+		Node:                   thisNode,
+		ExchangeLatency:        myutils.GetPointer(myutils.NewMySyncMap[string, ExchangeLatencyResult]()),
+		NodeAvgLatencyMap:      myutils.GetPointer(myutils.NewMySyncMap[string, int64]()),
+		NodeExchangeLatencyMap: myutils.GetPointer(myutils.NewMySyncMap[nodeExchangeKey, ExchangeLatencyResult]()),
+		NodeClockHealthMap:     myutils.GetPointer(myutils.NewMySyncMap[string, clock_health.ClockHealth]()),
+		History:                latency_history.NewStore(loadHistoryCapacity()),
 	}
 	thisP2PLatencyNode.NodeCtx, thisP2PLatencyNode.NodeCancel = context.WithCancel(context.Background())
+	if opts, ok := loadHistoryDiskOptions(); ok {
+		thisP2PLatencyNode.startHistoryDisk(thisP2PLatencyNode.NodeCtx, opts)
+	}
+	if cfg, ok := loadExportConfig(); ok {
+		thisP2PLatencyNode.startExporter(thisP2PLatencyNode.NodeCtx, cfg)
+	}
+	thisP2PLatencyNode.startAlerts(thisP2PLatencyNode.NodeCtx, loadAlertRules(), loadAlertSilences())
 	go func(ctx context.Context) {
 		//持续读取消息通道
 		for msg := range thisNode.MsgChan() {
@@ -90,6 +115,7 @@ func NewP2PLatencyNode(nodeIP string, nodePort int, allNodeList []string) (*P2PL
 			err := json.Unmarshal([]byte(msg.MsgData), &p2pMsg)
 			if err != nil {
 				log.Errorf("Unmarshal error: %v", err)
+				observeP2PMessageReceived(msg.FromPeerName, "invalid", inTimestamp-msg.TimestampNano, err)
 				continue
 			}
 
@@ -99,24 +125,24 @@ func NewP2PLatencyNode(nodeIP string, nodePort int, allNodeList []string) (*P2PL
 				case P2PReqTypeLatency:
 					//远程节点传入延迟请求捕获并存入
 					err = thisP2PLatencyNode.handleAvgLatencyMsg(p2pMsg, msg.FromPeerName)
-				case P2PReqTypeBnLatency:
-					//远程节点发起币安延迟请求直接返回币安延迟信息
-					err = thisP2PLatencyNode.handleBnLatencyMsgReq(p2pMsg, msg.FromPeerName, inTimestamp)
-				case P2PReqTypeOkxLatency:
-					//远程节点发起OKX延迟请求直接返回OKX延迟信息
-					err = thisP2PLatencyNode.handleOkxLatencyMsgReq(p2pMsg, msg.FromPeerName, inTimestamp)
+				case P2PReqTypeExchangeLatency:
+					//远程节点发起交易所延迟请求直接返回对应交易所延迟信息
+					err = thisP2PLatencyNode.handleExchangeLatencyMsgReq(p2pMsg, msg.FromPeerName, inTimestamp)
+				case P2PReqTypeBnLatency, P2PReqTypeOkxLatency:
+					//旧版节点请求币安/OKX延迟, 按旧版结构返回
+					err = thisP2PLatencyNode.handleLegacyLatencyMsgReq(p2pMsg, msg.FromPeerName, inTimestamp)
 				default:
 					log.Errorf("P2P节点[%s]不支持的请求类型: %s", msg.FromPeerName, p2pMsg.Req.ReqType)
 				}
 			} else {
 				//捕获应答
 				switch p2pMsg.Res.ReqType {
-				case P2PReqTypeBnLatency:
-					//远程节点响应返回币安延迟信息，存入缓存
-					err = thisP2PLatencyNode.handleBnLatencyMsgRes(p2pMsg, msg.FromPeerName)
-				case P2PReqTypeOkxLatency:
-					//远程节点响应返回OKX延迟信息，存入缓存
-					err = thisP2PLatencyNode.handleOkxLatencyMsgRes(p2pMsg, msg.FromPeerName)
+				case P2PReqTypeExchangeLatency:
+					//远程节点响应返回交易所延迟信息，存入缓存
+					err = thisP2PLatencyNode.handleExchangeLatencyMsgRes(p2pMsg, msg.FromPeerName)
+				case P2PReqTypeBnLatency, P2PReqTypeOkxLatency:
+					//旧版节点广播的币安/OKX延迟, 转换后存入缓存
+					err = thisP2PLatencyNode.handleLegacyLatencyMsgRes(p2pMsg, msg.FromPeerName, inTimestamp)
 				default:
 					log.Errorf("P2P节点[%s]不支持的应答类型: %s", msg.FromPeerName, p2pMsg.Res.ReqType)
 				}
@@ -124,17 +150,23 @@ func NewP2PLatencyNode(nodeIP string, nodePort int, allNodeList []string) (*P2PL
 			if err != nil {
 				log.Error(err)
 			}
+			msgType := p2pMsg.Res.ReqType
+			if p2pMsg.IsReq {
+				msgType = p2pMsg.Req.ReqType
+			}
+			observeP2PMessageReceived(msg.FromPeerName, msgType, inTimestamp-msg.TimestampNano, err)
 		}
 	}(thisP2PLatencyNode.NodeCtx)
 
 	go func(ctx context.Context) {
-		//每分钟广播一次延迟消息
+		//按node_latency.interval_ms定时广播延迟消息
+		interval := loadNodeLatencyInterval()
 		for {
 			select {
 			case <-ctx.Done():
 				log.Infof("[%s]广播延迟消息协程退出", thisNode.PeerName)
 				return
-			case <-time.After(time.Minute * 1):
+			case <-time.After(interval):
 				err := thisP2PLatencyNode.broadcastAvgLatencyMsg()
 				if err != nil {
 					log.Error(err)
@@ -143,55 +175,37 @@ func NewP2PLatencyNode(nodeIP string, nodePort int, allNodeList []string) (*P2PL
 		}
 	}(thisP2PLatencyNode.NodeCtx)
 
-	go func(ctx context.Context) {
-		//每分钟计算一次币安延迟信息
-		for {
-			select {
-			case <-ctx.Done():
-				log.Infof("[%s]币安延迟计算协程退出", thisNode.PeerName)
-				return
-			case <-time.After(time.Minute * 1):
-				err := thisP2PLatencyNode.refreshBnLatency()
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-				err = thisP2PLatencyNode.broadcastBnLatencyMsg()
-				if err != nil {
-					log.Error(err)
-					continue
+	//定时检查本地时钟, 首次检查完成后再开始测试交易所延迟
+	clockChecked := make(chan struct{})
+	if clockSettings, ok := loadClockHealthSettings(); ok {
+		thisP2PLatencyNode.clockHealthAction = clockSettings.Action
+		checker := clock_health.NewChecker(clockSettings.Checker)
+		go func(ctx context.Context) {
+			thisP2PLatencyNode.checkClockHealth(checker)
+			close(clockChecked)
+			for {
+				select {
+				case <-ctx.Done():
+					log.Infof("[%s]时钟检查协程退出", thisNode.PeerName)
+					return
+				case <-time.After(clockSettings.Interval):
+					thisP2PLatencyNode.checkClockHealth(checker)
 				}
 			}
-		}
-	}(thisP2PLatencyNode.NodeCtx)
+		}(thisP2PLatencyNode.NodeCtx)
+	} else {
+		close(clockChecked)
+	}
 
-	//每分钟刷新一次OKX延迟信息
-	go func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				log.Infof("[%s]OKX延迟计算协程退出", thisNode.PeerName)
-				return
-			case <-time.After(time.Minute * 1):
-				err := thisP2PLatencyNode.refreshOkxLatency()
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-				err = thisP2PLatencyNode.broadcastOkxLatencyMsg()
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-			}
-		}
-	}(thisP2PLatencyNode.NodeCtx)
+	//持续测试模式: WS保持长连接, 定时发布滚动窗口统计
+	streaming := loadStreamingSettings()
+	if streaming.Enabled {
+		go thisP2PLatencyNode.runExchangeStreams(thisP2PLatencyNode.NodeCtx, streaming, clockChecked)
+		return thisP2PLatencyNode, nil
+	}
 
-	//刷新一次币安延迟 OKX延迟
-	go func() {
-		thisP2PLatencyNode.refreshBnLatency()
-		thisP2PLatencyNode.refreshOkxLatency()
-	}()
+	//快照模式: 每个已注册交易所按配置间隔(默认每分钟)刷新并广播一次延迟信息
+	go thisP2PLatencyNode.runExchangeSnapshots(thisP2PLatencyNode.NodeCtx, clockChecked)
 
 	return thisP2PLatencyNode, nil
 }
@@ -0,0 +1,230 @@
+package p2p_latency
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/config"
+	"github.com/Hongssd/cgolatencytest/latency_alert"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAlertCheckInterval      = 10 * time.Second
+	defaultAlertSilenceMaxDuration = 24 * time.Hour //通过API添加的静默最长时长
+)
+
+// 读取配置 alerts.silence_max_duration_ms
+func loadAlertSilenceMaxDuration() time.Duration {
+	if ms := config.GetConfigInt("alerts.silence_max_duration_ms"); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultAlertSilenceMaxDuration
+}
+
+// 读取配置 alerts.rules.<规则名>.*, 阈值按毫秒配置, 转为与指标一致的纳秒
+func loadAlertRules() []latency_alert.Rule {
+	names := make([]string, 0)
+	for name := range config.GetConfigStringMap("alerts.rules") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rules []latency_alert.Rule
+	for _, name := range names {
+		prefix := "alerts.rules." + name + "."
+		rule := latency_alert.Rule{
+			Name:          name,
+			Metric:        config.GetConfig(prefix + "metric"),
+			Nodes:         config.GetConfigSlice(prefix + "nodes"),
+			Operator:      config.GetConfig(prefix + "operator"),
+			Threshold:     config.GetConfigFloat64(prefix+"threshold_ms") * float64(time.Millisecond),
+			ChangePercent: config.GetConfigFloat64(prefix + "change_percent"),
+			Baseline:      time.Duration(config.GetConfigInt(prefix+"baseline_ms")) * time.Millisecond,
+			Absent:        config.GetConfigBool(prefix + "absent"),
+			Duration:      time.Duration(config.GetConfigInt(prefix+"duration_ms")) * time.Millisecond,
+			Severity:      config.GetConfig(prefix + "severity"),
+		}
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+		if rule.Operator != "" && rule.Operator != latency_alert.OperatorAbove && rule.Operator != latency_alert.OperatorBelow {
+			log.Warnf("忽略告警规则[%s]: 不支持的operator %s", name, rule.Operator)
+			continue
+		}
+		if rule.Metric == "" || (!rule.Absent && rule.Threshold == 0 && rule.ChangePercent == 0) {
+			log.Warnf("忽略告警规则[%s]: 需配置metric及threshold_ms / change_percent / absent之一", name)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// 读取配置 alerts.silences.<静默名>.rule/node/until/comment, until为RFC3339时间
+func loadAlertSilences() []latency_alert.Silence {
+	var silences []latency_alert.Silence
+	for name := range config.GetConfigStringMap("alerts.silences") {
+		prefix := "alerts.silences." + name + "."
+		until, err := time.Parse(time.RFC3339, config.GetConfig(prefix+"until"))
+		if err != nil {
+			log.Warnf("忽略告警静默[%s]: 无法解析until: %v", name, err)
+			continue
+		}
+		silences = append(silences, latency_alert.Silence{
+			Name:    name,
+			Rule:    config.GetConfig(prefix + "rule"),
+			Node:    config.GetConfig(prefix + "node"),
+			UntilNs: until.UnixNano(),
+			Comment: config.GetConfig(prefix + "comment"),
+		})
+	}
+	return silences
+}
+
+// 打印告警通知后转发到webhook
+type alertLogNotifier struct {
+	next latency_alert.Notifier
+}
+
+func (a alertLogNotifier) Notify(n latency_alert.Notification) {
+	if n.Status == latency_alert.StatusFiring {
+		log.Warnf("告警触发[%s][%s]: %s", n.Rule, n.Severity, n.Message)
+	} else {
+		log.Infof("告警恢复[%s][%s]: %s", n.Rule, n.Severity, n.Message)
+	}
+	if a.next != nil {
+		a.next.Notify(n)
+	}
+}
+
+// 未配置告警规则时不启动
+func (n *P2PLatencyNode) startAlerts(ctx context.Context, rules []latency_alert.Rule, silences []latency_alert.Silence) {
+	if len(rules) == 0 {
+		return
+	}
+	notifier := alertLogNotifier{}
+	if urls := config.GetConfigSlice("alerts.webhooks"); len(urls) > 0 {
+		timeout := time.Duration(config.GetConfigInt("alerts.webhook_timeout_ms")) * time.Millisecond
+		webhook := latency_alert.NewWebhookNotifier(urls, timeout, func(url string, notification latency_alert.Notification, err error) {
+			log.Errorf("发送告警[%s]到%s失败: %v", notification.Rule, url, err)
+		})
+		go webhook.Run(ctx)
+		notifier.next = webhook
+	}
+	n.Alerts = latency_alert.NewEvaluator(rules, silences, notifier)
+	log.Infof("已加载%d条告警规则, %d个webhook", len(rules), len(config.GetConfigSlice("alerts.webhooks")))
+
+	interval := defaultAlertCheckInterval
+	if ms := config.GetConfigInt("alerts.check_interval_ms"); ms > 0 {
+		interval = time.Duration(ms) * time.Millisecond
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+				n.Alerts.Check()
+			}
+		}
+	}()
+}
+
+// 告警查询响应
+type AlertsResponse struct {
+	Alerts   []latency_alert.Alert   `json:"alerts"`
+	Silences []latency_alert.Silence `json:"silences"`
+	Rules    []latency_alert.Rule    `json:"rules"`
+}
+
+// 告警API处理器, 查询当前告警、静默及规则
+func (n *P2PLatencyNode) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if n == nil || n.Alerts == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ApiResponse{Code: 404, Message: "未配置告警规则", Data: nil})
+		return
+	}
+	response := ApiResponse{
+		Code:    200,
+		Message: "查询成功",
+		Data:    AlertsResponse{Alerts: n.Alerts.Alerts(), Silences: n.Alerts.Silences(), Rules: n.Alerts.Rules()},
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// 校验请求头 Authorization: Bearer <alerts.silence_token>, 未配置token时禁止通过API修改静默
+func authorizeAlertSilence(r *http.Request) (int, string) {
+	token := config.GetConfig("alerts.silence_token")
+	if token == "" {
+		return http.StatusForbidden, "未配置alerts.silence_token, 禁止通过API修改静默"
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		return http.StatusUnauthorized, "token无效"
+	}
+	return http.StatusOK, ""
+}
+
+// 告警静默API处理器, 需携带 Authorization: Bearer <alerts.silence_token>
+// POST 添加静默, 参数: rule 规则名通配符, node 节点通配符, duration 时长如 2h(不超过alerts.silence_max_duration_ms), name 同名覆盖(可选), comment
+// DELETE 按name删除静默, 静默中仍在触发的告警在下次检查时通知
+func (n *P2PLatencyNode) handleAlertSilence(w http.ResponseWriter, r *http.Request) {
+	writeResponse := func(status int, response ApiResponse) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+	if n == nil || n.Alerts == nil {
+		writeResponse(http.StatusNotFound, ApiResponse{Code: 404, Message: "未配置告警规则", Data: nil})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeResponse(http.StatusMethodNotAllowed, ApiResponse{Code: 405, Message: "仅支持POST / DELETE", Data: nil})
+		return
+	}
+	if status, message := authorizeAlertSilence(r); status != http.StatusOK {
+		log.Warnf("拒绝告警静默请求[%s]: %s", r.RemoteAddr, message)
+		writeResponse(status, ApiResponse{Code: status, Message: message, Data: nil})
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if !n.Alerts.RemoveSilence(name) {
+			writeResponse(http.StatusNotFound, ApiResponse{Code: 404, Message: "静默不存在: " + name, Data: nil})
+			return
+		}
+		log.Infof("删除告警静默[%s]", name)
+		writeResponse(http.StatusOK, ApiResponse{Code: 200, Message: "删除成功", Data: nil})
+		return
+	}
+
+	duration, err := time.ParseDuration(r.FormValue("duration"))
+	if err != nil || duration <= 0 {
+		writeResponse(http.StatusBadRequest, ApiResponse{Code: 400, Message: "duration无效, 如 30m / 2h", Data: nil})
+		return
+	}
+	if maxDuration := loadAlertSilenceMaxDuration(); duration > maxDuration {
+		writeResponse(http.StatusBadRequest, ApiResponse{Code: 400, Message: "duration不能超过" + maxDuration.String(), Data: nil})
+		return
+	}
+	silence := latency_alert.Silence{
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		Rule:    r.FormValue("rule"),
+		Node:    r.FormValue("node"),
+		UntilNs: time.Now().Add(duration).UnixNano(),
+		Comment: r.FormValue("comment"),
+	}
+	if silence.Name == "" {
+		silence.Name = uuid.New().String()
+	}
+	n.Alerts.AddSilence(silence)
+	log.Infof("添加告警静默[%s]: 规则[%s] 节点[%s] 至 %v", silence.Name, silence.Rule, silence.Node, time.Unix(0, silence.UntilNs))
+	writeResponse(http.StatusOK, ApiResponse{Code: 200, Message: "添加成功", Data: silence})
+}
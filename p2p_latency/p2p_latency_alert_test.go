@@ -0,0 +1,161 @@
+package p2p_latency
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/latency_alert"
+	"github.com/Hongssd/cgolatencytest/latency_history"
+	"github.com/Hongssd/cgolatencytest/p2p_base"
+	"github.com/spf13/viper"
+)
+
+// 节点延迟超过阈值时POST触发通知到本地webhook, 回落后发送恢复通知
+func TestNodeAlertWebhook(t *testing.T) {
+	received := make(chan latency_alert.Notification, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var notification latency_alert.Notification
+		if err := json.Unmarshal(body, &notification); err != nil {
+			t.Errorf("Invalid webhook body %s: %v", body, err)
+		}
+		received <- notification
+	}))
+	defer server.Close()
+
+	if rules := loadAlertRules(); len(rules) != 0 {
+		t.Errorf("Expected no rules by default, got %+v", rules)
+	}
+	values := map[string]interface{}{
+		"alerts.webhooks":                     []string{server.URL},
+		"alerts.rules.peer_slow.metric":       "node_latency",
+		"alerts.rules.peer_slow.nodes":        []string{"10.0.0.*"},
+		"alerts.rules.peer_slow.threshold_ms": 50,
+		"alerts.rules.peer_slow.severity":     "critical",
+		"alerts.rules.invalid.metric":         "node_latency",
+		"alerts.silences.old.rule":            "peer_slow",
+		"alerts.silences.old.until":           "2000-01-01T00:00:00Z",
+	}
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	defer func() {
+		for key := range values {
+			viper.Set(key, nil)
+		}
+		viper.Set("alerts", nil)
+	}()
+	rules := loadAlertRules()
+	if len(rules) != 1 || rules[0].Threshold != float64(50*time.Millisecond) || rules[0].Severity != "critical" {
+		t.Fatalf("Unexpected rules %+v", rules)
+	}
+
+	n := &P2PLatencyNode{
+		Node:    &p2p_base.P2PBaseNode{PeerName: "local"},
+		History: latency_history.NewStore(10),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n.startAlerts(ctx, rules, loadAlertSilences())
+	if n.Alerts == nil {
+		t.Fatalf("Expected alerts started")
+	}
+
+	receive := func() latency_alert.Notification {
+		select {
+		case notification := <-received:
+			return notification
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Webhook not received")
+		}
+		return latency_alert.Notification{}
+	}
+	n.recordNodeLatencyHistory("192.168.0.2:9000", int64(100*time.Millisecond)) //节点不匹配
+	n.recordNodeLatencyHistory("10.0.0.2:9000", int64(100*time.Millisecond))
+	if fired := receive(); fired.Status != latency_alert.StatusFiring || fired.Node != "10.0.0.2:9000" || fired.Severity != "critical" {
+		t.Errorf("Unexpected firing notification %+v", fired)
+	}
+
+	w := httptest.NewRecorder()
+	n.handleAlerts(w, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	if !strings.Contains(w.Body.String(), `"Node":"10.0.0.2:9000"`) {
+		t.Errorf("Expected firing alert listed, got %s", w.Body.String())
+	}
+
+	n.recordNodeLatencyHistory("10.0.0.2:9000", int64(time.Millisecond))
+	if resolved := receive(); resolved.Status != latency_alert.StatusResolved {
+		t.Errorf("Unexpected resolved notification %+v", resolved)
+	}
+}
+
+// 通过API添加的静默生效, 需配置token, 时长受上限约束, 可按名称删除
+func TestHandleAlertSilence(t *testing.T) {
+	n := &P2PLatencyNode{}
+	w := httptest.NewRecorder()
+	n.handleAlerts(w, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without rules, got %d", w.Code)
+	}
+
+	n.Alerts = latency_alert.NewEvaluator([]latency_alert.Rule{{Name: "peer_slow", Metric: "node_latency", Threshold: 1}}, nil, nil)
+	form := url.Values{"rule": {"peer_slow"}, "node": {"10.0.0.*"}, "duration": {"1h"}, "name": {"maintenance"}}
+	token := ""
+	send := func(method string) *httptest.ResponseRecorder {
+		var r *http.Request
+		if method == http.MethodDelete {
+			r = httptest.NewRequest(method, "/api/alerts/silence?name="+url.QueryEscape(form.Get("name")), nil)
+		} else {
+			r = httptest.NewRequest(method, "/api/alerts/silence", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		n.handleAlertSilence(w, r)
+		return w
+	}
+	if w := send(http.MethodPost); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without silence_token configured, got %d", w.Code)
+	}
+	viper.Set("alerts.silence_token", "secret")
+	viper.Set("alerts.silence_max_duration_ms", 2*3600*1000)
+	defer viper.Set("alerts.silence_token", nil)
+	defer viper.Set("alerts.silence_max_duration_ms", nil)
+	token = "wrong"
+	if w := send(http.MethodPost); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for wrong token, got %d", w.Code)
+	}
+
+	token = "secret"
+	for _, duration := range []string{"bad", "-1h", "3h"} {
+		form.Set("duration", duration)
+		if w := send(http.MethodPost); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for duration %s, got %d", duration, w.Code)
+		}
+	}
+	form.Set("duration", "1h")
+	if w := send(http.MethodPost); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	n.Alerts.Observe("10.0.0.2:9000", "node_latency", time.Now().UnixNano(), 10)
+	if alerts := n.Alerts.Alerts(); len(alerts) != 1 || !alerts[0].Silenced || n.Alerts.Silences()[0].Rule != "peer_slow" {
+		t.Errorf("Expected silenced alert, got %+v", alerts)
+	}
+
+	if w := send(http.MethodDelete); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for delete, got %d: %s", w.Code, w.Body.String())
+	}
+	if alerts := n.Alerts.Alerts(); len(alerts) != 1 || alerts[0].Silenced || len(n.Alerts.Silences()) != 0 {
+		t.Errorf("Expected silence removed, got %+v", alerts)
+	}
+	if w := send(http.MethodDelete); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for deleting missing silence, got %d", w.Code)
+	}
+}
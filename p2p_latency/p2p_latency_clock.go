@@ -0,0 +1,88 @@
+package p2p_latency
+
+import (
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/config"
+)
+
+const (
+	clockHealthActionFlag    = "flag"    //保留延迟结果, 仅附带时钟状况
+	clockHealthActionDiscard = "discard" //丢弃依赖本地时钟的WS单向延迟
+)
+
+// 时钟健康检查设置
+type clockHealthSettings struct {
+	Checker  clock_health.Config
+	Action   string
+	Interval time.Duration
+}
+
+// 读取配置 clock_health.*, 未配置NTP服务器且未开启chrony时返回false
+func loadClockHealthSettings() (clockHealthSettings, bool) {
+	settings := clockHealthSettings{
+		Checker: clock_health.Config{
+			NtpServers:  config.GetConfigSlice("clock_health.ntp_servers"),
+			Samples:     config.GetConfigInt("clock_health.samples"),
+			Timeout:     time.Duration(config.GetConfigInt("clock_health.timeout_ms")) * time.Millisecond,
+			MaxOffset:   time.Duration(config.GetConfigFloat64("clock_health.max_offset_ms") * float64(time.Millisecond)),
+			MaxJitter:   time.Duration(config.GetConfigFloat64("clock_health.max_jitter_ms") * float64(time.Millisecond)),
+			RequireSync: config.GetConfigBool("clock_health.require_sync"),
+			ReadChrony:  config.GetConfigBool("clock_health.chrony"),
+		},
+		Action:   config.GetConfig("clock_health.action"),
+		Interval: time.Duration(config.GetConfigInt("clock_health.interval_ms")) * time.Millisecond,
+	}
+	if settings.Action != clockHealthActionDiscard {
+		settings.Action = clockHealthActionFlag
+	}
+	if settings.Interval <= 0 {
+		settings.Interval = time.Minute
+	}
+	return settings, len(settings.Checker.NtpServers) > 0 || settings.Checker.ReadChrony
+}
+
+// 执行一次本节点时钟健康检查
+func (n *P2PLatencyNode) checkClockHealth(checker *clock_health.Checker) clock_health.ClockHealth {
+	health := checker.Check()
+	n.NodeClockHealthMap.Store(n.Node.PeerName, health)
+	observeClockHealth(n.Node.PeerName, health)
+	if health.InTolerance {
+		log.Debugf("本地时钟正常: 来源 %s 时间差 %.3f ms 抖动 %.3f ms 同步 %v", health.Source,
+			float64(health.OffsetNs)/1000000, float64(health.JitterNs)/1000000, health.Synced)
+	} else {
+		log.Warnf("本地时钟超出容忍范围: %s", health.Reason)
+	}
+	return health
+}
+
+// 附带最近一次时钟检查结果, 时钟超出容忍范围时按配置标记或丢弃WS单向延迟
+func (n *P2PLatencyNode) applyClockHealth(result *ExchangeLatencyResult, action string) {
+	health, ok := n.NodeClockHealthMap.Load(n.Node.PeerName)
+	if !ok {
+		return
+	}
+	result.Clock = &health
+	if health.InTolerance || action != clockHealthActionDiscard {
+		return
+	}
+	log.Warnf("本地时钟超出容忍范围, 丢弃%s WS单向延迟: %s", result.Exchange, health.Reason)
+	result.Ws = nil
+}
+
+// 节点时钟状况响应结构
+type NodeClockHealthResponse struct {
+	NodeName string                   `json:"node_name"`
+	Clock    clock_health.ClockHealth `json:"clock"`
+}
+
+// 获取所有节点(含本节点)最近一次时钟检查结果
+func (n *P2PLatencyNode) GetClockHealthAll() []NodeClockHealthResponse {
+	var responses []NodeClockHealthResponse
+	n.NodeClockHealthMap.Range(func(nodeName string, health clock_health.ClockHealth) bool {
+		responses = append(responses, NodeClockHealthResponse{NodeName: nodeName, Clock: health})
+		return true
+	})
+	return responses
+}
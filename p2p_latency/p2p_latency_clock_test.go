@@ -0,0 +1,55 @@
+package p2p_latency
+
+import (
+	"testing"
+
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/myutils"
+	"github.com/Hongssd/cgolatencytest/p2p_base"
+)
+
+// 测试时钟超出容忍范围时按配置标记或丢弃WS单向延迟, 并记录远程节点时钟
+func TestApplyClockHealth(t *testing.T) {
+	n := &P2PLatencyNode{
+		Node:                   &p2p_base.P2PBaseNode{PeerName: "local"},
+		NodeExchangeLatencyMap: myutils.GetPointer(myutils.NewMySyncMap[nodeExchangeKey, ExchangeLatencyResult]()),
+		NodeClockHealthMap:     myutils.GetPointer(myutils.NewMySyncMap[string, clock_health.ClockHealth]()),
+	}
+	newResult := func() *ExchangeLatencyResult {
+		return &ExchangeLatencyResult{Exchange: "binance", Ws: map[string]WsLatencyResult{"spot": {LatencyNs: 1}}}
+	}
+
+	//未检查时钟时不附带
+	result := newResult()
+	n.applyClockHealth(result, clockHealthActionDiscard)
+	if result.Clock != nil || result.Ws == nil {
+		t.Errorf("Expected untouched result, got %+v", result)
+	}
+
+	n.NodeClockHealthMap.Store("local", clock_health.ClockHealth{CheckTimeNs: 1, OffsetNs: 50000000, Reason: "时间差超限"})
+	result = newResult()
+	n.applyClockHealth(result, clockHealthActionFlag)
+	if result.Clock == nil || result.Clock.InTolerance || result.Ws == nil {
+		t.Errorf("Expected flagged result, got %+v", result)
+	}
+	result = newResult()
+	n.applyClockHealth(result, clockHealthActionDiscard)
+	if result.Clock == nil || result.Ws != nil {
+		t.Errorf("Expected ws latency discarded, got %+v", result)
+	}
+
+	//远程节点结果携带的时钟状况按检查时间保留最新
+	for _, checkTime := range []int64{20, 10} {
+		data, _ := json.Marshal(ExchangeLatencyResult{Exchange: "okx", Clock: &clock_health.ClockHealth{CheckTimeNs: checkTime, InTolerance: true}})
+		msg := P2PMessage{Res: P2PRes{ReqType: P2PReqTypeExchangeLatency, ResData: string(data)}}
+		if err := n.handleExchangeLatencyMsgRes(msg, "remote"); err != nil {
+			t.Fatalf("handleExchangeLatencyMsgRes failed: %v", err)
+		}
+	}
+	if clock, ok := n.NodeClockHealthMap.Load("remote"); !ok || clock.CheckTimeNs != 20 {
+		t.Errorf("Expected latest remote clock, got %+v", clock)
+	}
+	if len(n.GetClockHealthAll()) != 2 {
+		t.Errorf("Expected clock health for 2 nodes, got %+v", n.GetClockHealthAll())
+	}
+}
@@ -0,0 +1,318 @@
+package p2p_latency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+
+	"github.com/google/uuid"
+)
+
+// 远程节点交易所延迟缓存键
+type nodeExchangeKey struct {
+	NodeName string
+	Exchange string
+}
+
+// 刷新交易所延迟信息
+func (n *P2PLatencyNode) refreshExchangeLatency(probe ExchangeProbe) error {
+	result, err := RunExchangeProbe(probe)
+	if err != nil {
+		return err
+	}
+	n.storeExchangeLatency(result)
+	return nil
+}
+
+// 附带时钟状况后存入本节点交易所延迟
+func (n *P2PLatencyNode) storeExchangeLatency(result *ExchangeLatencyResult) {
+	n.applyClockHealth(result, n.clockHealthAction)
+	n.ExchangeLatency.Store(result.Exchange, *result)
+	n.recordExchangeHistory(n.Node.PeerName, *result)
+	observeExchangeResult(n.Node.PeerName, *result)
+}
+
+// 初始化libcurl全局环境, 节点生命周期内只调用一次
+// C侧只以标志位记录是否已初始化, 各交易所并发测试时不能各自初始化及清理
+func initNodeLibcurl() (cleanup func(), err error) {
+	if err := http_client.InitLibcurl(); err != nil {
+		log.Error("libcurl初始化失败:", err)
+		return nil, err
+	}
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		log.Error("WebSocket libcurl初始化失败:", err)
+		http_client.CleanupLibcurl()
+		return nil, err
+	}
+	return func() {
+		http_client.CleanupWebSocketLibcurl()
+		http_client.CleanupLibcurl()
+	}, nil
+}
+
+// 按刷新间隔(默认每分钟)测试所有已注册交易所并广播, 直到ctx结束; 本地时钟首次检查完成后先刷新一次
+func (n *P2PLatencyNode) runExchangeSnapshots(ctx context.Context, clockChecked <-chan struct{}) {
+	cleanup, err := initNodeLibcurl()
+	if err != nil {
+		return
+	}
+	defer cleanup()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-clockChecked:
+	}
+
+	var wg sync.WaitGroup
+	for _, probe := range GetExchangeProbes() {
+		wg.Add(1)
+		go func(probe ExchangeProbe) {
+			defer wg.Done()
+			n.runExchangeSnapshot(ctx, probe)
+		}(probe)
+	}
+	wg.Wait()
+}
+
+func (n *P2PLatencyNode) runExchangeSnapshot(ctx context.Context, probe ExchangeProbe) {
+	refreshInterval := loadProbeSettings(probe.Name()).RefreshInterval
+	//首次刷新只存入本节点, 由定时刷新广播
+	if err := n.refreshExchangeLatency(probe); err != nil {
+		log.Error(err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("[%s]%s延迟计算协程退出", n.Node.PeerName, probe.Name())
+			return
+		case <-time.After(refreshInterval):
+			if err := n.refreshExchangeLatency(probe); err != nil {
+				log.Error(err)
+				continue
+			}
+			if err := n.broadcastExchangeLatencyMsg(probe.Name()); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// 持续测试所有已注册交易所, 直到ctx结束; 本地时钟首次检查完成后开始
+// 各交易所WS保持长连接, 按发布间隔存入并广播滚动窗口统计, HTTP等请求类测试按刷新间隔执行
+func (n *P2PLatencyNode) runExchangeStreams(ctx context.Context, streaming StreamingSettings, clockChecked <-chan struct{}) {
+	//长连接期间libcurl全局环境只初始化一次
+	cleanup, err := initNodeLibcurl()
+	if err != nil {
+		return
+	}
+	defer cleanup()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-clockChecked:
+	}
+
+	var wg sync.WaitGroup
+	for _, probe := range GetExchangeProbes() {
+		wg.Add(1)
+		go func(probe ExchangeProbe) {
+			defer wg.Done()
+			n.runExchangeStream(ctx, probe, streaming)
+		}(probe)
+	}
+	wg.Wait()
+}
+
+func (n *P2PLatencyNode) runExchangeStream(ctx context.Context, probe ExchangeProbe, streaming StreamingSettings) {
+	settings := loadProbeSettings(probe.Name())
+	stream := newExchangeStream(probe, settings, streaming)
+	log.Infof("[%s]%s开始持续测试, 窗口: %v, 发布间隔: %v", n.Node.PeerName, probe.Name(), streaming.Windows, streaming.PublishInterval)
+
+	//首次请求类测试得到服务器时间差后再开始接收WS行情, 之后按刷新间隔执行
+	stream.refresh()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(settings.RefreshInterval):
+				stream.refresh()
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		stream.runWs(ctx)
+	}()
+
+	ticker := time.NewTicker(streaming.PublishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			log.Infof("[%s]%s持续测试协程退出", n.Node.PeerName, probe.Name())
+			return
+		case <-ticker.C:
+			n.storeExchangeLatency(stream.snapshot(time.Now().UnixNano()))
+			if err := n.broadcastExchangeLatencyMsg(probe.Name()); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// 广播交易所延迟消息给所有远程P2P节点
+func (n *P2PLatencyNode) broadcastExchangeLatencyMsg(exchange string) error {
+	exchangeLatency, ok := n.ExchangeLatency.Load(exchange)
+	if !ok {
+		return fmt.Errorf("交易所[%s]延迟信息尚未生成", exchange)
+	}
+	exchangeLatencyData, err := json.Marshal(exchangeLatency)
+	if err != nil {
+		return err
+	}
+
+	//构建返回消息
+	p2pMsgRes := P2PMessage{
+		IsReq: false,
+		Res: P2PRes{
+			ReqId:        uuid.New().String(),
+			ReqType:      P2PReqTypeExchangeLatency,
+			ResData:      string(exchangeLatencyData),
+			ErrCode:      0,
+			ErrMsg:       "",
+			InTimestamp:  time.Now().UnixNano(),
+			OutTimestamp: time.Now().UnixNano(),
+		},
+	}
+	log.Infof("本地节点发送执行结果消息：%+v", p2pMsgRes)
+
+	p2pMsgResBytes, err := json.Marshal(p2pMsgRes)
+	if err != nil {
+		log.Errorf("Marshal error: %v", err)
+		return err
+	}
+	//广播交易所延迟消息给所有远程P2P节点
+	err = n.Node.BroadcastMsg(string(p2pMsgResBytes), true)
+	observeP2PMessageSent(P2PReqTypeExchangeLatency, err)
+	if err != nil {
+		log.Errorf("SendResMsg error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// 处理交易所延迟请求, ReqData为交易所名
+func (n *P2PLatencyNode) handleExchangeLatencyMsgReq(p2pMsg P2PMessage, fromPeerName string, inTimestamp int64) error {
+	exchangeLatency, ok := n.ExchangeLatency.Load(p2pMsg.Req.ReqData)
+	errCode, errMsg := 0, ""
+	if !ok {
+		errCode, errMsg = 404, fmt.Sprintf("交易所[%s]延迟信息不存在", p2pMsg.Req.ReqData)
+	}
+	exchangeLatencyData, err := json.Marshal(exchangeLatency)
+	if err != nil {
+		return err
+	}
+
+	//构建返回消息
+	p2pMsgRes := P2PMessage{
+		IsReq: false,
+		Req:   p2pMsg.Req,
+		Res: P2PRes{
+			ReqId:        p2pMsg.Req.ReqId,
+			ReqType:      p2pMsg.Req.ReqType,
+			ResData:      string(exchangeLatencyData),
+			ErrCode:      errCode,
+			ErrMsg:       errMsg,
+			InTimestamp:  inTimestamp,
+			OutTimestamp: time.Now().UnixNano(),
+		},
+	}
+
+	log.Infof("本地节点发送执行结果消息：%+v", p2pMsgRes)
+
+	p2pMsgResBytes, err := json.Marshal(p2pMsgRes)
+	if err != nil {
+		log.Errorf("Marshal error: %v", err)
+		return err
+	}
+	//发送返回消息给远程P2P节点
+	err = n.Node.SendMsg(fromPeerName, string(p2pMsgResBytes), true)
+	observeP2PMessageSent(p2pMsg.Req.ReqType, err)
+	if err != nil {
+		log.Errorf("SendResMsg error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (n *P2PLatencyNode) handleExchangeLatencyMsgRes(p2pMsg P2PMessage, fromPeerName string) error {
+	if p2pMsg.Res.ErrCode != 0 {
+		return fmt.Errorf("P2P节点[%s]返回交易所延迟失败: %s", fromPeerName, p2pMsg.Res.ErrMsg)
+	}
+	targetExchangeLatency := ExchangeLatencyResult{}
+	err := json.Unmarshal([]byte(p2pMsg.Res.ResData), &targetExchangeLatency)
+	if err != nil {
+		return err
+	}
+	if targetExchangeLatency.Exchange == "" {
+		return fmt.Errorf("P2P节点[%s]返回的交易所延迟缺少交易所名", fromPeerName)
+	}
+	n.storeNodeExchangeLatency(fromPeerName, targetExchangeLatency)
+	return nil
+}
+
+// 存入远程节点的交易所延迟, 并记录历史、指标及时钟状况
+func (n *P2PLatencyNode) storeNodeExchangeLatency(fromPeerName string, targetExchangeLatency ExchangeLatencyResult) {
+	//拉取请求的应答可能是已收到过的缓存结果, 不重复写入历史、推送及告警
+	key := nodeExchangeKey{fromPeerName, targetExchangeLatency.Exchange}
+	if last, ok := n.NodeExchangeLatencyMap.Load(key); !ok || targetExchangeLatency.UpdateTimeNs > last.UpdateTimeNs {
+		n.NodeExchangeLatencyMap.Store(key, targetExchangeLatency)
+		n.recordExchangeHistory(fromPeerName, targetExchangeLatency)
+		observeExchangeResult(fromPeerName, targetExchangeLatency)
+	}
+	if clock := targetExchangeLatency.Clock; clock != nil {
+		if last, ok := n.NodeClockHealthMap.Load(fromPeerName); !ok || clock.CheckTimeNs > last.CheckTimeNs {
+			n.NodeClockHealthMap.Store(fromPeerName, *clock)
+			observeClockHealth(fromPeerName, *clock)
+		}
+	}
+}
+
+// 通过节点名获取交易所延迟信息
+func (n *P2PLatencyNode) GetExchangeLatencyFromNodeName(exchange string, nodeName string) ExchangeLatencyResult {
+	if nodeName == n.Node.PeerName {
+		exchangeLatency, _ := n.ExchangeLatency.Load(exchange)
+		return exchangeLatency
+	}
+	exchangeLatency, ok := n.NodeExchangeLatencyMap.Load(nodeExchangeKey{nodeName, exchange})
+	if !ok {
+		return ExchangeLatencyResult{}
+	}
+	return exchangeLatency
+}
+
+// 获取所有节点的交易所延迟信息 nodeName -> result
+func (n *P2PLatencyNode) GetExchangeLatencyAll(exchange string) map[string]ExchangeLatencyResult {
+	exchangeLatencyMap := make(map[string]ExchangeLatencyResult)
+	n.NodeExchangeLatencyMap.Range(func(key nodeExchangeKey, value ExchangeLatencyResult) bool {
+		if key.Exchange == exchange {
+			exchangeLatencyMap[key.NodeName] = value
+		}
+		return true
+	})
+
+	if exchangeLatency, ok := n.ExchangeLatency.Load(exchange); ok {
+		exchangeLatencyMap[n.Node.PeerName] = exchangeLatency
+	}
+	return exchangeLatencyMap
+}
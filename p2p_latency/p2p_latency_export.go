@@ -0,0 +1,49 @@
+package p2p_latency
+
+import (
+	"context"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/config"
+	"github.com/Hongssd/cgolatencytest/latency_export"
+)
+
+// 读取配置 export.*, 未开启时返回false
+func loadExportConfig() (latency_export.Config, bool) {
+	if !config.GetConfigBool("export.enabled") {
+		return latency_export.Config{}, false
+	}
+	return latency_export.Config{
+		Format:        config.GetConfig("export.format"),
+		Protocol:      config.GetConfig("export.protocol"),
+		Address:       config.GetConfig("export.address"),
+		Token:         config.GetConfig("export.token"),
+		Prefix:        config.GetConfig("export.prefix"),
+		BatchSize:     config.GetConfigInt("export.batch_size"),
+		FlushInterval: time.Duration(config.GetConfigInt("export.flush_interval_ms")) * time.Millisecond,
+		MaxBuffer:     config.GetConfigInt("export.max_buffer"),
+		MaxPacket:     config.GetConfigInt("export.max_packet"),
+		Timeout:       time.Duration(config.GetConfigInt("export.timeout_ms")) * time.Millisecond,
+	}, true
+}
+
+// 创建推送器并在后台按批发送, 连续失败时仅在错误变化时打印
+func (n *P2PLatencyNode) startExporter(ctx context.Context, cfg latency_export.Config) {
+	exporter, err := latency_export.NewExporter(cfg)
+	if err != nil {
+		log.Errorf("创建推送器失败, 不推送测量值: %v", err)
+		return
+	}
+	log.Infof("推送测量值: %s %s %s", cfg.Format, cfg.Protocol, cfg.Address)
+	n.Exporter = exporter
+	go func() {
+		lastErr := ""
+		exporter.Run(ctx, func(err error) {
+			if err.Error() != lastErr {
+				stats := exporter.Stats()
+				log.Warnf("推送测量值失败, 待重试%d个点, 已丢弃%d个点: %v", stats.Pending, stats.Dropped, err)
+			}
+			lastErr = err.Error()
+		})
+	}()
+}
@@ -0,0 +1,66 @@
+package p2p_latency
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/latency_history"
+	"github.com/Hongssd/cgolatencytest/p2p_base"
+	"github.com/spf13/viper"
+)
+
+// 节点每个测量值按StatsD计时器推送到本地UDP监听
+func TestNodeExportStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	defer conn.Close()
+
+	if _, ok := loadExportConfig(); ok {
+		t.Errorf("Expected export disabled by default")
+	}
+	values := map[string]interface{}{
+		"export.enabled":           true,
+		"export.format":            "statsd",
+		"export.address":           conn.LocalAddr().String(),
+		"export.flush_interval_ms": 50,
+	}
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	defer func() {
+		for key := range values {
+			viper.Set(key, nil)
+		}
+	}()
+	cfg, ok := loadExportConfig()
+	if !ok || cfg.FlushInterval != 50*time.Millisecond {
+		t.Fatalf("Unexpected export config %+v", cfg)
+	}
+
+	n := &P2PLatencyNode{
+		Node:    &p2p_base.P2PBaseNode{PeerName: "local"},
+		History: latency_history.NewStore(10),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n.startExporter(ctx, cfg)
+	if n.Exporter == nil {
+		t.Fatalf("Expected exporter started")
+	}
+	n.recordNodeLatencyHistory("10.0.0.2:9000", int64(2500*time.Microsecond))
+
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	size, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if line := strings.TrimSpace(string(buf[:size])); line != "cgolatency.10_0_0_2_9000.node_latency:2.5|ms" {
+		t.Errorf("Unexpected statsd line %q", line)
+	}
+}
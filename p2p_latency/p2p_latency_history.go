@@ -0,0 +1,295 @@
+package p2p_latency
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/config"
+	"github.com/Hongssd/cgolatencytest/latency_export"
+	"github.com/Hongssd/cgolatencytest/latency_history"
+)
+
+const (
+	metricNodeLatency = "node_latency" //到目标节点的平均网络延迟
+
+	defaultHistoryCapacity = 4320             //每个序列保留的点数, 持续模式每10s一个点约12小时
+	defaultHistoryRange    = time.Hour        //未指定from时查询最近1小时
+	maxHistoryBuckets      = 10000            //单次查询最多返回的桶数
+	defaultHistoryStep     = 10 * time.Second //未指定step时的降采样步长
+
+	historyReplayRange     = 12 * time.Hour   //启动时从磁盘回放到内存的时长, 与默认容量相当
+	historyCompactInterval = 10 * time.Minute //磁盘分段清理及降采样间隔
+)
+
+// 读取配置 history.capacity
+func loadHistoryCapacity() int {
+	if capacity := config.GetConfigInt("history.capacity"); capacity > 0 {
+		return capacity
+	}
+	return defaultHistoryCapacity
+}
+
+// 读取配置 history.persist/dir/segment_ms/retention_hours/downsample_after_hours/downsample_step_ms
+// 默认写入 logs/history, 每小时一个分段, 保留7天, 超过1天的分段降采样到1分钟
+func loadHistoryDiskOptions() (latency_history.DiskOptions, bool) {
+	if config.GetConfig("history.persist") != "" && !config.GetConfigBool("history.persist") {
+		return latency_history.DiskOptions{}, false
+	}
+	opts := latency_history.DiskOptions{
+		Dir:             "logs/history",
+		SegmentDuration: time.Hour,
+		Retention:       7 * 24 * time.Hour,
+		DownsampleAfter: 24 * time.Hour,
+		DownsampleStep:  time.Minute,
+	}
+	if dir := config.GetConfig("history.dir"); dir != "" {
+		opts.Dir = dir
+	}
+	if ms := config.GetConfigInt("history.segment_ms"); ms > 0 {
+		opts.SegmentDuration = time.Duration(ms) * time.Millisecond
+	}
+	if config.GetConfig("history.retention_hours") != "" {
+		opts.Retention = time.Duration(config.GetConfigInt("history.retention_hours")) * time.Hour
+	}
+	if config.GetConfig("history.downsample_after_hours") != "" {
+		opts.DownsampleAfter = time.Duration(config.GetConfigInt("history.downsample_after_hours")) * time.Hour
+	}
+	if ms := config.GetConfigInt("history.downsample_step_ms"); ms > 0 {
+		opts.DownsampleStep = time.Duration(ms) * time.Millisecond
+	}
+	return opts, true
+}
+
+// 打开磁盘历史并回放最近的数据到内存, 之后定时清理及降采样
+func (n *P2PLatencyNode) startHistoryDisk(ctx context.Context, opts latency_history.DiskOptions) {
+	disk, err := latency_history.OpenDiskStore(opts)
+	if err != nil {
+		log.Errorf("打开磁盘历史失败, 仅保留内存历史: %v", err)
+		return
+	}
+	count := 0
+	err = disk.Replay(time.Now().Add(-historyReplayRange).UnixNano(), func(node string, metric string, p latency_history.Point) {
+		n.History.Record(node, metric, p.TimeNs, p.Value)
+		count++
+	})
+	if err != nil {
+		log.Warnf("回放磁盘历史失败: %v", err)
+	}
+	log.Infof("磁盘历史目录: %s, 已回放%d个数据点", opts.Dir, count)
+	n.HistoryDisk = disk
+
+	go func() {
+		defer disk.Close()
+		for {
+			if err := disk.Compact(time.Now().UnixNano()); err != nil {
+				log.Warnf("清理磁盘历史失败: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(historyCompactInterval):
+			}
+		}
+	}()
+}
+
+// 写入内存历史, 开启持久化时同时追加到磁盘, 开启推送时加入推送队列, 配置告警规则时评估告警
+func (n *P2PLatencyNode) recordHistory(nodeName string, metric string, timeNs int64, value float64) {
+	n.History.Record(nodeName, metric, timeNs, value)
+	if n.HistoryDisk != nil {
+		if err := n.HistoryDisk.Append(nodeName, metric, timeNs, value); err != nil {
+			log.Warnf("写入磁盘历史失败: %v", err)
+		}
+	}
+	if n.Exporter != nil {
+		n.Exporter.Push(latency_export.Point{Node: nodeName, Metric: metric, TimeNs: timeNs, Value: value})
+	}
+	if n.Alerts != nil {
+		n.Alerts.Observe(nodeName, metric, timeNs, value)
+	}
+}
+
+// 展开交易所延迟结果为 指标名 -> 纳秒值, 如 binance.ws.future / binance.ws.future.p99
+// 无成功样本的端点不输出, 避免把0记为延迟; 无分布的结果(如旧版节点)不输出p99
+func exchangeMetrics(result ExchangeLatencyResult) map[string]float64 {
+	metrics := make(map[string]float64)
+	prefix := result.Exchange + "."
+	for name, http := range result.Http {
+		if http.SuccessCount > 0 {
+			metrics[prefix+"http."+name] = float64(http.LatencyNs)
+			if http.Stats.Count > 0 {
+				metrics[prefix+"http."+name+".p99"] = float64(http.Stats.P99Ns)
+			}
+		}
+	}
+	for name, ws := range result.Ws {
+		if ws.SuccessCount > 0 {
+			metrics[prefix+"ws."+name] = float64(ws.LatencyNs)
+			if ws.Stats.Count > 0 {
+				metrics[prefix+"ws."+name+".p99"] = float64(ws.Stats.P99Ns)
+			}
+		}
+		if ws.PublishDelay != nil {
+			metrics[prefix+"ws."+name+".publish_delay"] = float64(ws.PublishDelayNs)
+		}
+	}
+	for name, rpc := range result.WsRpc {
+		if rpc.SuccessCount > 0 {
+			metrics[prefix+"ws_rpc."+name] = float64(rpc.RttNs)
+		}
+	}
+	if result.WsOrder != nil && result.WsOrder.AckRttNs > 0 {
+		metrics[prefix+"ws_order"] = float64(result.WsOrder.AckRttNs)
+	}
+	return metrics
+}
+
+// 记录节点交易所延迟历史, 时间取结果更新时间
+func (n *P2PLatencyNode) recordExchangeHistory(nodeName string, result ExchangeLatencyResult) {
+	if n.History == nil {
+		return
+	}
+	timeNs := result.UpdateTimeNs
+	if timeNs == 0 {
+		timeNs = time.Now().UnixNano()
+	}
+	for metric, value := range exchangeMetrics(result) {
+		n.recordHistory(nodeName, metric, timeNs, value)
+	}
+}
+
+// 记录到目标节点的平均网络延迟历史
+func (n *P2PLatencyNode) recordNodeLatencyHistory(nodeName string, latencyNs int64) {
+	if n.History == nil {
+		return
+	}
+	n.recordHistory(nodeName, metricNodeLatency, time.Now().UnixNano(), float64(latencyNs))
+}
+
+// 历史查询响应结构, 桶内值单位为纳秒
+type HistoryResponse struct {
+	NodeName string                   `json:"node_name"`
+	Metric   string                   `json:"metric"`
+	Points   []latency_history.Bucket `json:"points"`
+}
+
+// 解析时间参数: unix毫秒、RFC3339, 或相对当前时间的时长如 -3h
+func parseHistoryTime(value string, nowNs int64, def int64) (int64, error) {
+	if value == "" {
+		return def, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms * int64(time.Millisecond), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixNano(), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return nowNs + int64(d), nil
+	}
+	return 0, fmt.Errorf("无法解析时间: %s", value)
+}
+
+// 解析步长参数: 时长如 1m, 或毫秒数, 须大于0以限制返回的点数
+func parseHistoryStep(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultHistoryStep, nil
+	}
+	var d time.Duration
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		d = time.Duration(ms) * time.Millisecond
+	} else if d, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("无法解析步长: %s", value)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("步长必须大于0: %s", value)
+	}
+	return d, nil
+}
+
+// 历史查询API处理器
+// 查询参数: node 节点名(为空查询所有节点), metric 指标名(为空返回序列列表), from/to 时间范围, step 降采样步长
+func (n *P2PLatencyNode) handleHistory(w http.ResponseWriter, r *http.Request) {
+	writeResponse := func(status int, response ApiResponse) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+	if n == nil || n.History == nil {
+		writeResponse(http.StatusInternalServerError, ApiResponse{Code: 500, Message: "P2P节点未初始化", Data: nil})
+		return
+	}
+
+	query := r.URL.Query()
+	node, metric := query.Get("node"), query.Get("metric")
+	if metric == "" {
+		var series []latency_history.SeriesInfo
+		for _, info := range n.History.Series() {
+			if node == "" || info.Node == node {
+				series = append(series, info)
+			}
+		}
+		writeResponse(http.StatusOK, ApiResponse{Code: 200, Message: "查询成功", Data: series})
+		return
+	}
+
+	nowNs := time.Now().UnixNano()
+	to, err := parseHistoryTime(query.Get("to"), nowNs, nowNs)
+	if err != nil {
+		writeResponse(http.StatusBadRequest, ApiResponse{Code: 400, Message: err.Error(), Data: nil})
+		return
+	}
+	from, err := parseHistoryTime(query.Get("from"), nowNs, to-int64(defaultHistoryRange))
+	if err != nil {
+		writeResponse(http.StatusBadRequest, ApiResponse{Code: 400, Message: err.Error(), Data: nil})
+		return
+	}
+	step, err := parseHistoryStep(query.Get("step"))
+	if err != nil {
+		writeResponse(http.StatusBadRequest, ApiResponse{Code: 400, Message: err.Error(), Data: nil})
+		return
+	}
+	if from > to {
+		writeResponse(http.StatusBadRequest, ApiResponse{Code: 400, Message: "from不能晚于to", Data: nil})
+		return
+	}
+	if (to-from)/int64(step) > maxHistoryBuckets {
+		writeResponse(http.StatusBadRequest, ApiResponse{Code: 400, Message: fmt.Sprintf("步长过小, 最多返回%d个点", maxHistoryBuckets), Data: nil})
+		return
+	}
+	log.Infof("收到历史查询请求: 节点[%s] 指标[%s] %v ~ %v 步长 %v", node, metric, time.Unix(0, from), time.Unix(0, to), step)
+
+	//开启持久化时从磁盘读取, 覆盖重启前及超出内存容量的数据
+	seriesPoints := make(map[string][]latency_history.Point)
+	if n.HistoryDisk != nil {
+		seriesPoints, err = n.HistoryDisk.Query(node, metric, from, to)
+		if err != nil {
+			writeResponse(http.StatusInternalServerError, ApiResponse{Code: 500, Message: "读取磁盘历史失败: " + err.Error(), Data: nil})
+			return
+		}
+	} else {
+		for _, info := range n.History.Series() {
+			if info.Metric == metric && (node == "" || info.Node == node) {
+				seriesPoints[info.Node] = n.History.Query(info.Node, metric, from, to)
+			}
+		}
+	}
+	nodeNames := make([]string, 0, len(seriesPoints))
+	for nodeName := range seriesPoints {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	var responses []HistoryResponse
+	for _, nodeName := range nodeNames {
+		responses = append(responses, HistoryResponse{
+			NodeName: nodeName,
+			Metric:   metric,
+			Points:   latency_history.Downsample(seriesPoints[nodeName], from, int64(step)),
+		})
+	}
+	writeResponse(http.StatusOK, ApiResponse{Code: 200, Message: "查询成功", Data: responses})
+}
@@ -0,0 +1,176 @@
+package p2p_latency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/latency_history"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+	"github.com/Hongssd/cgolatencytest/myutils"
+	"github.com/Hongssd/cgolatencytest/p2p_base"
+)
+
+func TestExchangeMetrics(t *testing.T) {
+	result := ExchangeLatencyResult{
+		Exchange: "binance",
+		Http: map[string]HttpLatencyResult{
+			"spot": {LatencyNs: 100, SuccessCount: 1, Summary: latency_stats.Summary{Stats: latency_stats.LatencyStats{Count: 1, P99Ns: 150}}},
+			"down": {},
+		},
+		Ws: map[string]WsLatencyResult{
+			"future": {LatencyNs: 200, SuccessCount: 3, PublishDelayNs: 5, PublishDelay: &latency_stats.Summary{}},
+		},
+		WsRpc:   map[string]WsRpcLatencyResult{"api": {RttNs: 300, SuccessCount: 2}},
+		WsOrder: &WsOrderLatencyResult{AckRttNs: 400},
+	}
+	metrics := exchangeMetrics(result)
+	expected := map[string]float64{
+		"binance.http.spot":               100,
+		"binance.http.spot.p99":           150,
+		"binance.ws.future":               200,
+		"binance.ws.future.publish_delay": 5,
+		"binance.ws_rpc.api":              300,
+		"binance.ws_order":                400,
+	}
+	if len(metrics) != len(expected) {
+		t.Errorf("Expected %d metrics, got %v", len(expected), metrics)
+	}
+	for metric, value := range expected {
+		if got, ok := metrics[metric]; !ok || got != value {
+			t.Errorf("Expected %s = %v, got %v (%v)", metric, value, got, ok)
+		}
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	n := &P2PLatencyNode{
+		Node:    &p2p_base.P2PBaseNode{PeerName: "local"},
+		History: latency_history.NewStore(100),
+	}
+	nowNs := time.Now().UnixNano()
+	minute := int64(time.Minute)
+	for i := int64(0); i < 10; i++ {
+		n.History.Record("local", "binance.ws.spot", nowNs-i*minute, float64(i))
+		n.History.Record("remote", "binance.ws.spot", nowNs-i*minute, float64(10*i))
+	}
+	n.recordNodeLatencyHistory("remote", 1000)
+
+	get := func(query string) (int, ApiResponse) {
+		rec := httptest.NewRecorder()
+		n.handleHistory(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+query, nil))
+		var response ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Invalid response %s: %v", rec.Body.String(), err)
+		}
+		return rec.Code, response
+	}
+
+	//不指定指标时返回序列列表
+	if code, response := get("node=remote"); code != http.StatusOK || len(response.Data.([]interface{})) != 2 {
+		t.Errorf("Expected 2 remote series, got %d %+v", code, response)
+	}
+
+	//最近5分钟(含边界)按5分钟降采样, 每个节点各一个桶
+	rec := httptest.NewRecorder()
+	n.handleHistory(rec, httptest.NewRequest(http.MethodGet, "/api/history?metric=binance.ws.spot&from=-4m30s&step=5m", nil))
+	var response struct {
+		Code int
+		Data []HistoryResponse
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response %s: %v", rec.Body.String(), err)
+	}
+	if response.Code != 200 || len(response.Data) != 2 {
+		t.Fatalf("Expected 2 series, got %s", rec.Body.String())
+	}
+	for _, series := range response.Data {
+		if len(series.Points) != 1 || series.Points[0].Count != 5 {
+			t.Errorf("Expected one bucket of 5 points for %s, got %+v", series.NodeName, series.Points)
+		}
+	}
+	if remote := response.Data[1]; remote.NodeName != "remote" || remote.Points[0].Value != 20 || remote.Points[0].Max != 40 {
+		t.Errorf("Unexpected remote bucket %+v", remote)
+	}
+
+	for _, query := range []string{"metric=x&from=abc", "metric=x&step=1ns&from=-1h", "metric=x&step=0", "metric=x&step=-1m", "metric=x&step=0ms", "metric=x&from=-1h&to=-2h"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
+
+// 拉取应答中已收到过的结果不重复写入历史
+func TestHandleExchangeLatencyMsgResDedup(t *testing.T) {
+	n := &P2PLatencyNode{
+		Node:                   &p2p_base.P2PBaseNode{PeerName: "local"},
+		History:                latency_history.NewStore(100),
+		NodeExchangeLatencyMap: myutils.GetPointer(myutils.NewMySyncMap[nodeExchangeKey, ExchangeLatencyResult]()),
+		NodeClockHealthMap:     myutils.GetPointer(myutils.NewMySyncMap[string, clock_health.ClockHealth]()),
+	}
+	nowNs := time.Now().UnixNano()
+	for _, updateTimeNs := range []int64{nowNs, nowNs, nowNs - int64(time.Minute), nowNs + int64(time.Minute)} {
+		data, _ := json.Marshal(ExchangeLatencyResult{Exchange: "binance", UpdateTimeNs: updateTimeNs,
+			Ws: map[string]WsLatencyResult{"spot": {LatencyNs: updateTimeNs - nowNs + 1000, SuccessCount: 1}}})
+		msg := P2PMessage{Res: P2PRes{ReqType: P2PReqTypeExchangeLatency, ResData: string(data)}}
+		if err := n.handleExchangeLatencyMsgRes(msg, "remote"); err != nil {
+			t.Fatalf("handleExchangeLatencyMsgRes failed: %v", err)
+		}
+	}
+	points := n.History.Query("remote", "binance.ws.spot", 0, nowNs+int64(time.Hour))
+	if len(points) != 2 || points[0].TimeNs != nowNs || points[1].TimeNs != nowNs+int64(time.Minute) {
+		t.Errorf("Expected 2 distinct points, got %+v", points)
+	}
+	if latest := n.GetExchangeLatencyFromNodeName("binance", "remote"); latest.UpdateTimeNs != nowNs+int64(time.Minute) {
+		t.Errorf("Expected latest result kept, got %d", latest.UpdateTimeNs)
+	}
+}
+
+// 开启持久化时重启后仍可查询历史
+func TestHandleHistoryDisk(t *testing.T) {
+	opts := latency_history.DiskOptions{Dir: t.TempDir(), SegmentDuration: time.Hour}
+	newNode := func() *P2PLatencyNode {
+		n := &P2PLatencyNode{
+			Node:    &p2p_base.P2PBaseNode{PeerName: "local"},
+			History: latency_history.NewStore(100),
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		n.startHistoryDisk(ctx, opts)
+		if n.HistoryDisk == nil {
+			t.Fatalf("Expected disk history opened")
+		}
+		return n
+	}
+
+	n := newNode()
+	updateNs := time.Now().Add(-2 * time.Hour).UnixNano()
+	n.recordExchangeHistory("remote", ExchangeLatencyResult{
+		Exchange:     "okx",
+		UpdateTimeNs: updateNs,
+		Ws:           map[string]WsLatencyResult{"public": {LatencyNs: 300, SuccessCount: 1}},
+	})
+	n.HistoryDisk.Close()
+
+	//重启后内存历史由磁盘回放, 超出默认查询范围的点从磁盘读取
+	n = newNode()
+	if series := n.History.Series(); len(series) != 1 || series[0].Node != "remote" {
+		t.Errorf("Expected replayed series, got %+v", series)
+	}
+	rec := httptest.NewRecorder()
+	n.handleHistory(rec, httptest.NewRequest(http.MethodGet, "/api/history?node=remote&metric=okx.ws.public&from=-3h&step=1m", nil))
+	var response struct {
+		Code int
+		Data []HistoryResponse
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response %s: %v", rec.Body.String(), err)
+	}
+	if len(response.Data) != 1 || len(response.Data[0].Points) != 1 || response.Data[0].Points[0].Value != 300 ||
+		response.Data[0].Points[0].TimeNs > updateNs || response.Data[0].Points[0].TimeNs <= updateNs-int64(time.Minute) {
+		t.Errorf("Unexpected response %s", rec.Body.String())
+	}
+}
@@ -12,16 +12,10 @@ type ApiResponse struct {
 	Data    interface{} `json:"data"`
 }
 
-// 币安延迟响应结构
-type BnLatencyResponse struct {
-	NodeName string          `json:"node_name"`
-	Latency  BnLatencyResult `json:"latency"`
-}
-
-// OKX延迟响应结构
-type OkxLatencyResponse struct {
-	NodeName string           `json:"node_name"`
-	Latency  OkxLatencyResult `json:"latency"`
+// 交易所延迟响应结构
+type ExchangeLatencyResponse struct {
+	NodeName string                `json:"node_name"`
+	Latency  ExchangeLatencyResult `json:"latency"`
 }
 
 // 节点延迟响应结构
@@ -30,9 +24,13 @@ type NodeLatencyResponse struct {
 	Latency  int64  `json:"latency_us"`
 }
 
-// 币安延迟API处理器
-func (n *P2PLatencyNode) handleBnLatency(w http.ResponseWriter, r *http.Request) {
-	log.Infof("收到币安延迟查询请求")
+// 交易所延迟API处理器, 查询参数 exchange 指定交易所
+func (n *P2PLatencyNode) handleExchangeLatency(w http.ResponseWriter, r *http.Request) {
+	n.writeExchangeLatency(w, r.URL.Query().Get("exchange"))
+}
+
+func (n *P2PLatencyNode) writeExchangeLatency(w http.ResponseWriter, exchange string) {
+	log.Infof("收到%s延迟查询请求", exchange)
 
 	if n == nil {
 		response := ApiResponse{
@@ -46,15 +44,27 @@ func (n *P2PLatencyNode) handleBnLatency(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	bnLatencyAll := n.GetBnLatencyAll()
-	var responses []BnLatencyResponse
+	if _, ok := GetExchangeProbe(exchange); !ok {
+		response := ApiResponse{
+			Code:    400,
+			Message: fmt.Sprintf("不支持的交易所: %s", exchange),
+			Data:    nil,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	exchangeLatencyAll := n.GetExchangeLatencyAll(exchange)
+	var responses []ExchangeLatencyResponse
 
-	for nodeName, latency := range bnLatencyAll {
-		responses = append(responses, BnLatencyResponse{
+	for nodeName, latency := range exchangeLatencyAll {
+		responses = append(responses, ExchangeLatencyResponse{
 			NodeName: nodeName,
 			Latency:  latency,
 		})
-		log.Infof("节点[%s]币安延迟信息: %+v", nodeName, latency)
+		log.Infof("节点[%s]%s延迟信息: %+v", nodeName, exchange, latency)
 	}
 
 	response := ApiResponse{
@@ -67,9 +77,26 @@ func (n *P2PLatencyNode) handleBnLatency(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
-// OKX延迟API处理器
-func (n *P2PLatencyNode) handleOkxLatency(w http.ResponseWriter, r *http.Request) {
-	log.Infof("收到OKX延迟查询请求")
+// 已注册交易所列表API处理器
+func (n *P2PLatencyNode) handleExchanges(w http.ResponseWriter, r *http.Request) {
+	var exchanges []string
+	for _, probe := range GetExchangeProbes() {
+		exchanges = append(exchanges, probe.Name())
+	}
+
+	response := ApiResponse{
+		Code:    200,
+		Message: "查询成功",
+		Data:    exchanges,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// 节点延迟API处理器
+func (n *P2PLatencyNode) handleNodeLatency(w http.ResponseWriter, r *http.Request) {
+	log.Infof("收到节点延迟查询请求")
 
 	if n == nil {
 		response := ApiResponse{
@@ -83,15 +110,15 @@ func (n *P2PLatencyNode) handleOkxLatency(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	okxLatencyAll := n.GetOkxLatencyAll()
-	var responses []OkxLatencyResponse
+	nodeLatencyAll := n.GetAllAvgLatency()
+	var responses []NodeLatencyResponse
 
-	for nodeName, latency := range okxLatencyAll {
-		responses = append(responses, OkxLatencyResponse{
+	for nodeName, latency := range nodeLatencyAll {
+		responses = append(responses, NodeLatencyResponse{
 			NodeName: nodeName,
 			Latency:  latency,
 		})
-		log.Infof("节点[%s]OKX延迟信息: %+v", nodeName, latency)
+		log.Infof("节点[%s]平均延迟信息: %+v", nodeName, latency)
 	}
 
 	response := ApiResponse{
@@ -104,9 +131,9 @@ func (n *P2PLatencyNode) handleOkxLatency(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(response)
 }
 
-// 节点延迟API处理器
-func (n *P2PLatencyNode) handleNodeLatency(w http.ResponseWriter, r *http.Request) {
-	log.Infof("收到节点延迟查询请求")
+// 节点时钟状况API处理器
+func (n *P2PLatencyNode) handleClockHealth(w http.ResponseWriter, r *http.Request) {
+	log.Infof("收到节点时钟状况查询请求")
 
 	if n == nil {
 		response := ApiResponse{
@@ -120,21 +147,10 @@ func (n *P2PLatencyNode) handleNodeLatency(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	nodeLatencyAll := n.GetAllAvgLatency()
-	var responses []NodeLatencyResponse
-
-	for nodeName, latency := range nodeLatencyAll {
-		responses = append(responses, NodeLatencyResponse{
-			NodeName: nodeName,
-			Latency:  latency,
-		})
-		log.Infof("节点[%s]平均延迟信息: %+v", nodeName, latency)
-	}
-
 	response := ApiResponse{
 		Code:    200,
 		Message: "查询成功",
-		Data:    responses,
+		Data:    n.GetClockHealthAll(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -144,9 +160,16 @@ func (n *P2PLatencyNode) handleNodeLatency(w http.ResponseWriter, r *http.Reques
 // 启动HTTP服务器
 func (n *P2PLatencyNode) StartHTTPServer(http_port int) {
 	// 注册API路由
-	http.HandleFunc("/api/bn-latency", n.handleBnLatency)
-	http.HandleFunc("/api/okx-latency", n.handleOkxLatency)
+	http.HandleFunc("/api/exchanges", n.handleExchanges)
+	http.HandleFunc("/api/exchange-latency", n.handleExchangeLatency)
+	http.HandleFunc("/api/bn-latency", n.legacyLatencyHandler(P2PReqTypeBnLatency))
+	http.HandleFunc("/api/okx-latency", n.legacyLatencyHandler(P2PReqTypeOkxLatency))
 	http.HandleFunc("/api/node-latency", n.handleNodeLatency)
+	http.HandleFunc("/api/clock-health", n.handleClockHealth)
+	http.HandleFunc("/api/history", n.handleHistory)
+	http.HandleFunc("/api/alerts", n.handleAlerts)
+	http.HandleFunc("/api/alerts/silence", n.handleAlertSilence)
+	http.Handle("/metrics", metricsHandler())
 
 	// 启动服务器
 	if http_port == 0 {
@@ -155,9 +178,17 @@ func (n *P2PLatencyNode) StartHTTPServer(http_port int) {
 	serverAddr := fmt.Sprintf(":%d", http_port)
 	log.Infof("HTTP服务器启动，监听端口: %d", http_port)
 	log.Infof("API端点:")
-	log.Infof("  GET /api/bn-latency - 查询币安延迟")
-	log.Infof("  GET /api/okx-latency - 查询OKX延迟")
+	log.Infof("  GET /api/exchanges - 查询已注册交易所")
+	log.Infof("  GET /api/exchange-latency?exchange= - 查询指定交易所延迟")
+	log.Infof("  GET /api/bn-latency - 查询币安延迟(旧版结构)")
+	log.Infof("  GET /api/okx-latency - 查询OKX延迟(旧版结构)")
 	log.Infof("  GET /api/node-latency - 查询节点延迟")
+	log.Infof("  GET /api/clock-health - 查询各节点时钟状况")
+	log.Infof("  GET /api/history?node=&metric=&from=&to=&step= - 查询延迟历史")
+	log.Infof("  GET /api/alerts - 查询当前告警、静默及规则")
+	log.Infof("  POST /api/alerts/silence?rule=&node=&duration= - 添加告警静默(需silence_token)")
+	log.Infof("  DELETE /api/alerts/silence?name= - 删除告警静默(需silence_token)")
+	log.Infof("  GET /metrics - Prometheus指标")
 
 	err := http.ListenAndServe(serverAddr, nil)
 	if err != nil {
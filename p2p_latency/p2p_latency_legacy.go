@@ -0,0 +1,251 @@
+package p2p_latency
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 旧版币安延迟结构, 用于 bn_latency 消息及 /api/bn-latency
+type BnLatencyResult struct {
+	HttpBinanceSpotLatencyNs      int64                //BN SPOT HTTP 纳秒延迟
+	HttpBinanceFutureLatencyNs    int64                //BN FUTURE HTTP 纳秒延迟
+	HttpBinanceDeliveryLatencyNs  int64                //BN DELIVERY HTTP 纳秒延迟
+	HttpBinancePortfolioLatencyNs int64                //BN PORTFOLIO HTTP 纳秒延迟
+	WsBinanceSpotLatencyNs        int64                //BN SPOT WS 纳秒延迟
+	WsBinanceFutureLatencyNs      int64                //BN FUTURE WS 纳秒延迟
+	WsBinanceDeliveryLatencyNs    int64                //BN DELIVERY WS 纳秒延迟
+	WsBinanceSpotSeq              WsSeqResult          //BN SPOT WS 深度连续性
+	WsBinanceFutureSeq            WsSeqResult          //BN FUTURE WS 深度连续性
+	WsBinanceDeliverySeq          WsSeqResult          //BN DELIVERY WS 深度连续性
+	WsBinanceOrderLatency         WsOrderLatencyResult //BN WS API 下单延迟
+}
+
+// 旧版OKX延迟结构, 用于 okx_latency 消息及 /api/okx-latency
+type OkxLatencyResult struct {
+	HttpOkxLatencyNs  int64                //OKX HTTP 纳秒延迟
+	WsOkxLatencyNs    int64                //OKX WS 纳秒延迟
+	WsOkxOrderLatency WsOrderLatencyResult //OKX 私有WS 登录及下单延迟
+	WsOkxSeq          WsSeqResult          //OKX WS 行情连续性
+}
+
+// 币安延迟响应结构
+type BnLatencyResponse struct {
+	NodeName string          `json:"node_name"`
+	Latency  BnLatencyResult `json:"latency"`
+}
+
+// OKX延迟响应结构
+type OkxLatencyResponse struct {
+	NodeName string           `json:"node_name"`
+	Latency  OkxLatencyResult `json:"latency"`
+}
+
+// 旧版消息类型对应的交易所
+var legacyLatencyExchanges = map[P2PReqType]string{
+	P2PReqTypeBnLatency:  "binance",
+	P2PReqTypeOkxLatency: "okx",
+}
+
+func toBnLatencyResult(r ExchangeLatencyResult) BnLatencyResult {
+	result := BnLatencyResult{
+		HttpBinanceSpotLatencyNs:      r.Http["spot"].LatencyNs,
+		HttpBinanceFutureLatencyNs:    r.Http["future"].LatencyNs,
+		HttpBinanceDeliveryLatencyNs:  r.Http["delivery"].LatencyNs,
+		HttpBinancePortfolioLatencyNs: r.Http["portfolio"].LatencyNs,
+		WsBinanceSpotLatencyNs:        r.Ws["spot"].LatencyNs,
+		WsBinanceFutureLatencyNs:      r.Ws["future"].LatencyNs,
+		WsBinanceDeliveryLatencyNs:    r.Ws["delivery"].LatencyNs,
+		WsBinanceSpotSeq:              r.Ws["spot"].Seq,
+		WsBinanceFutureSeq:            r.Ws["future"].Seq,
+		WsBinanceDeliverySeq:          r.Ws["delivery"].Seq,
+	}
+	if r.WsOrder != nil {
+		result.WsBinanceOrderLatency = *r.WsOrder
+	}
+	return result
+}
+
+func toOkxLatencyResult(r ExchangeLatencyResult) OkxLatencyResult {
+	result := OkxLatencyResult{
+		HttpOkxLatencyNs: r.Http["api"].LatencyNs,
+		WsOkxLatencyNs:   r.Ws["public"].LatencyNs,
+		WsOkxSeq:         r.Ws["public"].Seq,
+	}
+	if r.WsOrder != nil {
+		result.WsOkxOrderLatency = *r.WsOrder
+	}
+	return result
+}
+
+// 旧版结构未测到的端点延迟为0, 转换时跳过; 不带成功次数, 有延迟的端点计为1次成功
+func (b BnLatencyResult) toExchangeLatencyResult(updateTimeNs int64) ExchangeLatencyResult {
+	result := ExchangeLatencyResult{Exchange: "binance", UpdateTimeNs: updateTimeNs, Http: map[string]HttpLatencyResult{}, Ws: map[string]WsLatencyResult{}}
+	for name, latencyNs := range map[string]int64{
+		"spot":      b.HttpBinanceSpotLatencyNs,
+		"future":    b.HttpBinanceFutureLatencyNs,
+		"delivery":  b.HttpBinanceDeliveryLatencyNs,
+		"portfolio": b.HttpBinancePortfolioLatencyNs,
+	} {
+		if latencyNs != 0 {
+			result.Http[name] = HttpLatencyResult{LatencyNs: latencyNs, SuccessCount: 1}
+		}
+	}
+	for name, ws := range map[string]WsLatencyResult{
+		"spot":     {LatencyNs: b.WsBinanceSpotLatencyNs, Seq: b.WsBinanceSpotSeq},
+		"future":   {LatencyNs: b.WsBinanceFutureLatencyNs, Seq: b.WsBinanceFutureSeq},
+		"delivery": {LatencyNs: b.WsBinanceDeliveryLatencyNs, Seq: b.WsBinanceDeliverySeq},
+	} {
+		if ws.LatencyNs != 0 {
+			ws.SuccessCount = 1
+			result.Ws[name] = ws
+		}
+	}
+	if b.WsBinanceOrderLatency.SuccessCount > 0 {
+		order := b.WsBinanceOrderLatency
+		result.WsOrder = &order
+	}
+	return result
+}
+
+func (o OkxLatencyResult) toExchangeLatencyResult(updateTimeNs int64) ExchangeLatencyResult {
+	result := ExchangeLatencyResult{Exchange: "okx", UpdateTimeNs: updateTimeNs, Http: map[string]HttpLatencyResult{}, Ws: map[string]WsLatencyResult{}}
+	if o.HttpOkxLatencyNs != 0 {
+		result.Http["api"] = HttpLatencyResult{LatencyNs: o.HttpOkxLatencyNs, SuccessCount: 1}
+	}
+	if o.WsOkxLatencyNs != 0 {
+		result.Ws["public"] = WsLatencyResult{LatencyNs: o.WsOkxLatencyNs, SuccessCount: 1, Seq: o.WsOkxSeq}
+	}
+	if o.WsOkxOrderLatency.SuccessCount > 0 {
+		order := o.WsOkxOrderLatency
+		result.WsOrder = &order
+	}
+	return result
+}
+
+// 按旧版消息类型序列化交易所延迟
+func marshalLegacyLatency(reqType P2PReqType, r ExchangeLatencyResult) ([]byte, error) {
+	switch reqType {
+	case P2PReqTypeBnLatency:
+		return json.Marshal(toBnLatencyResult(r))
+	case P2PReqTypeOkxLatency:
+		return json.Marshal(toOkxLatencyResult(r))
+	default:
+		return nil, fmt.Errorf("不支持的旧版消息类型: %s", reqType)
+	}
+}
+
+// 按旧版消息类型解析交易所延迟, 旧版结构不带更新时间, 以收到时间代替
+func unmarshalLegacyLatency(reqType P2PReqType, data string, recvTimeNs int64) (ExchangeLatencyResult, error) {
+	switch reqType {
+	case P2PReqTypeBnLatency:
+		var bnLatency BnLatencyResult
+		if err := json.Unmarshal([]byte(data), &bnLatency); err != nil {
+			return ExchangeLatencyResult{}, err
+		}
+		return bnLatency.toExchangeLatencyResult(recvTimeNs), nil
+	case P2PReqTypeOkxLatency:
+		var okxLatency OkxLatencyResult
+		if err := json.Unmarshal([]byte(data), &okxLatency); err != nil {
+			return ExchangeLatencyResult{}, err
+		}
+		return okxLatency.toExchangeLatencyResult(recvTimeNs), nil
+	default:
+		return ExchangeLatencyResult{}, fmt.Errorf("不支持的旧版消息类型: %s", reqType)
+	}
+}
+
+// 处理旧版节点的币安/OKX延迟请求, 按旧版结构返回
+func (n *P2PLatencyNode) handleLegacyLatencyMsgReq(p2pMsg P2PMessage, fromPeerName string, inTimestamp int64) error {
+	exchangeLatency, _ := n.ExchangeLatency.Load(legacyLatencyExchanges[p2pMsg.Req.ReqType])
+	legacyLatencyData, err := marshalLegacyLatency(p2pMsg.Req.ReqType, exchangeLatency)
+	if err != nil {
+		return err
+	}
+
+	//构建返回消息
+	p2pMsgRes := P2PMessage{
+		IsReq: false,
+		Req:   p2pMsg.Req,
+		Res: P2PRes{
+			ReqId:        p2pMsg.Req.ReqId,
+			ReqType:      p2pMsg.Req.ReqType,
+			ResData:      string(legacyLatencyData),
+			ErrCode:      0,
+			ErrMsg:       "",
+			InTimestamp:  inTimestamp,
+			OutTimestamp: time.Now().UnixNano(),
+		},
+	}
+
+	log.Infof("本地节点发送执行结果消息：%+v", p2pMsgRes)
+
+	p2pMsgResBytes, err := json.Marshal(p2pMsgRes)
+	if err != nil {
+		log.Errorf("Marshal error: %v", err)
+		return err
+	}
+	//发送返回消息给远程P2P节点
+	err = n.Node.SendMsg(fromPeerName, string(p2pMsgResBytes), true)
+	observeP2PMessageSent(p2pMsg.Req.ReqType, err)
+	if err != nil {
+		log.Errorf("SendResMsg error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// 处理旧版节点广播的币安/OKX延迟, 转为交易所延迟存入缓存
+func (n *P2PLatencyNode) handleLegacyLatencyMsgRes(p2pMsg P2PMessage, fromPeerName string, inTimestamp int64) error {
+	targetExchangeLatency, err := unmarshalLegacyLatency(p2pMsg.Res.ReqType, p2pMsg.Res.ResData, inTimestamp)
+	if err != nil {
+		return err
+	}
+	n.storeNodeExchangeLatency(fromPeerName, targetExchangeLatency)
+	return nil
+}
+
+// 旧路由 /api/bn-latency、/api/okx-latency 处理器, 按旧版结构返回
+func (n *P2PLatencyNode) legacyLatencyHandler(reqType P2PReqType) http.HandlerFunc {
+	exchange := legacyLatencyExchanges[reqType]
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Infof("收到%s延迟查询请求", exchange)
+
+		if n == nil {
+			response := ApiResponse{
+				Code:    500,
+				Message: "P2P节点未初始化",
+				Data:    nil,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		var responses interface{}
+		switch reqType {
+		case P2PReqTypeBnLatency:
+			var bnResponses []BnLatencyResponse
+			for nodeName, latency := range n.GetExchangeLatencyAll(exchange) {
+				bnResponses = append(bnResponses, BnLatencyResponse{NodeName: nodeName, Latency: toBnLatencyResult(latency)})
+			}
+			responses = bnResponses
+		case P2PReqTypeOkxLatency:
+			var okxResponses []OkxLatencyResponse
+			for nodeName, latency := range n.GetExchangeLatencyAll(exchange) {
+				okxResponses = append(okxResponses, OkxLatencyResponse{NodeName: nodeName, Latency: toOkxLatencyResult(latency)})
+			}
+			responses = okxResponses
+		}
+
+		response := ApiResponse{
+			Code:    200,
+			Message: "查询成功",
+			Data:    responses,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,69 @@
+package p2p_latency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Hongssd/cgolatencytest/clock_health"
+	"github.com/Hongssd/cgolatencytest/latency_history"
+	"github.com/Hongssd/cgolatencytest/myutils"
+	"github.com/Hongssd/cgolatencytest/p2p_base"
+)
+
+// 旧版节点广播的币安/OKX延迟可被解析存入, 旧路由按旧版结构返回
+func TestLegacyLatency(t *testing.T) {
+	n := &P2PLatencyNode{
+		Node:                   &p2p_base.P2PBaseNode{PeerName: "local"},
+		History:                latency_history.NewStore(100),
+		ExchangeLatency:        myutils.GetPointer(myutils.NewMySyncMap[string, ExchangeLatencyResult]()),
+		NodeExchangeLatencyMap: myutils.GetPointer(myutils.NewMySyncMap[nodeExchangeKey, ExchangeLatencyResult]()),
+		NodeClockHealthMap:     myutils.GetPointer(myutils.NewMySyncMap[string, clock_health.ClockHealth]()),
+	}
+
+	data, _ := json.Marshal(BnLatencyResult{HttpBinanceSpotLatencyNs: 1000, WsBinanceFutureLatencyNs: 2000, WsBinanceFutureSeq: WsSeqResult{GapCount: 3}})
+	msg := P2PMessage{Res: P2PRes{ReqType: P2PReqTypeBnLatency, ResData: string(data)}}
+	if err := n.handleLegacyLatencyMsgRes(msg, "old", 100); err != nil {
+		t.Fatalf("handleLegacyLatencyMsgRes failed: %v", err)
+	}
+	bn := n.GetExchangeLatencyFromNodeName("binance", "old")
+	if bn.UpdateTimeNs != 100 || bn.Http["spot"].LatencyNs != 1000 || bn.Ws["future"].Seq.GapCount != 3 {
+		t.Errorf("Expected converted binance result, got %+v", bn)
+	}
+	if _, ok := bn.Http["future"]; ok || bn.WsOrder != nil {
+		t.Errorf("Expected unmeasured endpoints skipped, got %+v", bn)
+	}
+	if points := n.History.Query("old", "binance.ws.future", 0, 200); len(points) != 1 {
+		t.Errorf("Expected legacy result recorded in history, got %+v", points)
+	}
+
+	data, _ = json.Marshal(OkxLatencyResult{WsOkxLatencyNs: 3000, WsOkxOrderLatency: WsOrderLatencyResult{AckRttNs: 5, SuccessCount: 1}})
+	msg = P2PMessage{Res: P2PRes{ReqType: P2PReqTypeOkxLatency, ResData: string(data)}}
+	if err := n.handleLegacyLatencyMsgRes(msg, "old", 100); err != nil {
+		t.Fatalf("handleLegacyLatencyMsgRes failed: %v", err)
+	}
+	n.ExchangeLatency.Store("okx", ExchangeLatencyResult{Exchange: "okx", Http: map[string]HttpLatencyResult{"api": {LatencyNs: 4000}}})
+
+	recorder := httptest.NewRecorder()
+	n.legacyLatencyHandler(P2PReqTypeOkxLatency)(recorder, httptest.NewRequest(http.MethodGet, "/api/okx-latency", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+	var response struct {
+		Data []OkxLatencyResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	latencies := map[string]OkxLatencyResult{}
+	for _, r := range response.Data {
+		latencies[r.NodeName] = r.Latency
+	}
+	if latencies["local"].HttpOkxLatencyNs != 4000 || latencies["old"].WsOkxLatencyNs != 3000 || latencies["old"].WsOkxOrderLatency.AckRttNs != 5 {
+		t.Errorf("Expected legacy okx response, got %+v", latencies)
+	}
+	if !strings.Contains(recorder.Body.String(), `"HttpOkxLatencyNs"`) {
+		t.Errorf("Expected legacy field names, got %s", recorder.Body.String())
+	}
+}
@@ -3,7 +3,10 @@ package p2p_latency
 type P2PReqType string
 
 const (
-	P2PReqTypeLatency    P2PReqType = "latency"     //网络延迟消息
+	P2PReqTypeLatency         P2PReqType = "latency"          //网络延迟消息
+	P2PReqTypeExchangeLatency P2PReqType = "exchange_latency" //交易所延迟消息, 请求ReqData为交易所名
+
+	//旧版节点的交易所延迟消息, 滚动升级期间仍需收发, 数据结构见 BnLatencyResult / OkxLatencyResult
 	P2PReqTypeBnLatency  P2PReqType = "bn_latency"  //币安延迟消息
 	P2PReqTypeOkxLatency P2PReqType = "okx_latency" //OKX延迟消息
 )
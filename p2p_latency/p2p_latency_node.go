@@ -5,9 +5,20 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Hongssd/cgolatencytest/config"
 	"github.com/google/uuid"
 )
 
+const defaultNodeLatencyInterval = time.Minute
+
+// 读取配置 node_latency.interval_ms, 节点平均延迟广播间隔, 默认1分钟
+func loadNodeLatencyInterval() time.Duration {
+	if ms := config.GetConfigInt("node_latency.interval_ms"); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultNodeLatencyInterval
+}
+
 // 广播节点平均延迟
 func (n *P2PLatencyNode) broadcastAvgLatencyMsg() error {
 	var timestampStr = strconv.FormatInt(time.Now().UnixNano(), 10)
@@ -30,6 +41,7 @@ func (n *P2PLatencyNode) broadcastAvgLatencyMsg() error {
 	}
 	//广播
 	err = n.Node.BroadcastMsg(string(p2pReqMsgBytes), true)
+	observeP2PMessageSent(P2PReqTypeLatency, err)
 	if err != nil {
 		return fmt.Errorf("广播网络平均延迟消息失败: %v", err)
 	}
@@ -56,6 +68,8 @@ func (n *P2PLatencyNode) handleAvgLatencyMsg(p2pMsg P2PMessage, fromPeerName str
 	}
 
 	n.NodeAvgLatencyMap.Store(fromPeerName, newAvgLatency)
+	n.recordNodeLatencyHistory(fromPeerName, newAvgLatency)
+	observePeerLatency(fromPeerName, newAvgLatency)
 	log.Infof("更新目标节点[%s]网络平均延迟: %.6fms -> %.6fms", fromPeerName,
 		float64(nowAvgLatency)/1000000, float64(newAvgLatency)/1000000)
 	return nil
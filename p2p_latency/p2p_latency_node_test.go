@@ -0,0 +1,19 @@
+package p2p_latency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadNodeLatencyInterval(t *testing.T) {
+	if interval := loadNodeLatencyInterval(); interval != defaultNodeLatencyInterval {
+		t.Errorf("Expected default interval, got %v", interval)
+	}
+	viper.Set("node_latency.interval_ms", 15000)
+	defer viper.Set("node_latency.interval_ms", nil)
+	if interval := loadNodeLatencyInterval(); interval != 15*time.Second {
+		t.Errorf("Expected configured interval, got %v", interval)
+	}
+}
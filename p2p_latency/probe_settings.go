@@ -0,0 +1,130 @@
+package p2p_latency
+
+import (
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/config"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+)
+
+// 单个交易所延迟测试的样本数、超时及节奏
+// 样本数与采集时长任一达到即停止, 为0表示不限制该条件
+type ProbeSettings struct {
+	ServerTimeSamples int           //服务器时间校准请求次数
+	HttpSamples       int           //每个HTTP端点的延迟样本数
+	HttpDuration      time.Duration //每个HTTP端点的采集时长
+	HttpInterval      time.Duration //相邻HTTP请求间隔
+	HttpWarmup        time.Duration //校准时间后到开始采集的等待
+	HttpTimeoutMs     int
+	WsMessages        int           //每个WS端点接收的行情数
+	WsDuration        time.Duration //每个WS端点的采集时长
+	WsWarmup          time.Duration //HTTP测试结束到开始WS测试的等待
+	WsTimeoutMs       int
+	RpcSamples        int //WS JSON-RPC请求次数
+	RpcTimeoutMs      int
+	RefreshInterval   time.Duration //节点定时刷新间隔
+	BackendFanout     bool          //解析端点全部A/AAAA记录, 逐个后端IP固定解析测试
+	Filter            latency_stats.Filter
+}
+
+// 未配置时的默认值
+func defaultProbeSettings() ProbeSettings {
+	return ProbeSettings{
+		ServerTimeSamples: 5,
+		HttpSamples:       5,
+		HttpWarmup:        5 * time.Second,
+		HttpTimeoutMs:     3000,
+		WsMessages:        500,
+		WsWarmup:          2 * time.Second,
+		WsTimeoutMs:       5000,
+		RpcSamples:        5,
+		RpcTimeoutMs:      3000,
+		RefreshInterval:   time.Minute,
+		Filter:            latency_stats.Filter{Mode: latency_stats.FilterNone},
+	}
+}
+
+// 读取配置 probe.<exchange>.*, 未配置的项依次回退到 probe.defaults.* 及默认值
+func loadProbeSettings(exchange string) ProbeSettings {
+	s := defaultProbeSettings()
+	getInt := func(key string, def int) int {
+		for _, name := range []string{"probe." + exchange + "." + key, "probe.defaults." + key} {
+			if config.GetConfig(name) != "" {
+				return config.GetConfigInt(name)
+			}
+		}
+		return def
+	}
+	getBool := func(key string, def bool) bool {
+		for _, name := range []string{"probe." + exchange + "." + key, "probe.defaults." + key} {
+			if config.GetConfig(name) != "" {
+				return config.GetConfigBool(name)
+			}
+		}
+		return def
+	}
+	getMs := func(key string, def time.Duration) time.Duration {
+		return time.Duration(getInt(key, int(def/time.Millisecond))) * time.Millisecond
+	}
+
+	s.ServerTimeSamples = getInt("server_time_samples", s.ServerTimeSamples)
+	s.HttpSamples = getInt("http_samples", s.HttpSamples)
+	s.HttpDuration = getMs("http_duration_ms", s.HttpDuration)
+	s.HttpInterval = getMs("http_interval_ms", s.HttpInterval)
+	s.HttpWarmup = getMs("http_warmup_ms", s.HttpWarmup)
+	s.HttpTimeoutMs = getInt("http_timeout_ms", s.HttpTimeoutMs)
+	s.WsMessages = getInt("ws_messages", s.WsMessages)
+	s.WsDuration = getMs("ws_duration_ms", s.WsDuration)
+	s.WsWarmup = getMs("ws_warmup_ms", s.WsWarmup)
+	s.WsTimeoutMs = getInt("ws_timeout_ms", s.WsTimeoutMs)
+	s.RpcSamples = getInt("rpc_samples", s.RpcSamples)
+	s.RpcTimeoutMs = getInt("rpc_timeout_ms", s.RpcTimeoutMs)
+	s.RefreshInterval = getMs("refresh_interval_ms", s.RefreshInterval)
+	s.BackendFanout = getBool("backend_fanout", s.BackendFanout)
+	s.Filter = loadLatencyFilter()
+
+	//两个停止条件均未设置时采集会无限进行, 回退到默认样本数
+	defaults := defaultProbeSettings()
+	if s.HttpSamples <= 0 && s.HttpDuration <= 0 {
+		log.Warnf("%s HTTP样本数及采集时长均未设置, 使用默认样本数%d", exchange, defaults.HttpSamples)
+		s.HttpSamples = defaults.HttpSamples
+	}
+	if s.WsMessages <= 0 && s.WsDuration <= 0 {
+		log.Warnf("%s WS行情数及采集时长均未设置, 使用默认行情数%d", exchange, defaults.WsMessages)
+		s.WsMessages = defaults.WsMessages
+	}
+	if s.RefreshInterval <= 0 {
+		s.RefreshInterval = defaults.RefreshInterval
+	}
+	return s
+}
+
+// 样本采集停止条件
+type sampleStop struct {
+	count    int
+	deadline time.Time
+}
+
+func newSampleStop(count int, duration time.Duration) sampleStop {
+	stop := sampleStop{count: count}
+	if duration > 0 {
+		stop.deadline = time.Now().Add(duration)
+	}
+	return stop
+}
+
+// 已采集n个样本后是否停止
+func (s sampleStop) Done(n int64) bool {
+	if s.count > 0 && n >= int64(s.count) {
+		return true
+	}
+	return !s.deadline.IsZero() && !time.Now().Before(s.deadline)
+}
+
+// 采集时长到期通道, 未设置时长时返回nil(永不触发)
+func (s sampleStop) Expired() <-chan time.Time {
+	if s.deadline.IsZero() {
+		return nil
+	}
+	return time.After(time.Until(s.deadline))
+}
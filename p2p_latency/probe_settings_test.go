@@ -0,0 +1,96 @@
+package p2p_latency
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+// 本地测试不需要等待
+func testProbeSettings() ProbeSettings {
+	settings := defaultProbeSettings()
+	settings.HttpWarmup = 0
+	settings.WsWarmup = 0
+	return settings
+}
+
+// 测试交易所配置 > probe.defaults > 默认值的回退顺序
+func TestLoadProbeSettings(t *testing.T) {
+	values := map[string]interface{}{
+		"probe.defaults.http_samples":     20,
+		"probe.defaults.http_interval_ms": 100,
+		"probe.okx.http_samples":          10,
+		"probe.okx.ws_messages":           0,
+		"probe.okx.ws_duration_ms":        30000,
+		"probe.bybit.ws_messages":         0,
+	}
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	defer func() {
+		for key := range values {
+			viper.Set(key, nil)
+		}
+	}()
+
+	okx := loadProbeSettings("okx")
+	if okx.HttpSamples != 10 || okx.HttpInterval != 100*time.Millisecond {
+		t.Errorf("Unexpected okx http settings %+v", okx)
+	}
+	if okx.WsMessages != 0 || okx.WsDuration != 30*time.Second {
+		t.Errorf("Expected duration-based okx ws stop, got %+v", okx)
+	}
+	if okx.HttpTimeoutMs != 3000 || okx.RefreshInterval != time.Minute {
+		t.Errorf("Expected built-in defaults, got %+v", okx)
+	}
+
+	binance := loadProbeSettings("binance")
+	if binance.HttpSamples != 20 || binance.WsMessages != 500 {
+		t.Errorf("Unexpected binance settings %+v", binance)
+	}
+
+	//样本数及时长均为0时回退到默认样本数
+	bybit := loadProbeSettings("bybit")
+	if bybit.WsMessages != 500 {
+		t.Errorf("Expected fallback to default ws messages, got %d", bybit.WsMessages)
+	}
+}
+
+// 测试按采集时长停止WS测试
+func TestRunWsProbeDuration(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for seq := 1; seq <= 100; seq++ {
+			msg := `{"ts":` + strconv.FormatInt(time.Now().UnixNano(), 10) + `,"seq":` + strconv.Itoa(seq) + `}`
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		conn.ReadMessage()
+	})
+	defer closeServer()
+
+	settings := testProbeSettings()
+	settings.WsMessages = 0
+	settings.WsDuration = 500 * time.Millisecond
+	start := time.Now()
+	result := runWsProbe(localTestProbe{wsUrl: url}, nil, settings)["public"]
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("Expected stop after ~500ms, took %v", elapsed)
+	}
+	if result.SuccessCount < 5 || result.SuccessCount > 40 {
+		t.Errorf("Unexpected tick count %d for 500ms at 20ms pacing", result.SuccessCount)
+	}
+}
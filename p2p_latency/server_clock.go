@@ -0,0 +1,114 @@
+package p2p_latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 服务器时间未声明精度时按毫秒处理
+const defaultServerTimeResolution = time.Millisecond
+
+// 服务器时间差估计, 以本地时间 - 服务器时间计
+type ServerClockOffset struct {
+	OffsetNs      int64   //时间差估计值
+	UncertaintyNs int64   //误差范围 ±(往返耗时/2 + 服务器时间精度)
+	RttNs         int64   //参与估计样本中最大的往返耗时(已扣除服务端处理耗时)
+	ResolutionNs  int64   //服务器时间精度
+	SampleCount   int64   //有效样本数
+	UsedCount     int64   //参与估计的最小往返耗时样本数
+	DriftPpm      float64 //与上次估计相比的时间差漂移速率(百万分之一), 首次估计为0
+}
+
+// 一次服务器时间请求, 单时间戳接口的服务端收发时间相同
+type serverClockSample struct {
+	sendNs       int64 //本地发出请求
+	recvNs       int64 //本地收到应答
+	serverRecvNs int64 //服务端收到请求
+	serverSendNs int64 //服务端发出应答
+}
+
+// 往返耗时, 扣除服务端处理时间
+func (s serverClockSample) rtt() int64 {
+	return (s.recvNs - s.sendNs) - (s.serverSendNs - s.serverRecvNs)
+}
+
+// NTP时间差公式 ((t1-t2)+(t4-t3))/2
+func (s serverClockSample) offset() int64 {
+	return ((s.sendNs - s.serverRecvNs) + (s.recvNs - s.serverSendNs)) / 2
+}
+
+// NTP风格服务器时间差估计: 只保留往返耗时最小的样本, 慢样本不会拉偏结果
+// 非并发安全
+type serverClockEstimator struct {
+	resolutionNs int64
+	samples      []serverClockSample
+}
+
+func newServerClockEstimator(resolution time.Duration) *serverClockEstimator {
+	if resolution <= 0 {
+		resolution = defaultServerTimeResolution
+	}
+	return &serverClockEstimator{resolutionNs: int64(resolution)}
+}
+
+// 记录单时间戳样本
+func (e *serverClockEstimator) Add(sendNs, recvNs, serverNs int64) {
+	e.AddNtp(sendNs, recvNs, serverNs, serverNs)
+}
+
+// 记录带服务端收发时间的样本
+func (e *serverClockEstimator) AddNtp(sendNs, recvNs, serverRecvNs, serverSendNs int64) {
+	s := serverClockSample{sendNs: sendNs, recvNs: recvNs, serverRecvNs: serverRecvNs, serverSendNs: serverSendNs}
+	if s.rtt() < 0 {
+		return
+	}
+	e.samples = append(e.samples, s)
+}
+
+func (e *serverClockEstimator) Count() int {
+	return len(e.samples)
+}
+
+// 取往返耗时最小的1/4样本(至少1个)的时间差均值, 误差按其中最大往返耗时计
+func (e *serverClockEstimator) Estimate() ServerClockOffset {
+	result := ServerClockOffset{ResolutionNs: e.resolutionNs, SampleCount: int64(len(e.samples))}
+	if len(e.samples) == 0 {
+		return result
+	}
+	sorted := append([]serverClockSample(nil), e.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].rtt() < sorted[j].rtt() })
+	used := (len(sorted) + 3) / 4
+	offsetSum := int64(0)
+	for _, s := range sorted[:used] {
+		offsetSum += s.offset()
+	}
+	result.OffsetNs = offsetSum / int64(used)
+	result.RttNs = sorted[used-1].rtt()
+	result.UsedCount = int64(used)
+	result.UncertaintyNs = result.RttNs/2 + e.resolutionNs
+	return result
+}
+
+type serverClockHistoryEntry struct {
+	offsetNs int64
+	timeNs   int64
+}
+
+var (
+	serverClockHistoryMu sync.Mutex
+	serverClockHistory   = map[string]serverClockHistoryEntry{}
+)
+
+// 按端点记录本次估计并计算与上次估计之间的漂移速率
+func trackServerClockDrift(key string, offset *ServerClockOffset, nowNs int64) {
+	if offset.SampleCount == 0 {
+		return
+	}
+	serverClockHistoryMu.Lock()
+	defer serverClockHistoryMu.Unlock()
+	if last, ok := serverClockHistory[key]; ok && nowNs > last.timeNs {
+		offset.DriftPpm = float64(offset.OffsetNs-last.offsetNs) / float64(nowNs-last.timeNs) * 1e6
+	}
+	serverClockHistory[key] = serverClockHistoryEntry{offsetNs: offset.OffsetNs, timeNs: nowNs}
+}
@@ -0,0 +1,82 @@
+package p2p_latency
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试慢样本被剔除, 误差按最小往返耗时及精度计算
+func TestServerClockEstimator(t *testing.T) {
+	ms := int64(time.Millisecond)
+	const offset = 300 * int64(time.Millisecond)
+	e := newServerClockEstimator(time.Millisecond)
+	//本地时间比服务器快300ms; 前三次往返2ms且对称, 第四次应答方向慢50ms
+	for i, rtt := range []int64{2 * ms, 2 * ms, 2 * ms} {
+		send := int64(i) * 1000 * ms
+		e.Add(send, send+rtt, send+rtt/2-offset)
+	}
+	send := 5000 * ms
+	e.Add(send, send+52*ms, send+ms-offset)
+	//往返为负的异常样本丢弃
+	e.Add(send, send-ms, send)
+
+	result := e.Estimate()
+	if result.SampleCount != 4 || result.UsedCount != 1 {
+		t.Errorf("Expected 4 samples with 1 used, got %+v", result)
+	}
+	if result.OffsetNs != offset {
+		t.Errorf("Expected offset %d, got %d", offset, result.OffsetNs)
+	}
+	if result.RttNs != 2*ms || result.UncertaintyNs != ms+ms {
+		t.Errorf("Expected rtt 2ms and uncertainty ±2ms, got %+v", result)
+	}
+
+	//平均法会被慢样本拉偏约6ms
+	sum := int64(0)
+	for _, s := range e.samples {
+		sum += (s.sendNs+s.recvNs)/2 - s.serverRecvNs
+	}
+	if avg := sum / int64(len(e.samples)); avg-offset < 5*ms {
+		t.Errorf("Expected naive average to be skewed, got %d", avg-offset)
+	}
+}
+
+// 测试服务端收发时间(如Deribit usIn/usOut)扣除处理耗时
+func TestServerClockEstimatorNtp(t *testing.T) {
+	us := int64(time.Microsecond)
+	e := newServerClockEstimator(time.Microsecond)
+	//本地慢1ms: 发出0, 服务端+1000us收到(服务器时间), 处理500us, 本地2500us收到
+	e.AddNtp(0, 2500*us, 1000*us+1000*us, 1500*us+1000*us)
+	result := e.Estimate()
+	if result.RttNs != 2000*us {
+		t.Errorf("Expected rtt 2000us excluding server processing, got %d", result.RttNs)
+	}
+	if result.OffsetNs != -1000*us {
+		t.Errorf("Expected offset -1000us, got %d", result.OffsetNs)
+	}
+	if result.UncertaintyNs != 1001*us {
+		t.Errorf("Expected uncertainty 1001us, got %d", result.UncertaintyNs)
+	}
+}
+
+// 测试按端点跟踪时间差漂移
+func TestTrackServerClockDrift(t *testing.T) {
+	key := "test drift"
+	first := ServerClockOffset{OffsetNs: 1000000, SampleCount: 1}
+	trackServerClockDrift(key, &first, 0)
+	if first.DriftPpm != 0 {
+		t.Errorf("Expected no drift on first estimate, got %f", first.DriftPpm)
+	}
+	//60秒漂移6ms = 100ppm
+	second := ServerClockOffset{OffsetNs: 7000000, SampleCount: 1}
+	trackServerClockDrift(key, &second, int64(time.Minute))
+	if second.DriftPpm < 99.99 || second.DriftPpm > 100.01 {
+		t.Errorf("Expected 100ppm drift, got %f", second.DriftPpm)
+	}
+	//无有效样本时不更新
+	empty := ServerClockOffset{}
+	trackServerClockDrift(key, &empty, int64(2*time.Minute))
+	if empty.DriftPpm != 0 || serverClockHistory[key].offsetNs != 7000000 {
+		t.Errorf("Expected empty estimate to be ignored")
+	}
+}
@@ -0,0 +1,330 @@
+package p2p_latency
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/config"
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/Hongssd/cgolatencytest/latency_stats"
+	"github.com/google/uuid"
+)
+
+// WS下单延迟测试配置
+type WsOrderProbeConfig struct {
+	Url         string
+	ApiKey      string
+	SecretKey   string
+	Passphrase  string //OKX专用
+	Symbol      string //币安symbol / OKX instId
+	Side        string
+	Price       string
+	Quantity    string
+	TdMode      string //OKX专用
+	ExpOffsetMs int64  //OKX expTime相对发送时刻的偏移, 须为负数, 保证本地时钟偏快时到达交易所也已过期, 不会真实下单
+	Count       int
+	TimeoutMs   int
+}
+
+// WS下单延迟结果, 交易所时间相关字段包含本地与交易所的时钟偏差
+type WsOrderLatencyResult struct {
+	ConnectLatencyNs  int64                 //建立连接耗时
+	LoginLatencyNs    int64                 //登录往返耗时
+	AckRttNs          int64                 //下单请求到应答过滤后平均往返耗时
+	ExchangeInNs      int64                 //发出请求到交易所接收(inTime)平均耗时
+	ExchangeProcessNs int64                 //交易所内部处理(outTime-inTime)平均耗时
+	ExchangeOutNs     int64                 //交易所发出(outTime)到本地收到平均耗时
+	SuccessCount      int64                 //收到应答次数
+	AckRtt            latency_stats.Summary //过滤前后下单往返耗时分布
+}
+
+// OKX expTime默认取发送前10秒, 远大于单程延迟及正常的时钟偏差
+const defaultOkxExpOffsetMs = -10000
+
+// 从配置读取WS下单测试参数, 如 ws_order.binance.api_key
+func loadWsOrderProbeConfig(exchange string, defaultUrl string) WsOrderProbeConfig {
+	prefix := "ws_order." + exchange + "."
+	cfg := WsOrderProbeConfig{
+		Url:        config.GetConfig(prefix + "url"),
+		ApiKey:     config.GetConfig(prefix + "api_key"),
+		SecretKey:  config.GetConfig(prefix + "secret_key"),
+		Passphrase: config.GetConfig(prefix + "passphrase"),
+		Symbol:     config.GetConfig(prefix + "symbol"),
+		Side:       config.GetConfig(prefix + "side"),
+		Price:      config.GetConfig(prefix + "price"),
+		Quantity:   config.GetConfig(prefix + "quantity"),
+		TdMode:     config.GetConfig(prefix + "td_mode"),
+		Count:      config.GetConfigInt(prefix + "count"),
+	}
+	cfg.ExpOffsetMs = defaultOkxExpOffsetMs
+	if config.GetConfig(prefix+"exp_offset_ms") != "" {
+		cfg.ExpOffsetMs = int64(config.GetConfigInt(prefix + "exp_offset_ms"))
+		if cfg.ExpOffsetMs >= 0 {
+			log.Warnf("[%s] exp_offset_ms须为负数, 否则可能真实下单, 使用默认值%d", exchange, defaultOkxExpOffsetMs)
+			cfg.ExpOffsetMs = defaultOkxExpOffsetMs
+		}
+	}
+	if cfg.Url == "" {
+		cfg.Url = defaultUrl
+	}
+	if cfg.Count <= 0 {
+		cfg.Count = 10
+	}
+	cfg.TimeoutMs = loadProbeSettings(exchange).WsTimeoutMs
+	if config.GetConfig(prefix+"timeout_ms") != "" {
+		cfg.TimeoutMs = config.GetConfigInt(prefix + "timeout_ms")
+	}
+	return cfg
+}
+
+// 币安ws-api签名: 参数按key排序拼接后HMAC-SHA256
+func signBinanceWsParams(params map[string]interface{}, secretKey string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+url.QueryEscape(fmt.Sprint(params[k])))
+	}
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(strings.Join(pairs, "&")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// OKX登录签名: base64(HMAC-SHA256(timestamp + "GET" + "/users/self/verify"))
+func signOkxWsLogin(timestamp string, secretKey string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(timestamp + "GET" + "/users/self/verify"))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// OKX登录应答不带id, 以"login"作为关联id
+func okxWsIdExtractor(msg string) (string, bool) {
+	if strings.Contains(msg, `"event":"login"`) || (strings.Contains(msg, `"event":"error"`) && !strings.Contains(msg, `"id"`)) {
+		return "login", true
+	}
+	return http_client.DefaultWebSocketIdExtractor(msg)
+}
+
+// 测试币安WebSocket API下单(order.test)延迟, 不会真实下单
+func TestBinanceWsOrderLatency(cfg WsOrderProbeConfig) (*WsOrderLatencyResult, error) {
+	client, err := http_client.NewWebSocketClientLibcurl()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	res := client.Connect(cfg.Url, cfg.TimeoutMs)
+	if res.Error != "" {
+		observeProbeFailure("binance", transportWsOrder, transportWsOrder, classifyProbeError(res.Error))
+		return nil, fmt.Errorf("[BN WS API] 连接失败: %s", res.Error)
+	}
+	result := &WsOrderLatencyResult{ConnectLatencyNs: res.LatencyNs}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requester := client.NewRequester(ctx, http_client.WebSocketRequesterOptions{})
+
+	sampler := latency_stats.NewSampler()
+	for i := 0; i < cfg.Count; i++ {
+		params := map[string]interface{}{
+			"symbol":      cfg.Symbol,
+			"side":        cfg.Side,
+			"type":        "LIMIT",
+			"timeInForce": "GTC",
+			"price":       cfg.Price,
+			"quantity":    cfg.Quantity,
+			"apiKey":      cfg.ApiKey,
+			"timestamp":   time.Now().UnixMilli(),
+		}
+		params["signature"] = signBinanceWsParams(params, cfg.SecretKey)
+		id := uuid.New().String()
+		request, err := json.Marshal(map[string]interface{}{
+			"id":     id,
+			"method": "order.test",
+			"params": params,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		callCtx, callCancel := context.WithTimeout(ctx, time.Duration(cfg.TimeoutMs)*time.Millisecond)
+		reply, err := requester.Call(callCtx, id, string(request))
+		callCancel()
+		if err != nil {
+			observeProbeFailure("binance", transportWsOrder, transportWsOrder, classifyCallError(err))
+			log.Errorf("[BN WS API] order.test请求失败: %v", err)
+			continue
+		}
+
+		var ack struct {
+			Status int `json:"status"`
+			Error  struct {
+				Code int    `json:"code"`
+				Msg  string `json:"msg"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(reply.Data), &ack); err == nil && ack.Status != 200 {
+			//签名或参数错误同样能测得往返耗时, 记录原因便于排查
+			log.Warnf("[BN WS API] order.test应答异常: %d %s", ack.Error.Code, ack.Error.Msg)
+		}
+		sampler.Record(reply.RttNs)
+		observeProbeSample("binance", transportWsOrder, transportWsOrder, reply.RttNs)
+		result.SuccessCount++
+	}
+	result.AckRtt = sampler.Summarize(loadLatencyFilter())
+	result.AckRttNs = result.AckRtt.Stats.MeanNs
+	log.Debugf("[BN WS API] 连接 %.6f ms, 下单应答往返 %.6f ms, 成功 %d 次",
+		float64(result.ConnectLatencyNs)/1000000, float64(result.AckRttNs)/1000000, result.SuccessCount)
+	return result, nil
+}
+
+// 测试OKX私有WebSocket登录及下单延迟, 下单携带已过期的expTime, 不会真实下单
+func TestOkxWsOrderLatency(cfg WsOrderProbeConfig) (*WsOrderLatencyResult, error) {
+	client, err := http_client.NewWebSocketClientLibcurl()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	res := client.Connect(cfg.Url, cfg.TimeoutMs)
+	if res.Error != "" {
+		observeProbeFailure("okx", transportWsOrder, transportWsOrder, classifyProbeError(res.Error))
+		return nil, fmt.Errorf("[OKX WS PRIVATE] 连接失败: %s", res.Error)
+	}
+	result := &WsOrderLatencyResult{ConnectLatencyNs: res.LatencyNs}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requester := client.NewRequester(ctx, http_client.WebSocketRequesterOptions{IdExtractor: okxWsIdExtractor})
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+
+	//登录
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	loginMsg, err := json.Marshal(map[string]interface{}{
+		"op": "login",
+		"args": []map[string]string{{
+			"apiKey":     cfg.ApiKey,
+			"passphrase": cfg.Passphrase,
+			"timestamp":  timestamp,
+			"sign":       signOkxWsLogin(timestamp, cfg.SecretKey),
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	loginCtx, loginCancel := context.WithTimeout(ctx, timeout)
+	loginReply, err := requester.Call(loginCtx, "login", string(loginMsg))
+	loginCancel()
+	if err != nil {
+		observeProbeFailure("okx", transportWsOrder, transportWsOrder, classifyCallError(err))
+		return nil, fmt.Errorf("[OKX WS PRIVATE] 登录失败: %v", err)
+	}
+	var loginAck struct {
+		Event string `json:"event"`
+		Code  string `json:"code"`
+		Msg   string `json:"msg"`
+	}
+	if err := json.Unmarshal([]byte(loginReply.Data), &loginAck); err != nil || loginAck.Code != "0" {
+		observeProbeFailure("okx", transportWsOrder, transportWsOrder, errorClassAuth)
+		return nil, fmt.Errorf("[OKX WS PRIVATE] 登录被拒绝: %s %s", loginAck.Code, loginAck.Msg)
+	}
+	result.LoginLatencyNs = loginReply.RttNs
+
+	//非负偏移在本地时钟偏快时可能真实下单, 一律按默认值
+	expOffsetMs := cfg.ExpOffsetMs
+	if expOffsetMs >= 0 {
+		expOffsetMs = defaultOkxExpOffsetMs
+	}
+	sumIn, sumProcess, sumOut, exchangeTimeCount := int64(0), int64(0), int64(0), int64(0)
+	sampler := latency_stats.NewSampler()
+	for i := 0; i < cfg.Count; i++ {
+		id := strconv.FormatInt(requester.NextId(), 10)
+		request, err := json.Marshal(map[string]interface{}{
+			"id":      id,
+			"op":      "order",
+			"expTime": strconv.FormatInt(time.Now().UnixMilli()+expOffsetMs, 10),
+			"args": []map[string]string{{
+				"instId":  cfg.Symbol,
+				"tdMode":  cfg.TdMode,
+				"side":    cfg.Side,
+				"ordType": "limit",
+				"px":      cfg.Price,
+				"sz":      cfg.Quantity,
+			}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		callCtx, callCancel := context.WithTimeout(ctx, timeout)
+		reply, err := requester.Call(callCtx, id, string(request))
+		callCancel()
+		if err != nil {
+			observeProbeFailure("okx", transportWsOrder, transportWsOrder, classifyCallError(err))
+			log.Errorf("[OKX WS PRIVATE] 下单请求失败: %v", err)
+			continue
+		}
+		sampler.Record(reply.RttNs)
+		observeProbeSample("okx", transportWsOrder, transportWsOrder, reply.RttNs)
+		result.SuccessCount++
+
+		var ack struct {
+			Code    string `json:"code"`
+			Msg     string `json:"msg"`
+			InTime  string `json:"inTime"`
+			OutTime string `json:"outTime"`
+		}
+		if err := json.Unmarshal([]byte(reply.Data), &ack); err != nil {
+			continue
+		}
+		//inTime/outTime为微秒时间戳
+		inTimeUs, errIn := strconv.ParseInt(ack.InTime, 10, 64)
+		outTimeUs, errOut := strconv.ParseInt(ack.OutTime, 10, 64)
+		if errIn != nil || errOut != nil {
+			continue
+		}
+		sumIn += inTimeUs*1000 - reply.SendTimeNs
+		sumProcess += (outTimeUs - inTimeUs) * 1000
+		sumOut += reply.RecvTimeNs - outTimeUs*1000
+		exchangeTimeCount++
+	}
+	result.AckRtt = sampler.Summarize(loadLatencyFilter())
+	result.AckRttNs = result.AckRtt.Stats.MeanNs
+	if exchangeTimeCount > 0 {
+		result.ExchangeInNs = sumIn / exchangeTimeCount
+		result.ExchangeProcessNs = sumProcess / exchangeTimeCount
+		result.ExchangeOutNs = sumOut / exchangeTimeCount
+	}
+	log.Debugf("[OKX WS PRIVATE] 连接 %.6f ms, 登录 %.6f ms, 下单应答往返 %.6f ms, 交易所处理 %.6f ms, 成功 %d 次",
+		float64(result.ConnectLatencyNs)/1000000, float64(result.LoginLatencyNs)/1000000,
+		float64(result.AckRttNs)/1000000, float64(result.ExchangeProcessNs)/1000000, result.SuccessCount)
+	return result, nil
+}
+
+// 按配置执行WS下单延迟测试, 未配置api_key时跳过并返回空结果
+func runWsOrderProbe(exchange string, defaultUrl string,
+	probe func(WsOrderProbeConfig) (*WsOrderLatencyResult, error)) WsOrderLatencyResult {
+	cfg := loadWsOrderProbeConfig(exchange, defaultUrl)
+	if cfg.ApiKey == "" || cfg.SecretKey == "" {
+		log.Debugf("[%s] 未配置ws_order密钥, 跳过WS下单延迟测试", exchange)
+		return WsOrderLatencyResult{}
+	}
+	result, err := probe(cfg)
+	if err != nil {
+		log.Error(err)
+		return WsOrderLatencyResult{}
+	}
+	return *result
+}
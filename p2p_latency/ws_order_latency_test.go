@@ -0,0 +1,227 @@
+package p2p_latency
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+// 本地WebSocket模拟交易所, 返回ws://地址及关闭函数
+func newLocalExchangeServer(t *testing.T, handler func(conn *websocket.Conn)) (string, func()) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}))
+	return "ws" + strings.TrimPrefix(server.URL, "http"), server.Close
+}
+
+// 读取一条JSON请求, 数字保留原文以便校验签名
+func readJSONRequest(conn *websocket.Conn) (map[string]interface{}, error) {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var req map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// 测试币安ws-api order.test签名及往返耗时
+func TestBinanceWsOrderProbe(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		for {
+			req, err := readJSONRequest(conn)
+			if err != nil {
+				return
+			}
+			params, _ := req["params"].(map[string]interface{})
+			signature, _ := params["signature"].(string)
+			delete(params, "signature")
+			if req["method"] != "order.test" || params["apiKey"] != "test-key" || signature != signBinanceWsParams(params, "test-secret") {
+				conn.WriteJSON(map[string]interface{}{"id": req["id"], "status": 400,
+					"error": map[string]interface{}{"code": -1022, "msg": "Signature for this request is not valid."}})
+				continue
+			}
+			time.Sleep(10 * time.Millisecond)
+			conn.WriteJSON(map[string]interface{}{"id": req["id"], "status": 200, "result": map[string]interface{}{}})
+		}
+	})
+	defer closeServer()
+
+	result, err := TestBinanceWsOrderLatency(WsOrderProbeConfig{
+		Url:       url,
+		ApiKey:    "test-key",
+		SecretKey: "test-secret",
+		Symbol:    "BTCUSDT",
+		Side:      "BUY",
+		Price:     "10000",
+		Quantity:  "0.001",
+		Count:     3,
+		TimeoutMs: 2000,
+	})
+	if err != nil {
+		t.Fatalf("TestBinanceWsOrderLatency failed: %v", err)
+	}
+	if result.SuccessCount != 3 {
+		t.Errorf("Expected 3 acks, got %d", result.SuccessCount)
+	}
+	if result.AckRttNs < int64(10*time.Millisecond) || result.AckRttNs > int64(time.Second) {
+		t.Errorf("Unexpected ack RTT %d ns", result.AckRttNs)
+	}
+	if result.ConnectLatencyNs <= 0 {
+		t.Errorf("Expected connect latency, got %d", result.ConnectLatencyNs)
+	}
+	if result.AckRtt.Stats.Count != 3 || result.AckRtt.Stats.MinNs < int64(10*time.Millisecond) {
+		t.Errorf("Unexpected ack RTT distribution %+v", result.AckRtt)
+	}
+}
+
+// 测试OKX私有WS登录、下单应答及inTime/outTime拆分
+func TestOkxWsOrderProbe(t *testing.T) {
+	if err := http_client.InitWebSocketLibcurl(); err != nil {
+		t.Fatalf("InitLibcurl failed: %v", err)
+	}
+	defer http_client.CleanupWebSocketLibcurl()
+
+	url, closeServer := newLocalExchangeServer(t, func(conn *websocket.Conn) {
+		loggedIn := false
+		for {
+			req, err := readJSONRequest(conn)
+			if err != nil {
+				return
+			}
+			switch req["op"] {
+			case "login":
+				args, _ := req["args"].([]interface{})
+				arg, _ := args[0].(map[string]interface{})
+				timestamp, _ := arg["timestamp"].(string)
+				if arg["apiKey"] != "test-key" || arg["passphrase"] != "test-pass" || arg["sign"] != signOkxWsLogin(timestamp, "test-secret") {
+					conn.WriteJSON(map[string]string{"event": "error", "code": "60009", "msg": "Login failed."})
+					continue
+				}
+				loggedIn = true
+				conn.WriteJSON(map[string]string{"event": "login", "code": "0", "msg": "", "connId": "test"})
+			case "order":
+				if !loggedIn {
+					return
+				}
+				expTime, _ := req["expTime"].(string)
+				expTimeMs, err := strconv.ParseInt(expTime, 10, 64)
+				if err != nil {
+					conn.WriteJSON(map[string]interface{}{"id": req["id"], "op": "order", "code": "50014", "msg": "expTime missing"})
+					continue
+				}
+				//未配置偏移时expTime应明显早于当前时间
+				if expTimeMs > time.Now().UnixMilli()-5000 {
+					t.Errorf("expTime %d not clearly in the past", expTimeMs)
+				}
+				inTime := time.Now().UnixMicro()
+				time.Sleep(5 * time.Millisecond)
+				outTime := time.Now().UnixMicro()
+				conn.WriteJSON(map[string]interface{}{
+					"id":      req["id"],
+					"op":      "order",
+					"code":    "1",
+					"msg":     "",
+					"data":    []map[string]string{{"sCode": "50102", "sMsg": "Timestamp request expired"}},
+					"inTime":  strconv.FormatInt(inTime, 10),
+					"outTime": strconv.FormatInt(outTime, 10),
+				})
+			}
+		}
+	})
+	defer closeServer()
+
+	cfg := WsOrderProbeConfig{
+		Url:        url,
+		ApiKey:     "test-key",
+		SecretKey:  "test-secret",
+		Passphrase: "test-pass",
+		Symbol:     "BTC-USDT",
+		Side:       "buy",
+		TdMode:     "cash",
+		Price:      "10000",
+		Quantity:   "0.001",
+		Count:      3,
+		TimeoutMs:  2000,
+	}
+	result, err := TestOkxWsOrderLatency(cfg)
+	if err != nil {
+		t.Fatalf("TestOkxWsOrderLatency failed: %v", err)
+	}
+	if result.SuccessCount != 3 {
+		t.Errorf("Expected 3 acks, got %d", result.SuccessCount)
+	}
+	if result.LoginLatencyNs <= 0 {
+		t.Errorf("Expected login latency, got %d", result.LoginLatencyNs)
+	}
+	if result.ExchangeProcessNs < int64(5*time.Millisecond) || result.ExchangeProcessNs > result.AckRttNs {
+		t.Errorf("Unexpected exchange process time %d ns (rtt %d ns)", result.ExchangeProcessNs, result.AckRttNs)
+	}
+	//本地模拟无时钟偏差, 三段之和应与往返耗时一致(微秒精度)
+	sum := result.ExchangeInNs + result.ExchangeProcessNs + result.ExchangeOutNs
+	if diff := sum - result.AckRttNs; diff < -int64(time.Millisecond) || diff > int64(time.Millisecond) {
+		t.Errorf("Exchange in/process/out sum %d ns differs from rtt %d ns", sum, result.AckRttNs)
+	}
+
+	cfg.Passphrase = "wrong"
+	if _, err := TestOkxWsOrderLatency(cfg); err == nil {
+		t.Error("Expected login rejection with wrong passphrase")
+	}
+}
+
+// 测试exp_offset_ms非负时回退到默认的过去时刻
+func TestLoadWsOrderProbeConfigExpOffset(t *testing.T) {
+	defer viper.Set("ws_order.okx.exp_offset_ms", nil)
+	if cfg := loadWsOrderProbeConfig("okx", "wss://example"); cfg.ExpOffsetMs != defaultOkxExpOffsetMs {
+		t.Errorf("Expected default offset %d, got %d", defaultOkxExpOffsetMs, cfg.ExpOffsetMs)
+	}
+	viper.Set("ws_order.okx.exp_offset_ms", 0)
+	if cfg := loadWsOrderProbeConfig("okx", "wss://example"); cfg.ExpOffsetMs != defaultOkxExpOffsetMs {
+		t.Errorf("Expected non-negative offset rejected, got %d", cfg.ExpOffsetMs)
+	}
+	viper.Set("ws_order.okx.exp_offset_ms", -30000)
+	if cfg := loadWsOrderProbeConfig("okx", "wss://example"); cfg.ExpOffsetMs != -30000 {
+		t.Errorf("Expected configured offset -30000, got %d", cfg.ExpOffsetMs)
+	}
+}
+
+// 测试超时优先取ws_order配置, 未配置时回退到探测配置的WS超时
+func TestLoadWsOrderProbeConfigTimeout(t *testing.T) {
+	defer viper.Set("probe.binance.ws_timeout_ms", nil)
+	defer viper.Set("ws_order.binance.timeout_ms", nil)
+	if cfg := loadWsOrderProbeConfig("binance", "wss://example"); cfg.TimeoutMs != defaultProbeSettings().WsTimeoutMs {
+		t.Errorf("Expected default ws timeout, got %d", cfg.TimeoutMs)
+	}
+	viper.Set("probe.binance.ws_timeout_ms", 8000)
+	if cfg := loadWsOrderProbeConfig("binance", "wss://example"); cfg.TimeoutMs != 8000 {
+		t.Errorf("Expected probe ws timeout 8000, got %d", cfg.TimeoutMs)
+	}
+	viper.Set("ws_order.binance.timeout_ms", 1500)
+	if cfg := loadWsOrderProbeConfig("binance", "wss://example"); cfg.TimeoutMs != 1500 {
+		t.Errorf("Expected ws_order timeout 1500, got %d", cfg.TimeoutMs)
+	}
+}
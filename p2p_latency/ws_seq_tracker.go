@@ -0,0 +1,152 @@
+package p2p_latency
+
+import (
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/config"
+)
+
+// 默认断流判定间隔
+const defaultWsStallGapMs = 2000
+
+// WS行情连续性统计, 与延迟一同上报
+type WsSeqResult struct {
+	MessageCount    int64 //参与连续性检查的消息数
+	GapCount        int64 //序号不连续次数
+	MissedUpdates   int64 //可确定的丢失更新数(币安现货U/u连续编号)
+	OutOfOrderCount int64 //乱序或重复消息数
+	ResetCount      int64 //交易所主动重置序号次数(OKX prevSeqId=-1或seqId回退)
+	StallCount      int64 //超过断流间隔未收到消息的次数
+	MaxStallNs      int64 //最长消息间隔
+}
+
+// 相对更早累计值的增量, MaxStallNs无法相减, 由调用方另行统计
+func (r WsSeqResult) sub(base WsSeqResult) WsSeqResult {
+	return WsSeqResult{
+		MessageCount:    r.MessageCount - base.MessageCount,
+		GapCount:        r.GapCount - base.GapCount,
+		MissedUpdates:   r.MissedUpdates - base.MissedUpdates,
+		OutOfOrderCount: r.OutOfOrderCount - base.OutOfOrderCount,
+		ResetCount:      r.ResetCount - base.ResetCount,
+		StallCount:      r.StallCount - base.StallCount,
+	}
+}
+
+type wsSeqState struct {
+	lastId     int64
+	lastRecvNs int64
+}
+
+// 按stream/instId跟踪行情序号, 仅在单个协程内使用
+type wsSeqTracker struct {
+	stallGapNs int64
+	states     map[string]*wsSeqState
+	result     WsSeqResult
+	maxStallNs int64 //自上次TakeMaxStall以来的最长消息间隔
+}
+
+// 断流间隔由配置 ws_stall_gap_ms 指定
+func newWsSeqTracker() *wsSeqTracker {
+	stallGapMs := config.GetConfigInt("ws_stall_gap_ms")
+	if stallGapMs <= 0 {
+		stallGapMs = defaultWsStallGapMs
+	}
+	return newWsSeqTrackerWithGap(time.Duration(stallGapMs) * time.Millisecond)
+}
+
+func newWsSeqTrackerWithGap(stallGap time.Duration) *wsSeqTracker {
+	return &wsSeqTracker{
+		stallGapNs: int64(stallGap),
+		states:     make(map[string]*wsSeqState),
+	}
+}
+
+// 自创建以来的累计结果
+func (t *wsSeqTracker) Result() WsSeqResult {
+	return t.result
+}
+
+// 返回并清零自上次调用以来的最长消息间隔, 供滚动窗口统计
+func (t *wsSeqTracker) TakeMaxStall() int64 {
+	maxStallNs := t.maxStallNs
+	t.maxStallNs = 0
+	return maxStallNs
+}
+
+// 返回key对应状态, 首条消息返回nil
+func (t *wsSeqTracker) observe(key string, recvNs int64) *wsSeqState {
+	t.result.MessageCount++
+	state, ok := t.states[key]
+	if !ok {
+		t.states[key] = &wsSeqState{lastRecvNs: recvNs}
+		return nil
+	}
+	if interval := recvNs - state.lastRecvNs; interval > 0 {
+		if interval > t.stallGapNs {
+			t.result.StallCount++
+		}
+		if interval > t.result.MaxStallNs {
+			t.result.MaxStallNs = interval
+		}
+		if interval > t.maxStallNs {
+			t.maxStallNs = interval
+		}
+	}
+	state.lastRecvNs = recvNs
+	return state
+}
+
+// 行情序号检查方式
+type WsSeqMode int
+
+const (
+	WsSeqNone       WsSeqMode = iota //无序号
+	WsSeqRange                       //连续编号区间, FirstId应等于上一条LastId+1(币安现货U/u)
+	WsSeqPrevLinked                  //携带上一条序号, PrevId应等于上一条LastId(币安合约pu, OKX prevSeqId)
+	WsSeqMonotonic                   //仅保证递增(OKX bbo-tbt seqId)
+)
+
+// 单条行情的序号信息
+type WsSeq struct {
+	Mode    WsSeqMode
+	FirstId int64
+	LastId  int64
+	PrevId  int64 //仅WsSeqPrevLinked使用, -1表示交易所重置序号
+}
+
+// 按stream分别检查序号连续性并统计断流
+func (t *wsSeqTracker) Observe(stream string, seq WsSeq, recvNs int64) {
+	state := t.observe(stream, recvNs)
+	if state == nil {
+		t.states[stream].lastId = seq.LastId
+		return
+	}
+	switch seq.Mode {
+	case WsSeqRange:
+		if seq.LastId <= state.lastId {
+			t.result.OutOfOrderCount++
+			return
+		}
+		if seq.FirstId > state.lastId+1 {
+			t.result.GapCount++
+			t.result.MissedUpdates += seq.FirstId - state.lastId - 1
+		}
+	case WsSeqPrevLinked:
+		//seqId==prevSeqId为无变化心跳, 按正常衔接处理
+		switch {
+		case seq.PrevId == -1 || seq.LastId < seq.PrevId:
+			t.result.ResetCount++
+		case seq.PrevId < state.lastId:
+			t.result.OutOfOrderCount++
+			return
+		case seq.PrevId != state.lastId:
+			t.result.GapCount++
+		}
+	case WsSeqMonotonic:
+		if seq.LastId <= state.lastId {
+			t.result.OutOfOrderCount++
+			return
+		}
+	}
+	state.lastId = seq.LastId
+}
@@ -0,0 +1,70 @@
+package p2p_latency
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试区间编号(币安现货U/u)及上一条序号(币安合约pu)的缺口、乱序与断流统计
+func TestWsSeqTrackerBinance(t *testing.T) {
+	tracker := newWsSeqTrackerWithGap(time.Second)
+	ms := int64(time.Millisecond)
+
+	//现货: 100-105, 106-110, 缺失111-114, 115-120, 重复106-110
+	tracker.Observe("btcusdt@depth@100ms", WsSeq{Mode: WsSeqRange, FirstId: 100, LastId: 105}, 0)
+	tracker.Observe("btcusdt@depth@100ms", WsSeq{Mode: WsSeqRange, FirstId: 106, LastId: 110}, 100*ms)
+	tracker.Observe("btcusdt@depth@100ms", WsSeq{Mode: WsSeqRange, FirstId: 115, LastId: 120}, 200*ms)
+	tracker.Observe("btcusdt@depth@100ms", WsSeq{Mode: WsSeqRange, FirstId: 106, LastId: 110}, 300*ms)
+	//合约: pu链在第三条断开, 之后1.5秒无消息
+	tracker.Observe("ethusdt@depth@0ms", WsSeq{Mode: WsSeqPrevLinked, FirstId: 1000, LastId: 1003, PrevId: 990}, 0)
+	tracker.Observe("ethusdt@depth@0ms", WsSeq{Mode: WsSeqPrevLinked, FirstId: 1010, LastId: 1012, PrevId: 1003}, 10*ms)
+	tracker.Observe("ethusdt@depth@0ms", WsSeq{Mode: WsSeqPrevLinked, FirstId: 1030, LastId: 1040, PrevId: 1020}, 1510*ms)
+
+	result := tracker.Result()
+	if result.MessageCount != 7 {
+		t.Errorf("Expected 7 messages, got %d", result.MessageCount)
+	}
+	if result.GapCount != 2 {
+		t.Errorf("Expected 2 gaps, got %d", result.GapCount)
+	}
+	if result.MissedUpdates != 4 {
+		t.Errorf("Expected 4 missed updates, got %d", result.MissedUpdates)
+	}
+	if result.OutOfOrderCount != 1 {
+		t.Errorf("Expected 1 out-of-order frame, got %d", result.OutOfOrderCount)
+	}
+	if result.StallCount != 1 || result.MaxStallNs != 1500*ms {
+		t.Errorf("Expected 1 stall of 1500ms, got %d / %d ns", result.StallCount, result.MaxStallNs)
+	}
+}
+
+// 测试prevSeqId衔接及仅递增序号(OKX)的缺口、乱序与重置
+func TestWsSeqTrackerOkx(t *testing.T) {
+	tracker := newWsSeqTrackerWithGap(time.Second)
+
+	//books: 带prevSeqId
+	tracker.Observe("BTC-USDT", WsSeq{Mode: WsSeqPrevLinked, FirstId: 10, LastId: 10, PrevId: 5}, 0)
+	tracker.Observe("BTC-USDT", WsSeq{Mode: WsSeqPrevLinked, FirstId: 12, LastId: 12, PrevId: 10}, 1)
+	tracker.Observe("BTC-USDT", WsSeq{Mode: WsSeqPrevLinked, FirstId: 12, LastId: 12, PrevId: 12}, 2) //无变化心跳
+	tracker.Observe("BTC-USDT", WsSeq{Mode: WsSeqPrevLinked, FirstId: 20, LastId: 20, PrevId: 15}, 3) //缺口
+	tracker.Observe("BTC-USDT", WsSeq{Mode: WsSeqPrevLinked, FirstId: 14, LastId: 14, PrevId: 12}, 4) //迟到
+	tracker.Observe("BTC-USDT", WsSeq{Mode: WsSeqPrevLinked, FirstId: 3, LastId: 3, PrevId: -1}, 5)   //重置
+	//bbo-tbt: 仅seqId
+	tracker.Observe("ETH-USDT", WsSeq{Mode: WsSeqMonotonic, FirstId: 100, LastId: 100}, 0)
+	tracker.Observe("ETH-USDT", WsSeq{Mode: WsSeqMonotonic, FirstId: 130, LastId: 130}, 1)
+	tracker.Observe("ETH-USDT", WsSeq{Mode: WsSeqMonotonic, FirstId: 120, LastId: 120}, 2)
+
+	result := tracker.Result()
+	if result.GapCount != 1 {
+		t.Errorf("Expected 1 gap, got %d", result.GapCount)
+	}
+	if result.OutOfOrderCount != 2 {
+		t.Errorf("Expected 2 out-of-order frames, got %d", result.OutOfOrderCount)
+	}
+	if result.ResetCount != 1 {
+		t.Errorf("Expected 1 reset, got %d", result.ResetCount)
+	}
+	if result.StallCount != 0 {
+		t.Errorf("Expected no stalls, got %d", result.StallCount)
+	}
+}
@@ -0,0 +1,32 @@
+package p2p_latency
+
+import (
+	"time"
+
+	"github.com/Hongssd/cgolatencytest/http_client"
+)
+
+// 交易所(如币安)会在连接满24小时后强制断开, 提前轮换连接
+const wsMaxConnAge = 23*time.Hour + 50*time.Minute
+
+// 新建自动重连的WebSocket会话, 并异步输出连接生命周期事件
+// resolve非空时固定解析到指定后端, 重连及轮换沿用同一后端
+func newWsSession(name, url string, timeoutMs int, resolve []string) *http_client.WebSocketSessionLibcurl {
+	session := http_client.NewWebSocketSessionLibcurl(http_client.WebSocketSessionConfig{
+		Url:            url,
+		TimeoutMs:      timeoutMs,
+		ConnectOptions: http_client.WebSocketConnectOptions{Resolve: resolve},
+		MaxConnAge:     wsMaxConnAge,
+	})
+	go func() {
+		for event := range session.Events() {
+			switch event.Type {
+			case http_client.WebSocketSessionEventDropped:
+				log.Warnf("[%s] 连接断开(第%d次重连): %s", name, event.Attempt, event.Error)
+			default:
+				log.Infof("[%s] 连接事件: %s", name, event.Type)
+			}
+		}
+	}()
+	return session
+}